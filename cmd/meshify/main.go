@@ -1,24 +1,77 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/tniswong/meshify/pkg/etl"
 	"github.com/tniswong/meshify/pkg/twitter"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
+	"syscall"
+	"time"
 )
 
+// ExitPartial is the exit code when extraction stopped early and only the records collected so far were written
+const ExitPartial = 3
+
 // MeshifyConfig stores the values that may be passed in via command line or environment variables
 type MeshifyConfig struct {
-	Key      string
-	Secret   string
-	Out      *os.File
-	Hashtags []string
-	N        int
+	Key        string
+	Secret     string
+	Out        *os.File
+	Hashtags   []string
+	N          int
+	API        twitter.Options
+	Stream     bool
+	Columns    []string
+	PerHashtag bool
+	Quotas     map[string]int
+	Budget     int
+	Workers    int
+	Ranges     int
+
+	// Checkpoints records the progress of each hashtag. Nil when there is no state file.
+	Checkpoints etl.CheckpointStore
+
+	// RemoveState is the default state file, removed once a run completes as there is nothing left to resume. Empty
+	// when --state was given, which is always kept.
+	RemoveState string
+
+	// Query is the search each hashtag is queried with
+	Query twitter.SearchQuery
+
+	// SinceIDs records the newest tweet id of each hashtag, for incremental runs. Nil unless --incremental is set.
+	SinceIDs etl.SinceIDStore
+
+	// OmitHeader is set when resuming into an output file that already has a CSV header
+	OmitHeader bool
+
+	// APIVersion selects the search: 1 for the v1.1 search/tweets, or 2 for the API v2 recent search
+	APIVersion int
+
+	// Credentials, when set, are pooled in place of Key and Secret, each search using whichever has the most requests
+	// left in its rate limit window
+	Credentials []twitter.Credential
+
+	// TrendsWOEID, when set, replaces Hashtags with the hashtags trending at this WOEID that pass the Trends filter
+	TrendsWOEID int64
+	Trends      twitter.TrendFilter
+}
+
+// runner is implemented by both etl.ETL and etl.StreamETL
+type runner interface {
+	RunContext(ctx context.Context) error
 }
 
 // RootCommand is the root cobra command
@@ -28,21 +81,44 @@ var RootCommand = &cobra.Command{
 	Long:  `Use the Twitter API to gather 2000 unique tweets with the hashtag #IoT and output them to a CSV file.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		c, err := configure()
+		c, err := configure(cmd.Flags())
 
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		defer c.Out.Close()
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		if c.TrendsWOEID != 0 {
 
-		api := twitter.NewAPI(c.Key, c.Secret)
-		e := etl.HashtagsToCSV(c.Out, api, c.N, c.Hashtags...)
+			if c.Hashtags, err = trendingHashtags(ctx, c); err != nil {
+				log.Fatal(describeError(err))
+			}
+
+			log.Printf("querying trending hashtags: %s", strings.Join(c.Hashtags, ", "))
+
+		}
 
-		if err := e.ETL(); err != nil {
+		fetcher, err := searchFetcher(c)
+
+		if err != nil {
 			log.Fatal(err)
 		}
 
+		err = pipeline(c, fetcher).RunContext(ctx)
+		c.Out.Close()
+
+		if code := exitCode(err, c.Checkpoints != nil); code != 0 {
+			os.Exit(code)
+		}
+
+		if c.RemoveState != "" {
+			if err := os.Remove(c.RemoveState); err != nil && !os.IsNotExist(err) {
+				log.Printf("warning: could not remove state file: %v", err)
+			}
+		}
+
 	},
 }
 
@@ -53,16 +129,54 @@ func init() {
 	// register flags to command
 	RootCommand.PersistentFlags().StringP("api-key", "k", "", "Required. Twitter API Public Key. If unset uses MESHIFY_API_KEY environment variable.")
 	RootCommand.PersistentFlags().StringP("api-secret", "s", "", "Required. Twitter API Secret Key. If unset uses MESHIFY_API_SECRET environment variable.")
+	RootCommand.Flags().String("credentials", "", "JSON file of several Twitter apps to search with, in place of --api-key and --api-secret, as '[{\"key\": \"...\", \"secret\": \"...\"}, ...]'. Each search uses the app with the most requests left in its rate limit window.")
 	RootCommand.PersistentFlags().StringP("out", "o", "", "Output file path for csv formatted output. (default STDOUT)")
-	RootCommand.PersistentFlags().StringSliceP("tags", "t", []string{"IoT"}, "Hashtags to query. Note: '#' is a comment character in bash, so use ONLY the tag name rather than the full hashtag (ex: 'IoT' NOT '#IoT'!)")
-	RootCommand.PersistentFlags().IntP("number", "n", 2000, "Number of tweets per hashtag.")
+	RootCommand.Flags().StringSliceP("tags", "t", []string{"IoT"}, "Hashtags to query. Note: '#' is a comment character in bash, so use ONLY the tag name rather than the full hashtag (ex: 'IoT' NOT '#IoT'!)")
+	RootCommand.Flags().Int64("trends", 0, "Query the hashtags trending at this WOEID (ex: 1 for worldwide) instead of --tags. See 'meshify trends' for the WOEIDs available.")
+	RootCommand.Flags().Int("trends-top", 10, "Number of trending hashtags to query with --trends, most trending first.")
+	RootCommand.Flags().String("trends-match", "", "Only query trending hashtags matching this regular expression, including the '#' (ex: '(?i)iot|ai').")
+	RootCommand.Flags().StringSlice("trends-allow", nil, "Only query trending hashtags in this list, compared without case. Use ONLY the tag name, as for --tags.")
+	RootCommand.Flags().IntP("number", "n", 2000, "Number of tweets per hashtag.")
+	RootCommand.Flags().StringSlice("keywords", nil, "Words that must all appear in each tweet. A keyword containing spaces is matched as an exact phrase.")
+	RootCommand.Flags().StringSlice("from", nil, "Only tweets sent by any of these accounts.")
+	RootCommand.Flags().StringSlice("to", nil, "Only replies to any of these accounts.")
+	RootCommand.Flags().StringSlice("mentions", nil, "Only tweets mentioning any of these accounts.")
+	RootCommand.Flags().Bool("exclude-retweets", false, "Leave out retweets.")
+	RootCommand.Flags().Bool("exclude-replies", false, "Leave out replies.")
+	RootCommand.Flags().Bool("media", false, "Only tweets with images or videos.")
+	RootCommand.Flags().Bool("links", false, "Only tweets with links.")
+	RootCommand.Flags().Int("min-faves", 0, "Only tweets with at least this many likes.")
+	RootCommand.Flags().String("since", "", "Only tweets created on or after this date (YYYY-MM-DD).")
+	RootCommand.Flags().String("until", "", "Only tweets created before this date (YYYY-MM-DD).")
+	RootCommand.Flags().String("geocode", "", "Only tweets by users located within a radius of a point, as 'latitude,longitude,radius' (ex: '37.781157,-122.398720,1mi').")
+	RootCommand.Flags().String("lang", "en", "Only tweets in this ISO 639-1 language. Empty for any language.")
+	RootCommand.Flags().String("result-type", "", "Which results to return: 'recent', 'popular' or 'mixed'. (default mixed)")
+	RootCommand.Flags().Int("api-version", 1, "Twitter search API version: 1 for the v1.1 standard search, or 2 for the v2 recent search. Tweets from v2 have v2 fields, with the author and other referenced objects joined on (ex: 'author.username').")
+	RootCommand.PersistentFlags().Bool("extended", false, "Request tweets in extended mode, so full_text holds the complete text of tweets longer than 140 characters. The text column always holds the most complete text available.")
+	RootCommand.PersistentFlags().String("base-url", twitter.BaseURL, "Twitter API base url. Useful for targeting a local stand-in server.")
+	RootCommand.PersistentFlags().Duration("timeout", 30*time.Second, "HTTP timeout for each Twitter API request.")
+	RootCommand.PersistentFlags().Bool("stream", false, "Write each tweet as soon as it is fetched, using constant memory. The CSV header is taken from --columns, or the first tweet.")
+	RootCommand.PersistentFlags().StringSlice("columns", nil, "CSV columns to write, in order. Nested fields use dot notation (ex: 'user.screen_name'). (default every field, or with --stream the fields of the first tweet)")
+	RootCommand.Flags().Bool("per-hashtag", false, "Write a separate row for each hashtag a tweet matched, rather than one row per unique tweet listing every matched hashtag.")
+	RootCommand.PersistentFlags().Int("retries", twitter.DefaultRetryPolicy.MaxAttempts, "Maximum attempts for each Twitter API request that fails with a transient error.")
+	RootCommand.Flags().StringToInt("quota", nil, "Number of tweets for specific tags, overriding --number (ex: 'IoT=500,golang=100').")
+	RootCommand.Flags().Int("budget", 0, "Maximum number of tweets across all tags, divided fairly between them. 0 means no limit.")
+	RootCommand.Flags().Int("workers", 0, "Maximum number of tags to query at once. 0 queries every tag at once.")
+	RootCommand.Flags().String("state", "", "State file recording the progress of each tag, for --resume. (default <out>.state when --out is set, removed once the run completes)")
+	RootCommand.Flags().Bool("resume", false, "Continue each tag where the previous run left off, as recorded by the state file, appending to --out.")
+	RootCommand.Flags().String("incremental", "", "Only fetch tweets newer than those fetched by previous runs, tracking the newest tweet id of each tag in this file.")
+	RootCommand.Flags().Int("ranges", 1, "Split the 7 day search window of each tag into this many ranges, fetched in parallel. Speeds up large runs at the cost of extra requests.")
 
 	// required flags
 	RootCommand.MarkFlagRequired("api-key")
 	RootCommand.MarkFlagRequired("api-secret")
 
+	RootCommand.AddCommand(RehydrateCommand)
+	RootCommand.AddCommand(TrendsCommand)
+
 	// bind flags to viper
 	viper.BindPFlags(RootCommand.PersistentFlags())
+	viper.BindPFlags(RootCommand.Flags())
 
 	// environment variable fallbacks
 	viper.SetEnvPrefix("MESHIFY")
@@ -80,16 +194,23 @@ func main() {
 
 }
 
-func configure() (MeshifyConfig, error) {
+func configure(flags *pflag.FlagSet) (MeshifyConfig, error) {
+
+	var credentials []twitter.Credential
+
+	if path := viper.GetString("credentials"); path != "" {
+
+		var err error
+
+		if credentials, err = readCredentials(path); err != nil {
+			return MeshifyConfig{}, fmt.Errorf("error: invalid --credentials: %v", err)
+		}
 
-	k := viper.GetString("api-key")
-	if k == "" {
-		return MeshifyConfig{}, errors.New("error: flag [-k, --api-key string] or environment variable MESHIFY_API_KEY is required")
 	}
 
-	s := viper.GetString("api-secret")
-	if s == "" {
-		return MeshifyConfig{}, errors.New("error: flag [-s, --api-secret string] or environment variable MESHIFY_API_SECRET is required")
+	k, s, err := apiKey()
+	if err != nil && credentials == nil {
+		return MeshifyConfig{}, err
 	}
 
 	var hashtags []string
@@ -98,17 +219,87 @@ func configure() (MeshifyConfig, error) {
 		hashtags = append(hashtags, "#"+hashtag)
 	}
 
+	quota, err := flags.GetStringToInt("quota")
+	if err != nil {
+		return MeshifyConfig{}, fmt.Errorf("error: invalid --quota: %v", err)
+	}
+
+	quotas := map[string]int{}
+	for tag, n := range quota {
+		quotas["#"+tag] = n
+	}
+
+	query, err := searchQuery()
+	if err != nil {
+		return MeshifyConfig{}, err
+	}
+
 	c := MeshifyConfig{
-		Key:      k,
-		Secret:   s,
-		Out:      os.Stdout,
-		Hashtags: hashtags,
-		N:        viper.GetInt("number"),
+		Key:        k,
+		Secret:     s,
+		Out:        os.Stdout,
+		Hashtags:   hashtags,
+		N:          viper.GetInt("number"),
+		Stream:     viper.GetBool("stream"),
+		Columns:    viper.GetStringSlice("columns"),
+		PerHashtag: viper.GetBool("per-hashtag"),
+		Quotas:     quotas,
+		Query:      query,
+		Budget:     viper.GetInt("budget"),
+		Workers:    viper.GetInt("workers"),
+		Ranges:     viper.GetInt("ranges"),
+		API:        apiOptions(),
+	}
+
+	c.Credentials = credentials
+
+	if c.TrendsWOEID = viper.GetInt64("trends"); c.TrendsWOEID != 0 {
+
+		c.Trends = twitter.TrendFilter{
+			Top:   viper.GetInt("trends-top"),
+			Allow: viper.GetStringSlice("trends-allow"),
+		}
+
+		if match := viper.GetString("trends-match"); match != "" {
+
+			if c.Trends.Match, err = regexp.Compile(match); err != nil {
+				return MeshifyConfig{}, fmt.Errorf("error: invalid --trends-match: %v", err)
+			}
+
+		}
+
+	}
+
+	switch c.APIVersion = viper.GetInt("api-version"); c.APIVersion {
+	case 1, 2:
+	default:
+		return MeshifyConfig{}, fmt.Errorf("error: invalid --api-version %d, must be 1 or 2", c.APIVersion)
 	}
 
 	o := viper.GetString("out")
+	resume := viper.GetBool("resume")
 
-	if o != "" {
+	if resume && o == "" {
+		return MeshifyConfig{}, errors.New("error: flag [--resume] requires [-o, --out string]")
+	}
+
+	if o != "" && resume {
+
+		outfile, header, err := openForAppend(o)
+
+		if err != nil {
+			return MeshifyConfig{}, fmt.Errorf("error: could not open file: %v", err)
+		}
+
+		c.Out = outfile
+
+		// keep the columns the file was started with
+		if len(header) > 0 {
+			c.Columns = header
+			c.OmitHeader = true
+		}
+
+	} else if o != "" {
 
 		outfile, err := os.Create(o)
 
@@ -120,6 +311,355 @@ func configure() (MeshifyConfig, error) {
 
 	}
 
+	state := viper.GetString("state")
+
+	if state == "" && o != "" {
+		state = o + ".state"
+		c.RemoveState = state
+	}
+
+	if state != "" {
+
+		// a fresh run starts from scratch
+		if !resume {
+			if err := os.Remove(state); err != nil && !os.IsNotExist(err) {
+				return MeshifyConfig{}, fmt.Errorf("error: could not reset state file: %v", err)
+			}
+		}
+
+		c.Checkpoints = etl.NewFileCheckpointStore(state)
+
+	}
+
+	if incremental := viper.GetString("incremental"); incremental != "" {
+		c.SinceIDs = etl.NewFileSinceIDStore(incremental)
+	}
+
 	return c, nil
 
 }
+
+// apiKey returns the Twitter API key and secret from the flags or environment
+func apiKey() (string, string, error) {
+
+	k := viper.GetString("api-key")
+	if k == "" {
+		return "", "", errors.New("error: flag [-k, --api-key string] or environment variable MESHIFY_API_KEY is required")
+	}
+
+	s := viper.GetString("api-secret")
+	if s == "" {
+		return "", "", errors.New("error: flag [-s, --api-secret string] or environment variable MESHIFY_API_SECRET is required")
+	}
+
+	return k, s, nil
+
+}
+
+// apiOptions builds the twitter.Options shared by every command from the flags
+func apiOptions() twitter.Options {
+
+	retryPolicy := twitter.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = viper.GetInt("retries")
+
+	opts := twitter.Options{
+		BaseURL:     viper.GetString("base-url"),
+		Timeout:     viper.GetDuration("timeout"),
+		UserAgent:   "meshify",
+		RetryPolicy: &retryPolicy,
+	}
+
+	if viper.GetBool("extended") {
+		opts.TweetMode = twitter.TweetModeExtended
+	}
+
+	return opts
+
+}
+
+// searchQuery builds the search each hashtag is queried with from the flags
+func searchQuery() (twitter.SearchQuery, error) {
+
+	query := twitter.SearchQuery{
+		Keywords:        viper.GetStringSlice("keywords"),
+		From:            viper.GetStringSlice("from"),
+		To:              viper.GetStringSlice("to"),
+		Mentions:        viper.GetStringSlice("mentions"),
+		ExcludeRetweets: viper.GetBool("exclude-retweets"),
+		ExcludeReplies:  viper.GetBool("exclude-replies"),
+		Media:           viper.GetBool("media"),
+		Links:           viper.GetBool("links"),
+		MinFaves:        viper.GetInt("min-faves"),
+		Geocode:         viper.GetString("geocode"),
+		Lang:            viper.GetString("lang"),
+		ResultType:      twitter.ResultType(viper.GetString("result-type")),
+	}
+
+	switch query.ResultType {
+	case "", twitter.ResultTypeMixed, twitter.ResultTypeRecent, twitter.ResultTypePopular:
+	default:
+		return twitter.SearchQuery{}, fmt.Errorf("error: invalid --result-type %q, must be one of recent, popular or mixed", query.ResultType)
+	}
+
+	for flag, date := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+
+		value := viper.GetString(flag)
+
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse("2006-01-02", value)
+
+		if err != nil {
+			return twitter.SearchQuery{}, fmt.Errorf("error: invalid --%s %q, must be YYYY-MM-DD", flag, value)
+		}
+
+		*date = t
+
+	}
+
+	return query, nil
+
+}
+
+// readCredentials reads the JSON array of app credentials at path
+func readCredentials(path string) ([]twitter.Credential, error) {
+
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials []twitter.Credential
+
+	if err := json.Unmarshal(b, &credentials); err != nil {
+		return nil, err
+	}
+
+	if len(credentials) == 0 {
+		return nil, errors.New("no credentials")
+	}
+
+	for i, credential := range credentials {
+		if credential.Key == "" || credential.Secret == "" {
+			return nil, fmt.Errorf("credential %d has no key or secret", i+1)
+		}
+	}
+
+	return credentials, nil
+
+}
+
+// openForAppend opens the file at path for appending, creating it if necessary, and returns the CSV header it already
+// has, if any
+func openForAppend(path string) (*os.File, []string, error) {
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header, err := csv.NewReader(file).Read()
+
+	if err == io.EOF {
+		return file, nil, nil
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return file, header, nil
+
+}
+
+// trendingHashtags returns the hashtags trending at c.TrendsWOEID that pass c.Trends
+func trendingHashtags(ctx context.Context, c MeshifyConfig) ([]string, error) {
+
+	k, s := c.Key, c.Secret
+
+	if len(c.Credentials) > 0 {
+		k, s = c.Credentials[0].Key, c.Credentials[0].Secret
+	}
+
+	trends, err := twitter.NewAPIWithOptions(k, s, c.API).Trends(ctx, c.TrendsWOEID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hashtags := c.Trends.Hashtags(trends)
+
+	if len(hashtags) == 0 {
+		return nil, fmt.Errorf("error: none of the %d topics trending at WOEID %d are hashtags that pass --trends-match and --trends-allow", len(trends), c.TrendsWOEID)
+	}
+
+	return hashtags, nil
+
+}
+
+// searchFetcher returns the search API of the configured version, pooling the credentials if there are any
+func searchFetcher(c MeshifyConfig) (etl.HashtagFetcher, error) {
+
+	if len(c.Credentials) > 0 && c.APIVersion == 2 {
+		return twitter.NewV2CredentialPool(c.Credentials, c.API, twitter.V2Options{})
+	}
+
+	if len(c.Credentials) > 0 {
+		return twitter.NewCredentialPool(c.Credentials, c.API)
+	}
+
+	api := twitter.NewAPIWithOptions(c.Key, c.Secret, c.API)
+
+	if c.APIVersion == 2 {
+		return twitter.NewV2API(api, twitter.V2Options{}), nil
+	}
+
+	return api, nil
+
+}
+
+// pipeline builds the ETL described by the config
+func pipeline(c MeshifyConfig, fetcher etl.HashtagFetcher) runner {
+
+	extractor := etl.NewHashtagExtractorWithOptions(fetcher, etl.HashtagExtractorOptions{
+		N:           c.N,
+		Hashtags:    c.Hashtags,
+		PerHashtag:  c.PerHashtag,
+		Quotas:      c.Quotas,
+		Budget:      c.Budget,
+		Workers:     c.Workers,
+		Ranges:      c.Ranges,
+		Checkpoints: c.Checkpoints,
+		SinceIDs:    c.SinceIDs,
+		Query:       &c.Query,
+	})
+
+	if c.Stream {
+
+		loader := etl.NewCSVStreamLoader(c.Out, c.Columns...)
+		loader.SetOmitHeader(c.OmitHeader)
+
+		return etl.StreamETL{
+			Extractor:   extractor,
+			Transformer: etl.NormalizeText,
+			Loader:      loader,
+		}
+
+	}
+
+	loader := etl.NewCSVLoader(c.Out, c.Columns...)
+	loader.SetOmitHeader(c.OmitHeader)
+
+	return etl.ETL{
+		Extractor:   extractor,
+		Transformer: etl.NormalizeText,
+		Loader:      loader,
+		LoadPartial: true,
+	}
+
+}
+
+// interruptContext returns a context that is cancelled by the first SIGINT or SIGTERM. Signal handling is then
+// restored to the default, so a second Ctrl-C terminates immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+
+		defer signal.Stop(signals)
+
+		select {
+		case sig := <-signals:
+			log.Printf("received %v, writing partial results (repeat to quit immediately)", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+
+	}()
+
+	return ctx, cancel
+
+}
+
+// exitCode reports err, as returned by a run, to stderr and returns the code to exit with: 0 if err is nil,
+// ExitPartial if the run stopped early after collecting some tweets or being interrupted, and 1 otherwise. A run that
+// fails before collecting anything, such as when Twitter rejects the credentials, reports the cause rather than empty
+// partial results.
+//
+// resumable: whether the run can be continued with --resume
+func exitCode(err error, resumable bool) int {
+
+	if err == nil {
+		return 0
+	}
+
+	var partial *etl.ExtractError
+
+	if !errors.As(err, &partial) {
+		log.Print(describeError(err))
+		return 1
+	}
+
+	if errors.Is(err, context.Canceled) || collected(partial) > 0 {
+		reportPartial(partial, resumable)
+		return ExitPartial
+	}
+
+	log.Print(describeError(partial.Err))
+
+	return 1
+
+}
+
+// collected returns the number of tweets collected across every hashtag of partial
+func collected(partial *etl.ExtractError) int {
+
+	n := 0
+
+	for _, p := range partial.Progress {
+		n += p.Collected
+	}
+
+	return n
+
+}
+
+// reportPartial writes how many tweets were collected for each hashtag to stderr
+func reportPartial(partial *etl.ExtractError, resumable bool) {
+
+	log.Printf("warning: extraction stopped early, partial results written: %v", partial.Err)
+
+	for _, p := range partial.Progress {
+		log.Printf("  %v", p)
+	}
+
+	if resumable {
+		log.Printf("run again with --resume to continue where this run left off")
+	}
+
+}
+
+// describeError adds a hint for the Twitter API errors a user can act on
+func describeError(err error) string {
+
+	switch {
+	case twitter.IsAuthError(err):
+		return fmt.Sprintf("error: twitter rejected the credentials, check --api-key and --api-secret: %v", err)
+	case twitter.IsSuspended(err):
+		return fmt.Sprintf("error: the twitter app or account is suspended or locked: %v", err)
+	case twitter.IsRateLimited(err):
+		return fmt.Sprintf("error: twitter rate limit exceeded, try again later: %v", err)
+	default:
+		return err.Error()
+	}
+
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+)
+
+var _ = Describe("meshify", func() {
+
+	var stderr *bytes.Buffer
+
+	BeforeEach(func() {
+		stderr = &bytes.Buffer{}
+		log.SetOutput(stderr)
+	})
+
+	AfterEach(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	Describe("exitCode()", func() {
+
+		It("Should report why a run failed before collecting any tweets, rather than partial results", func() {
+
+			// given
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"errors":[{"code":99,"message":"Unable to verify your credentials"}]}`)
+			}))
+			defer server.Close()
+
+			out, err := ioutil.TempFile("", "meshify")
+			Expect(err).To(BeNil())
+			defer os.Remove(out.Name())
+
+			c := MeshifyConfig{
+				Key:      "key",
+				Secret:   "secret",
+				Out:      out,
+				Hashtags: []string{"IoT"},
+				N:        5,
+				API:      twitter.Options{BaseURL: server.URL + "/"},
+			}
+
+			fetcher, err := searchFetcher(c)
+			Expect(err).To(BeNil())
+
+			err = pipeline(c, fetcher).RunContext(context.Background())
+			out.Close()
+
+			// when
+			code := exitCode(err, false)
+
+			// then
+			Expect(code).To(Equal(1))
+			Expect(stderr.String()).To(ContainSubstring("twitter rejected the credentials"))
+			Expect(stderr.String()).NotTo(ContainSubstring("partial results"))
+
+		})
+
+		It("Should report partial results when some tweets were collected", func() {
+
+			// given
+			err := &etl.ExtractError{
+				Err:      errors.New("fetch error"),
+				Progress: []etl.HashtagProgress{{Hashtag: "IoT", Collected: 2, Target: 5}},
+			}
+
+			// when
+			code := exitCode(err, true)
+
+			// then
+			Expect(code).To(Equal(ExitPartial))
+			Expect(stderr.String()).To(ContainSubstring("partial results written"))
+			Expect(stderr.String()).To(ContainSubstring("--resume"))
+
+		})
+
+		It("Should report partial results when interrupted, even before any tweets were collected", func() {
+
+			// given
+			err := &etl.ExtractError{
+				Err:      context.Canceled,
+				Progress: []etl.HashtagProgress{{Hashtag: "IoT", Collected: 0, Target: 5}},
+			}
+
+			// when
+			code := exitCode(err, false)
+
+			// then
+			Expect(code).To(Equal(ExitPartial))
+			Expect(stderr.String()).To(ContainSubstring("IoT: 0/5"))
+
+		})
+
+		It("Should exit 0 when the run succeeded", func() {
+			Expect(exitCode(nil, false)).To(Equal(0))
+		})
+
+	})
+
+})
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"io"
+	"log"
+	"os"
+)
+
+// RehydrateConfig stores the values the rehydrate command may be passed via command line or environment variables
+type RehydrateConfig struct {
+	Key     string
+	Secret  string
+	Out     *os.File
+	API     twitter.Options
+	Stream  bool
+	Columns []string
+
+	// IDs are the ids of the tweets to rehydrate
+	IDs []int64
+
+	// Missing receives the ids of the tweets that no longer exist, one per line. Nil unless --missing is set.
+	Missing *os.File
+}
+
+// RehydrateCommand turns a list of tweet ids back into full tweets
+var RehydrateCommand = &cobra.Command{
+	Use:   "rehydrate <file>",
+	Short: "Fetch the full tweets of a list of tweet ids",
+	Long: `Fetch the full tweets of a list of tweet ids, such as a dataset shared as ids only, and output them to a CSV file.
+The file holds one id per line, or is a CSV file with an id_str column, such as one written by meshify. Use '-' to read
+from STDIN. Tweets that no longer exist are left out, and counted on stderr.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		c, err := configureRehydrate(cmd.Flags(), args[0])
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		api := twitter.NewAPIWithOptions(c.Key, c.Secret, c.API)
+		missing := 0
+
+		err = rehydratePipeline(c, api, func(ids []int64) {
+
+			missing += len(ids)
+
+			if c.Missing != nil {
+				for _, id := range ids {
+					fmt.Fprintln(c.Missing, id)
+				}
+			}
+
+		}).RunContext(ctx)
+
+		c.Out.Close()
+
+		if c.Missing != nil {
+			c.Missing.Close()
+		}
+
+		if missing > 0 {
+			log.Printf("%d of %d tweets no longer exist", missing, len(c.IDs))
+		}
+
+		if code := exitCode(err, false); code != 0 {
+			os.Exit(code)
+		}
+
+	},
+}
+
+func init() {
+	RehydrateCommand.Flags().String("missing", "", "File to write the ids of tweets that no longer exist to, one per line.")
+}
+
+func configureRehydrate(flags *pflag.FlagSet, path string) (RehydrateConfig, error) {
+
+	k, s, err := apiKey()
+	if err != nil {
+		return RehydrateConfig{}, err
+	}
+
+	ids, err := readIDs(path)
+	if err != nil {
+		return RehydrateConfig{}, fmt.Errorf("error: could not read tweet ids: %v", err)
+	}
+
+	c := RehydrateConfig{
+		Key:     k,
+		Secret:  s,
+		Out:     os.Stdout,
+		API:     apiOptions(),
+		Stream:  viper.GetBool("stream"),
+		Columns: viper.GetStringSlice("columns"),
+		IDs:     ids,
+	}
+
+	if o := viper.GetString("out"); o != "" {
+
+		if c.Out, err = os.Create(o); err != nil {
+			return RehydrateConfig{}, fmt.Errorf("error: could not open file: %v", err)
+		}
+
+	}
+
+	if m, _ := flags.GetString("missing"); m != "" {
+
+		if c.Missing, err = os.Create(m); err != nil {
+			return RehydrateConfig{}, fmt.Errorf("error: could not open file: %v", err)
+		}
+
+	}
+
+	return c, nil
+
+}
+
+// readIDs reads the tweet ids in the file at path, or STDIN if path is "-"
+func readIDs(path string) ([]int64, error) {
+
+	var r io.Reader = os.Stdin
+
+	if path != "-" {
+
+		file, err := os.Open(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer file.Close()
+
+		r = file
+
+	}
+
+	return etl.ReadTweetIDs(r)
+
+}
+
+// rehydratePipeline builds the ETL described by the config, reporting the ids of tweets that are gone to missing
+func rehydratePipeline(c RehydrateConfig, api *twitter.API, missing func(ids []int64)) runner {
+
+	extractor := etl.NewLookupExtractor(api, etl.LookupExtractorOptions{
+		IDs:     c.IDs,
+		Missing: missing,
+	})
+
+	if c.Stream {
+		return etl.StreamETL{
+			Extractor:   extractor,
+			Transformer: etl.NormalizeText,
+			Loader:      etl.NewCSVStreamLoader(c.Out, c.Columns...),
+		}
+	}
+
+	return etl.ETL{
+		Extractor:   extractor,
+		Transformer: etl.NormalizeText,
+		Loader:      etl.NewCSVLoader(c.Out, c.Columns...),
+		LoadPartial: true,
+	}
+
+}
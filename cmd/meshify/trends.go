@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"log"
+	"os"
+	"strconv"
+)
+
+// TrendsCommand lists the locations trends are available for, or the topics trending at one of them
+var TrendsCommand = &cobra.Command{
+	Use:   "trends [woeid]",
+	Short: "List the WOEIDs trends are available for, or the topics trending at a WOEID",
+	Long: `List the locations trends are available for, with their WOEIDs, as CSV. Given a WOEID, list the topics trending there
+instead, most trending first. Pass the WOEID to --trends to query its trending hashtags.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		k, s, err := apiKey()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx, cancel := interruptContext()
+		defer cancel()
+
+		api := twitter.NewAPIWithOptions(k, s, apiOptions())
+
+		if len(args) == 0 {
+			err = writeTrendLocations(ctx, api)
+		} else {
+			err = writeTrends(ctx, api, args[0])
+		}
+
+		if err != nil {
+			log.Fatal(describeError(err))
+		}
+
+	},
+}
+
+// writeTrendLocations writes the locations trends are available for to STDOUT
+func writeTrendLocations(ctx context.Context, api *twitter.API) error {
+
+	locations, err := api.TrendLocations(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"woeid", "name", "country", "type"})
+
+	for _, location := range locations {
+		w.Write([]string{strconv.FormatInt(location.WOEID, 10), location.Name, location.Country, location.PlaceType.Name})
+	}
+
+	w.Flush()
+
+	return w.Error()
+
+}
+
+// writeTrends writes the topics trending at woeid to STDOUT
+func writeTrends(ctx context.Context, api *twitter.API, woeid string) error {
+
+	id, err := strconv.ParseInt(woeid, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("error: invalid WOEID %q", woeid)
+	}
+
+	trends, err := api.Trends(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"name", "tweet_volume"})
+
+	for _, trend := range trends {
+		w.Write([]string{trend.Name, strconv.Itoa(trend.TweetVolume)})
+	}
+
+	w.Flush()
+
+	return w.Error()
+
+}
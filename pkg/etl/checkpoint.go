@@ -0,0 +1,158 @@
+package etl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpoint records how far the extraction of a single hashtag got, so that an interrupted run can be resumed
+type Checkpoint struct {
+	// MaxID is the max_id of the next page to fetch. Zero if no page has been fetched yet.
+	MaxID int64 `json:"max_id"`
+
+	// NewestID is the id of the newest record extracted, which becomes the since_id of the next incremental run
+	NewestID int64 `json:"newest_id"`
+
+	// Collected is the number of records extracted so far
+	Collected int `json:"collected"`
+
+	// Exhausted is set once the hashtag has run out of results
+	Exhausted bool `json:"exhausted"`
+}
+
+// CheckpointStore persists a Checkpoint for each hashtag. Implementations must be safe for concurrent use.
+type CheckpointStore interface {
+	Load() (map[string]Checkpoint, error)
+	Save(hashtag string, checkpoint Checkpoint) error
+}
+
+// NewFileCheckpointStore is a constructor for FileCheckpointStore
+//
+// path: the JSON state file. It need not exist yet.
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{
+		path: path,
+	}
+}
+
+// FileCheckpointStore is a CheckpointStore backed by a JSON file. Every Save rewrites the whole file, through a
+// temporary file that is renamed over it, so a crash never leaves it half written.
+type FileCheckpointStore struct {
+	path  string
+	mu    sync.Mutex
+	state *fileState
+}
+
+// fileState is the format of the state file
+type fileState struct {
+	Hashtags map[string]Checkpoint `json:"hashtags"`
+}
+
+// Load implements CheckpointStore. A missing file holds no checkpoints.
+func (s *FileCheckpointStore) Load() (map[string]Checkpoint, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	checkpoints := map[string]Checkpoint{}
+
+	for hashtag, checkpoint := range s.state.Hashtags {
+		checkpoints[hashtag] = checkpoint
+	}
+
+	return checkpoints, nil
+
+}
+
+// Save implements CheckpointStore
+func (s *FileCheckpointStore) Save(hashtag string, checkpoint Checkpoint) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.read(); err != nil {
+		return err
+	}
+
+	s.state.Hashtags[hashtag] = checkpoint
+
+	return writeJSONFile(s.path, s.state)
+
+}
+
+// read loads the state file, unless it has been loaded already
+func (s *FileCheckpointStore) read() error {
+
+	if s.state != nil {
+		return nil
+	}
+
+	state := &fileState{}
+
+	if err := readJSONFile(s.path, state); err != nil {
+		return err
+	}
+
+	if state.Hashtags == nil {
+		state.Hashtags = map[string]Checkpoint{}
+	}
+
+	s.state = state
+
+	return nil
+
+}
+
+// readJSONFile decodes the JSON file at path into v. A missing or empty file leaves v unchanged.
+func readJSONFile(path string, v interface{}) error {
+
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(b) < 1 {
+		return nil
+	}
+
+	return json.Unmarshal(b, v)
+
+}
+
+// writeJSONFile replaces the file at path with v encoded as JSON, through a temporary file that is renamed over it
+func writeJSONFile(path string, v interface{}) error {
+
+	b, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+
+}
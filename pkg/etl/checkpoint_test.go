@@ -0,0 +1,167 @@
+package etl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Checkpoint", func() {
+
+	var dir string
+
+	BeforeEach(func() {
+
+		var err error
+
+		dir, err = ioutil.TempDir("", "meshify")
+		Expect(err).To(BeNil())
+
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("FileCheckpointStore", func() {
+
+		It("Should load no checkpoints when the file does not exist", func() {
+
+			// given
+			store := NewFileCheckpointStore(filepath.Join(dir, "state.json"))
+
+			// when
+			checkpoints, err := store.Load()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(checkpoints).To(BeEmpty())
+
+		})
+
+		It("Should load the checkpoints saved by another store", func() {
+
+			// given
+			path := filepath.Join(dir, "state.json")
+
+			Expect(NewFileCheckpointStore(path).Save("#IoT", Checkpoint{MaxID: 12345, Collected: 10})).To(BeNil())
+
+			// when
+			checkpoints, err := NewFileCheckpointStore(path).Load()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(checkpoints).To(Equal(map[string]Checkpoint{"#IoT": {MaxID: 12345, Collected: 10}}))
+
+		})
+
+	})
+
+	Describe("HashtagExtractorOptions.Checkpoints", func() {
+
+		It("Should resume each hashtag where an interrupted run left off", func() {
+
+			// given
+			api := newTimelineAPI(20, time.Minute)
+			store := NewFileCheckpointStore(filepath.Join(dir, "state.json"))
+			stopErr := errors.New("stop")
+
+			// the first run fails on its third page
+			calls := 0
+			interrupted := NewHashtagExtractorWithOptions(MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					calls++
+
+					if calls == 3 {
+						return twitter.SearchAPIResponse{}, stopErr
+					}
+
+					return api.FetchHashtagRange(context.Background(), hashtag, 4, 0, maxID)
+
+				},
+			}, HashtagExtractorOptions{N: 15, Hashtags: []string{"#IoT"}, Checkpoints: store})
+
+			resumed := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:           15,
+				Hashtags:    []string{"#IoT"},
+				Checkpoints: store,
+			})
+
+			// when
+			_, err := interrupted.Extract()
+			Expect(errors.Is(err, stopErr)).To(BeTrue())
+
+			records, err := resumed.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(7))
+			Expect(records[0]["id_str"]).To(Equal(fmt.Sprint(api.ids[8])))
+			Expect(records[6]["id_str"]).To(Equal(fmt.Sprint(api.ids[14])))
+
+			checkpoints, err := store.Load()
+
+			Expect(err).To(BeNil())
+			Expect(checkpoints["#IoT"]).To(Equal(Checkpoint{MaxID: api.ids[14] - 1, NewestID: api.ids[0], Collected: 15}))
+
+		})
+
+		It("Should not query a hashtag that has run out of results", func() {
+
+			// given
+			store := NewFileCheckpointStore(filepath.Join(dir, "state.json"))
+			Expect(store.Save("#IoT", Checkpoint{MaxID: 12345, Collected: 3, Exhausted: true})).To(BeNil())
+
+			hashtagExtractor := NewHashtagExtractorWithOptions(MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+					Fail("should not be called")
+					return twitter.SearchAPIResponse{}, nil
+				},
+			}, HashtagExtractorOptions{N: 5, Hashtags: []string{"#IoT"}, Checkpoints: store})
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(BeEmpty())
+
+		})
+
+		It("Should resume a hashtag paged through id ranges below its checkpoint", func() {
+
+			// given
+			api := newTimelineAPI(200, 30*time.Minute)
+			store := NewFileCheckpointStore(filepath.Join(dir, "state.json"))
+			Expect(store.Save("#IoT", Checkpoint{MaxID: api.ids[49], Collected: 49})).To(BeNil())
+
+			hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:           100,
+				Hashtags:    []string{"#IoT"},
+				Ranges:      3,
+				Checkpoints: store,
+			})
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(51))
+			Expect(records[0]["id_str"]).To(Equal(fmt.Sprint(api.ids[49])))
+			Expect(records[50]["id_str"]).To(Equal(fmt.Sprint(api.ids[99])))
+
+		})
+
+	})
+
+})
@@ -1,6 +1,8 @@
 package etl
 
 import (
+	"context"
+	"errors"
 	"github.com/tniswong/meshify/pkg/twitter"
 	"os"
 )
@@ -21,21 +23,205 @@ func HashtagsToCSV(file *os.File, api *twitter.API, n int, hashtags ...string) E
 	}
 }
 
-// ETL is a generic construct for an ETL. This implementation skips the transform step.
+// HashtagsToCSVStream constructs a StreamETL that fetches n of each hashtag from api and writes them in CSV format to
+// file as they arrive. The CSV header is taken from the first record.
+//
+// file: File where CSV formatted records will be written
+// api: twitter api
+// n: number of tweets to fetch per hashtag
+// hashtags: hashtags to query
+func HashtagsToCSVStream(file *os.File, api *twitter.API, n int, hashtags ...string) StreamETL {
+	return StreamETL{
+		Extractor: NewHashtagStreamExtractor(api, n, hashtags...),
+		Loader:    NewCSVStreamLoader(file),
+	}
+}
+
+// ETL is a generic construct for an ETL
 type ETL struct {
 	Extractor Extractor
-	Loader    Loader
+
+	// Transformer is applied to the extracted records before they are loaded. Optional.
+	Transformer Transformer
+
+	Loader Loader
+
+	// LoadPartial loads the records collected before a failed extraction, when the Extractor reports them through an
+	// *ExtractError. The extraction error is still returned.
+	LoadPartial bool
 }
 
 // ETL performs the ETL operation
 func (h ETL) ETL() error {
+	return h.RunContext(context.Background())
+}
 
-	r, err := h.Extractor.Extract()
+// RunContext performs the ETL operation with a context, which is passed to the Extractor and Loader when they
+// implement ContextExtractor and ContextLoader
+func (h ETL) RunContext(ctx context.Context) error {
+
+	r, err := h.extract(ctx)
 
 	if err != nil {
+		return h.loadPartial(err)
+	}
+
+	if r, err = h.transform(r); err != nil {
+		return err
+	}
+
+	return h.load(ctx, r)
+
+}
+
+// loadPartial loads the records carried by an *ExtractError, if enabled, and returns the extraction error. The records
+// are loaded without ctx, since ctx being done is usually why extraction stopped.
+func (h ETL) loadPartial(extractErr error) error {
+
+	var partial *ExtractError
+
+	if !h.LoadPartial || !errors.As(extractErr, &partial) {
+		return extractErr
+	}
+
+	r, err := h.transform(partial.Records)
+
+	if err != nil {
+		return err
+	}
+
+	if err := h.load(context.Background(), r); err != nil {
+		return err
+	}
+
+	return extractErr
+
+}
+
+func (h ETL) extract(ctx context.Context) ([]Record, error) {
+
+	if e, ok := h.Extractor.(ContextExtractor); ok {
+		return e.ExtractContext(ctx)
+	}
+
+	return h.Extractor.Extract()
+
+}
+
+func (h ETL) transform(records []Record) ([]Record, error) {
+
+	if h.Transformer == nil {
+		return records, nil
+	}
+
+	return transformAll(h.Transformer, records)
+
+}
+
+func (h ETL) load(ctx context.Context, records []Record) error {
+
+	if l, ok := h.Loader.(ContextLoader); ok {
+		return l.LoadContext(ctx, records)
+	}
+
+	return h.Loader.Load(records)
+
+}
+
+// DefaultStreamBuffer is the number of records buffered between a StreamExtractor and StreamLoader by default
+const DefaultStreamBuffer = 100
+
+// StreamETL is an ETL that passes each record from the Extractor to the Loader through a bounded channel. When the
+// Loader falls behind, the channel fills up and the Extractor blocks, so memory use stays constant however many
+// records are extracted.
+type StreamETL struct {
+	Extractor StreamExtractor
+
+	// Transformer is applied to each record between the Extractor and Loader. Optional.
+	Transformer Transformer
+
+	Loader StreamLoader
+
+	// Buffer is the capacity of the channel between Extractor and Loader. Defaults to DefaultStreamBuffer.
+	Buffer int
+}
+
+// ETL performs the streaming ETL operation
+func (s StreamETL) ETL() error {
+	return s.RunContext(context.Background())
+}
+
+// RunContext performs the streaming ETL operation with a context. Extraction stops when ctx is done or the Loader
+// fails. Records the Extractor emitted before stopping are still handed to the Loader, and the extraction error is
+// returned once the Loader has finished.
+func (s StreamETL) RunContext(ctx context.Context) error {
+
+	buffer := s.Buffer
+
+	if buffer < 1 {
+		buffer = DefaultStreamBuffer
+	}
+
+	extractCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	extracted := make(chan Record, buffer)
+	extractErr := make(chan error, 1)
+
+	go func() {
+		defer close(extracted)
+		extractErr <- s.Extractor.ExtractStream(extractCtx, extracted)
+	}()
+
+	records := extracted
+	transformErr := make(chan error, 1)
+
+	if s.Transformer == nil {
+		transformErr <- nil
+	} else {
+
+		transformed := make(chan Record, buffer)
+
+		go func() {
+
+			defer close(transformed)
+
+			err := transformStream(s.Transformer, extracted, transformed)
+
+			if err != nil {
+
+				// stop the Extractor and drain so it is never left blocked on a full channel
+				cancel()
+
+				for range extracted {
+				}
+
+			}
+
+			transformErr <- err
+
+		}()
+
+		records = transformed
+
+	}
+
+	loadErr := s.Loader.LoadStream(ctx, records)
+
+	// if the Loader stopped early, stop the Extractor and drain so it is never left blocked on a full channel
+	cancel()
+
+	for range records {
+	}
+
+	if loadErr != nil {
+		return loadErr
+	}
+
+	if err := <-transformErr; err != nil {
 		return err
 	}
 
-	return h.Loader.Load(r)
+	return <-extractErr
 
 }
@@ -1,6 +1,7 @@
 package etl_test
 
 import (
+	"context"
 	"errors"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -51,4 +52,306 @@ var _ = Describe("ETL", func() {
 
 	})
 
+	Describe("Transformer", func() {
+
+		It("Should transform the extracted records before loading them", func() {
+
+			// given
+			var loaded []Record
+
+			e := ETL{
+				Extractor: ExtractorFn(func() ([]Record, error) {
+					return []Record{{"lang": "en"}, {"lang": "fr"}}, nil
+				}),
+				Transformer: Filter(func(r Record) bool {
+					return r["lang"] == "en"
+				}),
+				Loader: LoaderFunc(func(r []Record) error {
+					loaded = r
+					return nil
+				}),
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(loaded).To(Equal([]Record{{"lang": "en"}}))
+
+		})
+
+		It("Should return any error encountered by the Transformer", func() {
+
+			// given
+			transformErr := errors.New("transform error")
+			e := ETL{
+				Extractor: ExtractorFn(func() ([]Record, error) {
+					return []Record{{"lang": "en"}}, nil
+				}),
+				Transformer: TransformerFunc(func(Record) ([]Record, error) {
+					return nil, transformErr
+				}),
+				Loader: NoopLoader,
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(Equal(transformErr))
+
+		})
+
+	})
+
+	Describe("RunContext()", func() {
+
+		It("Should pass ctx to a ContextExtractor and ContextLoader", func() {
+
+			// given
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			e := ETL{
+				Extractor: NewHashtagExtractor(MockTwitterAPI{}, 5, "#IoT"),
+				Loader:    NoopLoader,
+			}
+
+			// when
+			err := e.RunContext(ctx)
+
+			// then
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+
+		})
+
+	})
+
+	Describe("LoadPartial", func() {
+
+		partialErr := &ExtractError{
+			Err:     errors.New("extractor error"),
+			Records: []Record{{"id_str": "12345"}},
+		}
+
+		It("Should load the records carried by an *ExtractError and return the extraction error", func() {
+
+			// given
+			var loaded []Record
+
+			e := ETL{
+				Extractor: ExtractorFn(func() ([]Record, error) {
+					return nil, partialErr
+				}),
+				Loader: LoaderFunc(func(r []Record) error {
+					loaded = r
+					return nil
+				}),
+				LoadPartial: true,
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(Equal(partialErr))
+			Expect(loaded).To(Equal(partialErr.Records))
+
+		})
+
+		It("Should not load anything when disabled", func() {
+
+			// given
+			loaded := false
+
+			e := ETL{
+				Extractor: ExtractorFn(func() ([]Record, error) {
+					return nil, partialErr
+				}),
+				Loader: LoaderFunc(func(r []Record) error {
+					loaded = true
+					return nil
+				}),
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(Equal(partialErr))
+			Expect(loaded).To(BeFalse())
+
+		})
+
+	})
+
+	Describe("StreamETL", func() {
+
+		It("Should pass every extracted record to the Loader", func() {
+
+			// given
+			var loaded []Record
+
+			e := StreamETL{
+				Extractor: StreamExtractorFn(func(ctx context.Context, out chan<- Record) error {
+					for x := 0; x < 10; x++ {
+						out <- Record{"x": x}
+					}
+					return nil
+				}),
+				Loader: StreamLoaderFunc(func(ctx context.Context, in <-chan Record) error {
+					for record := range in {
+						loaded = append(loaded, record)
+					}
+					return nil
+				}),
+				Buffer: 2,
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(loaded).To(HaveLen(10))
+
+		})
+
+		It("Should load the records extracted before an error and then return the error", func() {
+
+			// given
+			extractorErr := errors.New("extractor error")
+			loaded := 0
+
+			e := StreamETL{
+				Extractor: StreamExtractorFn(func(ctx context.Context, out chan<- Record) error {
+					out <- Record{"x": 1}
+					return extractorErr
+				}),
+				Loader: StreamLoaderFunc(func(ctx context.Context, in <-chan Record) error {
+					for range in {
+						loaded++
+					}
+					return nil
+				}),
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(Equal(extractorErr))
+			Expect(loaded).To(Equal(1))
+
+		})
+
+		It("Should stop the Extractor and return the error when the Loader fails", func() {
+
+			// given
+			loaderErr := errors.New("loader error")
+
+			e := StreamETL{
+				Extractor: StreamExtractorFn(func(ctx context.Context, out chan<- Record) error {
+					for {
+						select {
+						case out <- Record{"x": 1}:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					}
+				}),
+				Loader: StreamLoaderFunc(func(ctx context.Context, in <-chan Record) error {
+					<-in
+					return loaderErr
+				}),
+				Buffer: 1,
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(Equal(loaderErr))
+
+		})
+
+	})
+
+	Describe("StreamETL Transformer", func() {
+
+		It("Should transform each record between the Extractor and Loader", func() {
+
+			// given
+			var loaded []Record
+
+			e := StreamETL{
+				Extractor: StreamExtractorFn(func(ctx context.Context, out chan<- Record) error {
+					for x := 0; x < 10; x++ {
+						out <- Record{"x": x}
+					}
+					return nil
+				}),
+				Transformer: Chain(
+					Filter(func(r Record) bool {
+						return r["x"].(int)%2 == 0
+					}),
+					TransformerFunc(func(r Record) ([]Record, error) {
+						return []Record{r, r}, nil
+					}),
+				),
+				Loader: StreamLoaderFunc(func(ctx context.Context, in <-chan Record) error {
+					for record := range in {
+						loaded = append(loaded, record)
+					}
+					return nil
+				}),
+				Buffer: 1,
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(loaded).To(HaveLen(10))
+
+		})
+
+		It("Should stop the Extractor and return the error when the Transformer fails", func() {
+
+			// given
+			transformErr := errors.New("transform error")
+
+			e := StreamETL{
+				Extractor: StreamExtractorFn(func(ctx context.Context, out chan<- Record) error {
+					for {
+						select {
+						case out <- Record{"x": 1}:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					}
+				}),
+				Transformer: TransformerFunc(func(Record) ([]Record, error) {
+					return nil, transformErr
+				}),
+				Loader: StreamLoaderFunc(func(ctx context.Context, in <-chan Record) error {
+					for range in {
+					}
+					return nil
+				}),
+				Buffer: 1,
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(Equal(transformErr))
+
+		})
+
+	})
+
 })
@@ -1,11 +1,14 @@
 package etl
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/tniswong/meshify/pkg/twitter"
-	"math"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -18,6 +21,30 @@ type Extractor interface {
 	Extract() ([]Record, error)
 }
 
+// ContextExtractor is an Extractor that can be cancelled through a context
+type ContextExtractor interface {
+	Extractor
+	ExtractContext(ctx context.Context) ([]Record, error)
+}
+
+// StreamExtractor is an interface for ETL extraction that emits each record as soon as it has been extracted, rather
+// than returning them all at once. An *ExtractError returned by ExtractStream carries no Records, as they have all
+// been sent to out already.
+//
+// The extractors returned by the constructors of this package are both a ContextExtractor and a StreamExtractor, so
+// they can be run by both ETL and StreamETL.
+type StreamExtractor interface {
+	ExtractStream(ctx context.Context, out chan<- Record) error
+}
+
+// StreamExtractorFn is a function impl of StreamExtractor
+type StreamExtractorFn func(ctx context.Context, out chan<- Record) error
+
+// ExtractStream implements StreamExtractor
+func (e StreamExtractorFn) ExtractStream(ctx context.Context, out chan<- Record) error {
+	return e(ctx, out)
+}
+
 // ExtractorFn is a function impl of Extractor
 type ExtractorFn func() ([]Record, error)
 
@@ -36,9 +63,156 @@ type HashtagFetcher interface {
 	FetchHashtag(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error)
 }
 
-type hashtagWorkerResult struct {
-	Records []Record
-	Err     error
+// ContextHashtagFetcher is a HashtagFetcher that can be cancelled through a context
+type ContextHashtagFetcher interface {
+	HashtagFetcher
+	FetchHashtagContext(ctx context.Context, hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error)
+}
+
+// RangeHashtagFetcher is a ContextHashtagFetcher that can restrict its results to a range of tweet ids, with
+// sinceID < id <= maxID
+type RangeHashtagFetcher interface {
+	ContextHashtagFetcher
+	FetchHashtagRange(ctx context.Context, hashtag string, count int, sinceID int64, maxID int64) (twitter.SearchAPIResponse, error)
+}
+
+// SearchFetcher is a HashtagFetcher that can run any twitter.SearchQuery, for tweets with sinceID < id <= maxID
+type SearchFetcher interface {
+	HashtagFetcher
+	FetchSearch(ctx context.Context, query twitter.SearchQuery, count int, sinceID int64, maxID int64) (twitter.SearchAPIResponse, error)
+}
+
+// ResultsFetcher is a HashtagFetcher that can follow the search_metadata next_results of a previous response, rather
+// than have each page requested by max_id
+type ResultsFetcher interface {
+	HashtagFetcher
+	FetchResults(ctx context.Context, results string, count int) (twitter.SearchAPIResponse, error)
+}
+
+// HashtagProgress reports how far the extraction of a single hashtag got
+type HashtagProgress struct {
+	Hashtag   string
+	Collected int
+	Target    int
+	Done      bool
+}
+
+// String implements fmt.Stringer
+func (p HashtagProgress) String() string {
+
+	if p.Done {
+		return fmt.Sprintf("%s: %d/%d done", p.Hashtag, p.Collected, p.Target)
+	}
+
+	return fmt.Sprintf("%s: %d/%d", p.Hashtag, p.Collected, p.Target)
+
+}
+
+// ExtractError wraps the error that stopped an extraction early with how far each hashtag got and the records that
+// had been collected by then. It is only returned once there is something to carry, that is once any records have been
+// collected or the extraction's context is done. An extraction that fails before collecting anything returns its error
+// as it is.
+type ExtractError struct {
+	Err      error
+	Progress []HashtagProgress
+	Records  []Record
+}
+
+// Error implements error
+func (e *ExtractError) Error() string {
+
+	progress := make([]string, len(e.Progress))
+
+	for i, p := range e.Progress {
+		progress[i] = p.String()
+	}
+
+	return fmt.Sprintf("%v (%s)", e.Err, strings.Join(progress, ", "))
+
+}
+
+// Unwrap returns the wrapped error
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// hashtagJob is the work assigned to a single hashtag worker
+type hashtagJob struct {
+	Hashtag string
+
+	// Target is the number of records to extract, including any extracted by a previous run
+	Target int
+
+	// Alloc limits how many records the worker may collect during this run
+	Alloc *allocation
+
+	// Start is where a previous run left off
+	Start Checkpoint
+
+	// SinceID is the newest id extracted by the previous incremental run. Only newer records are extracted.
+	SinceID int64
+}
+
+// workerResult is what a single worker collected for the hashtag or user labelled Label
+type workerResult struct {
+	Label     string
+	Records   []Record
+	Collected int
+	Target    int
+	Done      bool
+	Err       error
+}
+
+// HashtagExtractor is the ContextExtractor and StreamExtractor returned by NewHashtagExtractorWithOptions
+type HashtagExtractor interface {
+	ContextExtractor
+	StreamExtractor
+}
+
+// HashtagExtractorOptions configures an extractor constructed with NewHashtagExtractorWithOptions
+type HashtagExtractorOptions struct {
+	// N is the number of tweets to extract per hashtag
+	N int
+
+	// Hashtags are the hashtags to query
+	Hashtags []string
+
+	// Quotas overrides N for individual hashtags
+	Quotas map[string]int
+
+	// Budget caps the total number of tweets extracted across all hashtags, counting a tweet once for each hashtag
+	// that found it. Each hashtag is granted an equal share of the Budget, up to its quota. Whatever a hashtag does
+	// not use, because its quota is smaller or its results run out, goes to the hashtags that are still being queried.
+	// Zero means no cap.
+	Budget int
+
+	// PerHashtag keeps a separate record for each hashtag a tweet matched, with "hashtag" holding that one hashtag.
+	// By default tweets are merged by id_str into a single record whose "hashtag" lists every hashtag it matched.
+	PerHashtag bool
+
+	// Workers caps how many hashtags are queried at once. Zero queries every hashtag at once.
+	Workers int
+
+	// Ranges splits the search window of each hashtag into this many ranges of tweet ids (see twitter.SplitIDRange),
+	// which are paged through in parallel and stitched back together newest first, exactly as if they had been paged
+	// through in order. Ranges fetch ahead of the one being emitted, so up to Ranges times as many tweets may be
+	// requested as are needed. Ignored unless the api is a RangeHashtagFetcher.
+	Ranges int
+
+	// Checkpoints, if set, saves the progress of each hashtag after every page. Each hashtag resumes from the
+	// Checkpoint it was loaded with, and a hashtag that has already reached its quota or is Exhausted is not queried at
+	// all.
+	Checkpoints CheckpointStore
+
+	// SinceIDs, if set, makes extraction incremental: each hashtag only extracts tweets newer than the id it was
+	// loaded with. Once a hashtag has paged back to that id, or run out of results, the newest id it extracted is
+	// saved for the next run. A hashtag that fails, or reaches its quota first, is not saved, so the next run extracts
+	// its tweets again rather than leave a gap. With Checkpoints, a resumed run carries on down to the id instead.
+	SinceIDs SinceIDStore
+
+	// Query, if set, is the search each hashtag is queried with, in place of twitter.HashtagQuery. Its Hashtags are
+	// replaced by the hashtag being queried. Ignored unless the api is a SearchFetcher.
+	Query *twitter.SearchQuery
 }
 
 // NewHashtagExtractor returns an Extractor that asynchronously queries the twitter api for n tweets belonging to hashtags
@@ -47,48 +221,207 @@ type hashtagWorkerResult struct {
 // n: number of tweets to extract per hashtag
 // hashtags: which hashtags to query
 func NewHashtagExtractor(api HashtagFetcher, n int, hashtags ...string) Extractor {
+	return NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{N: n, Hashtags: hashtags})
+}
+
+// NewHashtagStreamExtractor returns a StreamExtractor that asynchronously queries the twitter api for n tweets
+// belonging to hashtags, emitting each record as soon as its page has been fetched
+//
+// api: twitter api
+// n: number of tweets to extract per hashtag
+// hashtags: which hashtags to query
+func NewHashtagStreamExtractor(api HashtagFetcher, n int, hashtags ...string) StreamExtractor {
+	return NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{N: n, Hashtags: hashtags})
+}
+
+// NewHashtagExtractorWithOptions returns a HashtagExtractor that asynchronously queries the twitter api as configured
+// by opts
+//
+// api: twitter api
+// opts: what to query, and how to merge the results
+func NewHashtagExtractorWithOptions(api HashtagFetcher, opts HashtagExtractorOptions) HashtagExtractor {
 	return hashtagExtractor{
-		api:      api,
-		n:        n,
-		hashtags: hashtags,
+		api:         api,
+		n:           opts.N,
+		hashtags:    opts.Hashtags,
+		quotas:      opts.Quotas,
+		budget:      opts.Budget,
+		perHashtag:  opts.PerHashtag,
+		workers:     opts.Workers,
+		ranges:      opts.Ranges,
+		checkpoints: opts.Checkpoints,
+		sinceIDs:    opts.SinceIDs,
+		query:       opts.Query,
 	}
 }
 
 type hashtagExtractor struct {
-	api      HashtagFetcher
-	hashtags []string
-	n        int
+	api         HashtagFetcher
+	hashtags    []string
+	n           int
+	quotas      map[string]int
+	budget      int
+	perHashtag  bool
+	workers     int
+	ranges      int
+	checkpoints CheckpointStore
+	sinceIDs    SinceIDStore
+	query       *twitter.SearchQuery
 }
 
 // Extract will query the twitter api and convert the tweets to []Record.
 //
-// Each hashtag is queried asynchronously in its own goroutine. Each resulting Record is
+// Hashtags are queried asynchronously by a pool of Workers goroutines. Each resulting Record is
 // hydrated with an extra key: "hashtag", which contains the value of the hashtag that was queried for.
 //
+// Unless PerHashtag is set, a tweet found by several hashtags is merged into a single Record whose "hashtag" is a
+// []string of every hashtag it matched, in the order the hashtags were given.
+//
+// Every worker queries the same HashtagFetcher, so when it is a *twitter.API all workers share its RateLimiter and
+// block together once the rate limit window is used up.
+//
 // The []Record result from each async hashtag query is then merged into a single []Record.
 func (h hashtagExtractor) Extract() ([]Record, error) {
+	return h.ExtractContext(context.Background())
+}
+
+// ExtractContext is Extract with a context.
+//
+// When ctx is done, or any worker fails, every other worker stops after its in-flight request and ctx.Err() or the
+// worker's error is returned, as an *ExtractError carrying how far each hashtag got along with the records collected
+// so far (see ExtractError).
+func (h hashtagExtractor) ExtractContext(ctx context.Context) ([]Record, error) {
+	return h.run(ctx, h.hashtagWorker)
+}
+
+// ExtractStream implements StreamExtractor. It behaves like ExtractContext, except that each record is sent to out as
+// soon as its page has been fetched, blocking while out is full. out is not closed.
+//
+// Since records are sent before every hashtag has been queried, a tweet found by several hashtags can not be merged.
+// Unless PerHashtag is set, only the first Record for each id_str is sent, and its "hashtag" lists only the hashtag
+// that found it first.
+func (h hashtagExtractor) ExtractStream(ctx context.Context, out chan<- Record) error {
+
+	seen := &idSet{ids: map[string]struct{}{}}
+
+	_, err := h.run(ctx, func(ctx context.Context, job hashtagJob) workerResult {
+		return h.streamWorker(ctx, job, seen, out)
+	})
+
+	return err
+
+}
+
+// run queries each hashtag with worker, in a pool of h.workers goroutines, and merges the results. The first failure
+// cancels the remaining workers.
+func (h hashtagExtractor) run(ctx context.Context, worker func(context.Context, hashtagJob) workerResult) ([]Record, error) {
+
+	jobList, err := h.jobs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	records, progress, err := fanOut(ctx, len(jobList), h.workers, func(ctx context.Context, i int) workerResult {
+		return worker(ctx, jobList[i])
+	})
+
+	records = h.dedupe(records)
+
+	if err != nil {
+		return nil, extractError(ctx, err, sortProgress(progress, h.hashtags), records)
+	}
+
+	return records, nil
+
+}
+
+// extractError wraps err in an *ExtractError carrying progress and records, unless nothing had been collected before
+// err stopped the extraction and ctx is not done
+func extractError(ctx context.Context, err error, progress []HashtagProgress, records []Record) error {
+
+	collected := len(records)
+
+	for _, p := range progress {
+		collected += p.Collected
+	}
+
+	if collected < 1 && ctx.Err() == nil {
+		return err
+	}
+
+	return &ExtractError{Err: err, Progress: progress, Records: records}
+
+}
 
-	workerChan := make(chan hashtagWorkerResult, len(h.hashtags))
+// fanOut calls worker with the index of each of n jobs, in a pool of at most workers goroutines, and merges the
+// records and progress of each. Zero workers runs every job at once. The first failure cancels the remaining workers,
+// and is returned, unless ctx is done, in which case ctx.Err() is.
+func fanOut(ctx context.Context, n int, workers int, worker func(context.Context, int) workerResult) ([]Record, []HashtagProgress, error) {
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workerChan := make(chan workerResult, n)
 	wg := &sync.WaitGroup{}
 
-	// for each hashtag, collect the results asynchronously
-	for _, hashtag := range h.hashtags {
+	poolSize := workers
+
+	if poolSize < 1 || poolSize > n {
+		poolSize = n
+	}
+
+	// each job is an index, buffered so that queueing never blocks
+	jobs := make(chan int, n)
+
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+
+	close(jobs)
+
+	// collect the results of each job asynchronously, at most poolSize at a time
+	for x := 0; x < poolSize; x++ {
 
 		wg.Add(1)
-		go h.hashtagWorker(hashtag, wg, workerChan)
+
+		go func() {
+
+			defer wg.Done()
+
+			for i := range jobs {
+				workerChan <- worker(workerCtx, i)
+			}
+
+		}()
 
 	}
 
-	wg.Wait()
-	close(workerChan)
+	go func() {
+		wg.Wait()
+		close(workerChan)
+	}()
 
-	// records holds the records from each worker in a single slice
-	var records []Record
+	var (
+		// records holds the records from each worker in a single slice
+		records  []Record
+		progress []HashtagProgress
+		firstErr error
+	)
 
 	for workerResult := range workerChan {
 
-		if workerResult.Err != nil {
-			return nil, workerResult.Err
+		progress = append(progress, HashtagProgress{
+			Hashtag:   workerResult.Label,
+			Collected: workerResult.Collected,
+			Target:    workerResult.Target,
+			Done:      workerResult.Done,
+		})
+
+		// the first failure stops the remaining workers
+		if workerResult.Err != nil && firstErr == nil {
+			firstErr = workerResult.Err
+			cancel()
 		}
 
 		// merge each slice of records
@@ -96,50 +429,592 @@ func (h hashtagExtractor) Extract() ([]Record, error) {
 
 	}
 
-	return records, nil
+	if ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+
+	return records, progress, firstErr
+
+}
+
+// sortProgress orders progress by labels, the order the hashtags or users were given in
+func sortProgress(progress []HashtagProgress, labels []string) []HashtagProgress {
+
+	sorted := make([]HashtagProgress, 0, len(progress))
+
+	for _, label := range labels {
+		for _, p := range progress {
+			if p.Hashtag == label {
+				sorted = append(sorted, p)
+			}
+		}
+	}
+
+	return sorted
 
 }
 
-func (h hashtagExtractor) hashtagWorker(hashtag string, wg *sync.WaitGroup, out chan<- hashtagWorkerResult) {
+// jobs creates a hashtagJob for each hashtag, resuming from h.checkpoints if set
+func (h hashtagExtractor) jobs() ([]hashtagJob, error) {
+
+	checkpoints := map[string]Checkpoint{}
+
+	if h.checkpoints != nil {
+
+		var err error
+
+		if checkpoints, err = h.checkpoints.Load(); err != nil {
+			return nil, err
+		}
+
+	}
+
+	sinceIDs := map[string]int64{}
+
+	if h.sinceIDs != nil {
+
+		var err error
+
+		if sinceIDs, err = h.sinceIDs.LoadSinceIDs(); err != nil {
+			return nil, err
+		}
 
-	defer wg.Done()
+	}
 
 	var (
-		maxID      int64
-		allRecords []Record
+		jobs   = make([]hashtagJob, len(h.hashtags))
+		quotas = make([]int, len(h.hashtags))
+		budget = h.budget
 	)
 
-	for len(allRecords) <= h.n {
+	for i, hashtag := range h.hashtags {
 
-		resp, err := h.api.FetchHashtag(hashtag, h.n, maxID)
+		start := checkpoints[hashtag]
 
-		if err != nil {
-			out <- hashtagWorkerResult{Err: err}
-			return
+		jobs[i] = hashtagJob{Hashtag: hashtag, Target: h.quota(hashtag), Start: start, SinceID: sinceIDs[hashtag]}
+		budget -= start.Collected
+
+		if !start.Exhausted && start.Collected < jobs[i].Target {
+			quotas[i] = jobs[i].Target - start.Collected
+		}
+
+	}
+
+	// a previous run used up the whole budget
+	if h.budget > 0 && budget < 1 {
+		quotas = make([]int, len(h.hashtags))
+	}
+
+	for i, alloc := range allocate(quotas, budget) {
+		jobs[i].Alloc = alloc
+	}
+
+	return jobs, nil
+
+}
+
+// quota returns the number of tweets to extract for hashtag
+func (h hashtagExtractor) quota(hashtag string) int {
+
+	if quota, ok := h.quotas[hashtag]; ok {
+		return quota
+	}
+
+	return h.n
+
+}
+
+func (h hashtagExtractor) hashtagWorker(ctx context.Context, job hashtagJob) workerResult {
+
+	var allRecords []Record
+
+	collected, err := h.collect(ctx, job, func(record Record) error {
+		allRecords = append(allRecords, record)
+		return nil
+	})
+
+	return workerResult{
+		Label:     job.Hashtag,
+		Records:   allRecords,
+		Collected: job.Start.Collected + collected,
+		Target:    job.Target,
+		Done:      err == nil,
+		Err:       err,
+	}
+
+}
+
+func (h hashtagExtractor) streamWorker(ctx context.Context, job hashtagJob, seen *idSet, out chan<- Record) workerResult {
+
+	collected, err := h.collect(ctx, job, func(record Record) error {
+
+		if !h.perHashtag && !seen.add(record["id_str"]) {
+			return nil
+		}
+
+		select {
+		case out <- record:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 
-		// turn the twitter.SearchAPIResponse into []Records
-		records, minID, err := processResponse(resp, hashtag)
+	})
+
+	return workerResult{
+		Label:     job.Hashtag,
+		Collected: job.Start.Collected + collected,
+		Target:    job.Target,
+		Done:      err == nil,
+		Err:       err,
+	}
+
+}
+
+// collect pages through the tweets for job.Hashtag, starting from job.Start, and passes each record to emit until
+// job.Alloc is used up or there are no more results. Each request asks for exactly the number of records still
+// allowed. Returns the number of records emitted.
+func (h hashtagExtractor) collect(ctx context.Context, job hashtagJob, emit func(Record) error) (int, error) {
+
+	var (
+		collected int
+		err       error
+		newestID  = job.Start.NewestID
+		exhausted = job.Start.Exhausted
+	)
+
+	// records are emitted newest first
+	track := func(record Record) error {
+
+		if newestID == 0 {
+			newestID, _ = getRecordID(record)
+		}
+
+		return emit(record)
+
+	}
+
+	save := func(maxID int64, collected int, last bool) error {
+
+		exhausted = last
+
+		if h.checkpoints == nil {
+			return nil
+		}
+
+		return h.checkpoints.Save(job.Hashtag, Checkpoint{
+			MaxID:     maxID,
+			NewestID:  newestID,
+			Collected: job.Start.Collected + collected,
+			Exhausted: exhausted,
+		})
+
+	}
+
+	if _, ok := h.api.(RangeHashtagFetcher); ok && h.ranges > 1 {
+		collected, err = h.collectRanges(ctx, job, h.idRanges(job.SinceID, job.Start.MaxID), track, save)
+	} else {
+		collected, err = h.collectSequential(ctx, job, track, save)
+	}
+
+	// hand whatever was not collected back to the hashtags still running
+	job.Alloc.release(collected)
+
+	// a run stopped short of job.SinceID by its quota would leave the tweets in between behind, if it moved on
+	if err == nil && exhausted && h.sinceIDs != nil && newestID > job.SinceID {
+		err = h.sinceIDs.SaveSinceID(job.Hashtag, newestID)
+	}
+
+	return collected, err
+
+}
+
+// idRanges splits the search window, between sinceID and maxID if set, into h.ranges ranges
+func (h hashtagExtractor) idRanges(sinceID int64, maxID int64) []twitter.IDRange {
+
+	from := time.Now().Add(-twitter.SearchWindow)
+	to := time.Now()
+
+	if sinceID > 0 && twitter.SnowflakeTime(sinceID).After(from) {
+		from = twitter.SnowflakeTime(sinceID)
+	}
+
+	if maxID > 0 {
+		to = twitter.SnowflakeTime(maxID)
+	}
+
+	if !to.After(from) {
+		return []twitter.IDRange{{SinceID: sinceID, MaxID: maxID}}
+	}
+
+	ranges := twitter.SplitIDRange(from, to, h.ranges)
+	ranges[0].MaxID = maxID
+	ranges[len(ranges)-1].SinceID = sinceID
+
+	return ranges
+
+}
+
+// collectSequential pages through the tweets for job.Hashtag one page at a time, newest first, calling save after
+// each page
+func (h hashtagExtractor) collectSequential(ctx context.Context, job hashtagJob, emit func(Record) error, save func(maxID int64, collected int, exhausted bool) error) (int, error) {
+
+	var (
+		at        = cursor{maxID: job.Start.MaxID}
+		collected int
+		alloc     = job.Alloc
+	)
+
+	for remaining := alloc.remaining(collected); remaining > 0; remaining = alloc.remaining(collected) {
+
+		if ctx.Err() != nil {
+			return collected, ctx.Err()
+		}
+
+		records, next, err := h.page(ctx, job.Hashtag, remaining, job.SinceID, at)
 
 		if err != nil {
-			out <- hashtagWorkerResult{Err: err}
-			return
+			return collected, err
 		}
 
-		// no records to append, break the loop
+		// no records to emit, there are no more results
 		if len(records) < 1 {
+			return collected, save(at.maxID, collected, true)
+		}
+
+		for _, record := range records {
+
+			if err := emit(record); err != nil {
+				return collected, err
+			}
+
+			collected++
+
+		}
+
+		at = next
+
+		if err := save(at.maxID, collected, at.last); err != nil || at.last {
+			return collected, err
+		}
+
+	}
+
+	return collected, nil
+
+}
+
+// rangePage is a page of records fetched from the id range at index, or the end of that range
+type rangePage struct {
+	index   int
+	records []Record
+	done    bool
+	err     error
+}
+
+// collectRanges pages through each of ranges in its own goroutine. ranges must be contiguous and newest first. Records
+// are emitted in range order, so each range is buffered until every range before it has run out of results. Once alloc
+// is used up the remaining ranges are stopped, and an error from a range that was never reached is ignored. save is
+// called whenever every record fetched so far has been emitted.
+func (h hashtagExtractor) collectRanges(ctx context.Context, job hashtagJob, ranges []twitter.IDRange, emit func(Record) error, save func(maxID int64, collected int, exhausted bool) error) (int, error) {
+
+	rangeCtx, cancel := context.WithCancel(ctx)
+	pages := make(chan rangePage)
+	wg := &sync.WaitGroup{}
+
+	for i, r := range ranges {
+
+		wg.Add(1)
+
+		go func(index int, r twitter.IDRange) {
+			defer wg.Done()
+			h.collectRange(rangeCtx, job.Hashtag, job.Alloc.quota, index, r, pages)
+		}(i, r)
+
+	}
+
+	// stop any range still running, and wait for it to return
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var (
+		buffered  = make([][]Record, len(ranges))
+		ended     = make([]*rangePage, len(ranges))
+		head      int
+		collected int
+		maxID     = job.Start.MaxID
+		alloc     = job.Alloc
+	)
+
+	for remaining := alloc.remaining(collected); remaining > 0 && head < len(ranges); remaining = alloc.remaining(collected) {
+
+		// emit the next record of the newest range that still has results
+		if len(buffered[head]) > 0 {
+
+			record := buffered[head][0]
+			buffered[head] = buffered[head][1:]
+
+			if err := emit(record); err != nil {
+				return collected, err
+			}
+
+			collected++
+
+			id, _ := getRecordID(record)
+			maxID = id - 1
+
+			// checkpoint once everything fetched so far has been emitted
+			if len(buffered[head]) < 1 {
+				if err := save(maxID, collected, false); err != nil {
+					return collected, err
+				}
+			}
+
+			continue
+
+		}
+
+		if ended[head] != nil {
+
+			if ended[head].err != nil {
+				return collected, ended[head].err
+			}
+
+			head++
+			continue
+
+		}
+
+		select {
+		case page := <-pages:
+
+			buffered[page.index] = append(buffered[page.index], page.records...)
+
+			if page.done {
+				ended[page.index] = &page
+			}
+
+		case <-ctx.Done():
+			return collected, ctx.Err()
+		}
+
+	}
+
+	return collected, save(maxID, collected, head == len(ranges))
+
+}
+
+// collectRange pages through the tweets for hashtag within r, newest first, sending each page to pages until limit
+// records have been fetched or there are no more results. The final page sent has done set, along with any error.
+func (h hashtagExtractor) collectRange(ctx context.Context, hashtag string, limit int, index int, r twitter.IDRange, pages chan<- rangePage) {
+
+	var (
+		at      = cursor{maxID: r.MaxID}
+		fetched int
+		err     error
+	)
+
+	for fetched < limit && !at.last {
+
+		var records []Record
+
+		if records, at, err = h.page(ctx, hashtag, limit-fetched, r.SinceID, at); err != nil || len(records) < 1 {
 			break
 		}
 
-		maxID = minID - 1
-		allRecords = append(allRecords, records...)
+		select {
+		case pages <- rangePage{index: index, records: records}:
+		case <-ctx.Done():
+			return
+		}
+
+		fetched += len(records)
+
+	}
+
+	select {
+	case pages <- rangePage{index: index, done: true, err: err}:
+	case <-ctx.Done():
+	}
+
+}
+
+// cursor is the position of a page of results
+type cursor struct {
+	// maxID is the max_id of the page
+	maxID int64
+
+	// next is the next_results of the page before, followed in place of maxID when the api is a ResultsFetcher
+	next string
+
+	// last is set when the page before reported that no more results follow it
+	last bool
+}
+
+// page fetches up to count records for hashtag with id > sinceID, starting at at, and returns the cursor of the page
+// after it
+func (h hashtagExtractor) page(ctx context.Context, hashtag string, count int, sinceID int64, at cursor) ([]Record, cursor, error) {
+
+	resp, err := h.fetch(ctx, hashtag, count, sinceID, at)
+
+	if err != nil {
+		return nil, cursor{}, err
+	}
+
+	// cap at count, so the next page starts right after the last record returned
+	truncated := len(resp.Statuses) > count
+
+	if truncated {
+		resp.Statuses = resp.Statuses[:count]
+	}
+
+	// turn the twitter.SearchAPIResponse into []Records
+	records, minID, err := processResponse(resp, hashtag)
+
+	if err != nil {
+		return nil, cursor{}, err
+	}
+
+	next := cursor{maxID: minID - 1}
+
+	// next_results would skip whatever was truncated. search_metadata is absent when count is zero, in which case
+	// nothing is known about the next page.
+	if !truncated {
+		next.next = resp.SearchMetadata.NextResults
+		next.last = resp.SearchMetadata.Count > 0 && resp.SearchMetadata.NextResults == ""
+	}
+
+	// drop anything at or below sinceID, in case the api could not exclude it
+	if sinceID > 0 {
+
+		newer := records[:0]
+
+		for _, record := range records {
+			if id, _ := getRecordID(record); id > sinceID {
+				newer = append(newer, record)
+			}
+		}
+
+		records = newer
+
+	}
 
+	if !h.perHashtag {
+		for _, record := range records {
+			record["hashtag"] = []string{hashtag}
+		}
 	}
 
-	// cap at h.n or len(allRecords) to prevent index out of bounds
-	lastIndex := int(math.Min(float64(h.n), float64(len(allRecords))))
+	return records, next, nil
+
+}
+
+// dedupe merges records with the same id_str into the first of them, unless h.perHashtag is set
+func (h hashtagExtractor) dedupe(records []Record) []Record {
+
+	if h.perHashtag {
+		return records
+	}
+
+	var (
+		unique []Record
+		index  = map[interface{}]int{}
+	)
+
+	for _, record := range records {
+
+		i, ok := index[record["id_str"]]
+
+		if !ok {
+			index[record["id_str"]] = len(unique)
+			unique = append(unique, record)
+			continue
+		}
+
+		unique[i]["hashtag"] = h.mergeHashtags(unique[i]["hashtag"], record["hashtag"])
+
+	}
+
+	return unique
+
+}
+
+// mergeHashtags combines two "hashtag" values, ordered as h.hashtags
+func (h hashtagExtractor) mergeHashtags(a interface{}, b interface{}) []string {
+
+	matched := map[string]struct{}{}
+
+	for _, v := range []interface{}{a, b} {
+		if hashtags, ok := v.([]string); ok {
+			for _, hashtag := range hashtags {
+				matched[hashtag] = struct{}{}
+			}
+		}
+	}
+
+	var merged []string
+
+	for _, hashtag := range h.hashtags {
+		if _, ok := matched[hashtag]; ok {
+			merged = append(merged, hashtag)
+		}
+	}
+
+	return merged
+
+}
+
+// idSet is a set of record ids that is safe for concurrent use
+type idSet struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+// add adds id to the set, returning false if it was already present
+func (s *idSet) add(id interface{}) bool {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := fmt.Sprint(id)
+
+	if _, ok := s.ids[key]; ok {
+		return false
+	}
+
+	s.ids[key] = struct{}{}
+
+	return true
+
+}
+
+// fetch queries the api for the page at, passing ctx along if it supports cancellation. sinceID is ignored unless the
+// api is a SearchFetcher or RangeHashtagFetcher, so the results may include older tweets.
+func (h hashtagExtractor) fetch(ctx context.Context, hashtag string, count int, sinceID int64, at cursor) (twitter.SearchAPIResponse, error) {
+
+	if api, ok := h.api.(ResultsFetcher); ok && at.next != "" {
+		return api.FetchResults(ctx, at.next, count)
+	}
+
+	maxID := at.maxID
+
+	if api, ok := h.api.(SearchFetcher); ok && h.query != nil {
+		query := *h.query
+		query.Hashtags = []string{hashtag}
+		return api.FetchSearch(ctx, query, count, sinceID, maxID)
+	}
+
+	if api, ok := h.api.(RangeHashtagFetcher); ok {
+		return api.FetchHashtagRange(ctx, hashtag, count, sinceID, maxID)
+	}
+
+	if api, ok := h.api.(ContextHashtagFetcher); ok {
+		return api.FetchHashtagContext(ctx, hashtag, count, maxID)
+	}
 
-	out <- hashtagWorkerResult{Records: allRecords[:lastIndex]}
+	return h.api.FetchHashtag(hashtag, count, maxID)
 
 }
 
@@ -1,13 +1,123 @@
 package etl_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	. "github.com/tniswong/meshify/pkg/etl"
 	"github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
 )
 
+// timelineAPI serves a fixed timeline of tweet ids, newest first, to every hashtag. It honours since_id and max_id,
+// and records the most requests that were ever in flight at once.
+type timelineAPI struct {
+	ids   []int64
+	delay time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	requests    int
+}
+
+func (t *timelineAPI) FetchHashtag(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+	return t.FetchHashtagRange(context.Background(), hashtag, count, 0, maxID)
+}
+
+func (t *timelineAPI) FetchHashtagContext(ctx context.Context, hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+	return t.FetchHashtagRange(ctx, hashtag, count, 0, maxID)
+}
+
+func (t *timelineAPI) FetchHashtagRange(ctx context.Context, hashtag string, count int, sinceID int64, maxID int64) (twitter.SearchAPIResponse, error) {
+
+	t.mu.Lock()
+	t.requests++
+	t.inFlight++
+	if t.inFlight > t.maxInFlight {
+		t.maxInFlight = t.inFlight
+	}
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.inFlight--
+		t.mu.Unlock()
+	}()
+
+	time.Sleep(t.delay)
+
+	resp := twitter.SearchAPIResponse{}
+
+	for _, id := range t.ids {
+
+		if len(resp.Statuses) == count || len(resp.Statuses) == twitter.MaxPerRequest {
+			break
+		}
+
+		if (maxID == 0 || id <= maxID) && id > sinceID {
+			resp.Statuses = append(resp.Statuses, map[string]interface{}{"id_str": fmt.Sprint(id)})
+		}
+
+	}
+
+	return resp, nil
+
+}
+
+// newTimelineAPI returns a timelineAPI with n tweets, one every interval, the newest created an hour ago
+func newTimelineAPI(n int, interval time.Duration) *timelineAPI {
+
+	api := &timelineAPI{}
+	newest := time.Now().Add(-time.Hour)
+
+	for x := 0; x < n; x++ {
+		api.ids = append(api.ids, twitter.SnowflakeID(newest.Add(-time.Duration(x)*interval))+int64(x%7))
+	}
+
+	return api
+
+}
+
+// resultsAPI is a MockTwitterAPI that can follow next_results
+type resultsAPI struct {
+	MockTwitterAPI
+	FetchResultsFn func(results string, count int) (twitter.SearchAPIResponse, error)
+}
+
+func (r *resultsAPI) FetchResults(ctx context.Context, results string, count int) (twitter.SearchAPIResponse, error) {
+	return r.FetchResultsFn(results, count)
+}
+
+// searchAPI is a MockTwitterAPI that can run a twitter.SearchQuery
+type searchAPI struct {
+	MockTwitterAPI
+	FetchSearchFn func(query twitter.SearchQuery, count int, sinceID int64, maxID int64) (twitter.SearchAPIResponse, error)
+}
+
+func (s *searchAPI) FetchSearch(ctx context.Context, query twitter.SearchQuery, count int, sinceID int64, maxID int64) (twitter.SearchAPIResponse, error) {
+	return s.FetchSearchFn(query, count, sinceID, maxID)
+}
+
+func recordIDs(records []Record) []string {
+
+	ids := make([]string, len(records))
+
+	for i, record := range records {
+		ids[i] = record["id_str"].(string)
+	}
+
+	return ids
+
+}
+
 var _ = Describe("Extract", func() {
 
 	Describe("HashtagExtractor.Extract()", func() {
@@ -183,4 +293,519 @@ var _ = Describe("Extract", func() {
 
 	})
 
+	Describe("HashtagExtractor.ExtractContext()", func() {
+
+		It("Should stop when ctx is cancelled and report how far each hashtag got", func() {
+
+			// given
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			calls := 0
+			api := MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					calls++
+
+					if calls == 3 {
+						cancel()
+					}
+
+					statuses := []map[string]interface{}{
+						{"id_str": fmt.Sprint(1000 - calls), "text": "Tweet, Tweet! #IoT"},
+					}
+
+					return twitter.SearchAPIResponse{Statuses: statuses}, nil
+
+				},
+			}
+
+			hashtagExtractor := NewHashtagExtractor(api, 5, "#IoT").(ContextExtractor)
+
+			// when
+			_, err := hashtagExtractor.ExtractContext(ctx)
+
+			// then
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+
+			extractErr, ok := err.(*ExtractError)
+
+			Expect(ok).To(BeTrue())
+			Expect(extractErr.Progress).To(Equal([]HashtagProgress{
+				{Hashtag: "#IoT", Collected: 3, Target: 5},
+			}))
+			Expect(extractErr.Error()).To(Equal("context canceled (#IoT: 3/5)"))
+
+		})
+
+	})
+
+	Describe("HashtagExtractor.ExtractContext() partial results", func() {
+
+		It("Should stop the other workers when one fails and return the records collected so far", func() {
+
+			// given
+			helpErr := errors.New("help error")
+
+			var (
+				mu        sync.Mutex
+				iotCalls  int
+				helpCalls int
+			)
+
+			api := MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					mu.Lock()
+					defer mu.Unlock()
+
+					switch hashtag {
+					case "#Help":
+
+						helpCalls++
+
+						if helpCalls > 1 {
+							return twitter.SearchAPIResponse{}, helpErr
+						}
+
+						return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{
+							{"id_str": "5000", "text": "#Help"},
+						}}, nil
+
+					default:
+
+						iotCalls++
+
+						return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{
+							{"id_str": fmt.Sprint(1000000 - iotCalls), "text": "#IoT"},
+						}}, nil
+
+					}
+
+				},
+			}
+
+			hashtagExtractor := NewHashtagExtractor(api, 1000000, "#IoT", "#Help").(ContextExtractor)
+
+			// when
+			_, err := hashtagExtractor.ExtractContext(context.Background())
+
+			// then
+			Expect(errors.Is(err, helpErr)).To(BeTrue())
+
+			extractErr := err.(*ExtractError)
+
+			Expect(extractErr.Progress).To(HaveLen(2))
+			Expect(extractErr.Progress[0].Hashtag).To(Equal("#IoT"))
+			Expect(extractErr.Progress[0].Done).To(BeFalse())
+			Expect(extractErr.Progress[1]).To(Equal(HashtagProgress{Hashtag: "#Help", Collected: 1, Target: 1000000}))
+			Expect(extractErr.Records).To(HaveLen(extractErr.Progress[0].Collected + 1))
+
+		})
+
+	})
+
+	Describe("HashtagExtractor.ExtractStream()", func() {
+
+		It("Should send a max of n records per hashtag to out", func() {
+
+			// given
+			calls := 0
+			api := MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					calls++
+
+					return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{
+						{"id_str": fmt.Sprint(1000 - 2*calls), "text": "Tweet, Tweet! #IoT"},
+						{"id_str": fmt.Sprint(1000 - 2*calls - 1), "text": "Tweet, Tweet! #IoT"},
+					}}, nil
+
+				},
+			}
+
+			n := 5
+			out := make(chan Record, 10)
+			hashtagExtractor := NewHashtagStreamExtractor(api, n, "#IoT")
+
+			// when
+			err := hashtagExtractor.ExtractStream(context.Background(), out)
+			close(out)
+
+			// then
+			Expect(err).To(BeNil())
+
+			var records []Record
+			for record := range out {
+				records = append(records, record)
+			}
+
+			Expect(records).To(HaveLen(n))
+
+		})
+
+		It("Should block while out is full and stop when ctx is cancelled", func() {
+
+			// given
+			calls := 0
+			api := MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					calls++
+
+					return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{
+						{"id_str": fmt.Sprint(1000 - calls), "text": "Tweet, Tweet! #IoT"},
+					}}, nil
+
+				},
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			out := make(chan Record)
+			hashtagExtractor := NewHashtagStreamExtractor(api, 100, "#IoT")
+
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- hashtagExtractor.ExtractStream(ctx, out)
+			}()
+
+			// when
+			<-out
+			<-out
+			cancel()
+
+			// then
+			err := <-errChan
+
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(err.(*ExtractError).Progress[0].Collected).To(Equal(2))
+			Expect(calls).To(BeNumerically("<=", 3))
+
+		})
+
+	})
+
+	Describe("HashtagExtractor deduplication", func() {
+
+		sharedAPI := func() MockTwitterAPI {
+
+			served := map[string]bool{}
+			mu := sync.Mutex{}
+
+			return MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					mu.Lock()
+					defer mu.Unlock()
+
+					if served[hashtag] {
+						return twitter.SearchAPIResponse{}, nil
+					}
+
+					served[hashtag] = true
+
+					switch hashtag {
+					case "#IoT":
+						return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{
+							{"id_str": "300", "text": "#IoT #Help"},
+							{"id_str": "200", "text": "#IoT"},
+						}}, nil
+					default:
+						return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{
+							{"id_str": "300", "text": "#IoT #Help"},
+							{"id_str": "100", "text": "#Help"},
+						}}, nil
+					}
+
+				},
+			}
+
+		}
+
+		It("Should merge tweets found by several hashtags, listing every matched hashtag", func() {
+
+			// given
+			hashtagExtractor := NewHashtagExtractor(sharedAPI(), 5, "#IoT", "#Help")
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(3))
+
+			hashtagsByID := map[string]interface{}{}
+			for _, record := range records {
+				hashtagsByID[record["id_str"].(string)] = record["hashtag"]
+			}
+
+			Expect(hashtagsByID).To(Equal(map[string]interface{}{
+				"300": []string{"#IoT", "#Help"},
+				"200": []string{"#IoT"},
+				"100": []string{"#Help"},
+			}))
+
+		})
+
+		It("Should keep a record per hashtag when PerHashtag is set", func() {
+
+			// given
+			hashtagExtractor := NewHashtagExtractorWithOptions(sharedAPI(), HashtagExtractorOptions{
+				N:          5,
+				Hashtags:   []string{"#IoT", "#Help"},
+				PerHashtag: true,
+			})
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(4))
+
+			for _, record := range records {
+				Expect(record["hashtag"]).To(BeAssignableToTypeOf(""))
+			}
+
+		})
+
+		It("Should only stream the first record for each id_str", func() {
+
+			// given
+			out := make(chan Record, 10)
+			hashtagExtractor := NewHashtagStreamExtractor(sharedAPI(), 5, "#IoT", "#Help")
+
+			// when
+			err := hashtagExtractor.ExtractStream(context.Background(), out)
+			close(out)
+
+			// then
+			Expect(err).To(BeNil())
+
+			ids := map[string]int{}
+			for record := range out {
+				ids[record["id_str"].(string)]++
+			}
+
+			Expect(ids).To(Equal(map[string]int{"300": 1, "200": 1, "100": 1}))
+
+		})
+
+	})
+
+	Describe("HashtagExtractorOptions.Workers", func() {
+
+		It("Should query at most Workers hashtags at once", func() {
+
+			// given
+			api := &timelineAPI{ids: []int64{3, 2, 1}, delay: 10 * time.Millisecond}
+			hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:          3,
+				Hashtags:   []string{"#a", "#b", "#c", "#d", "#e", "#f"},
+				PerHashtag: true,
+				Workers:    2,
+			})
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(18))
+			Expect(api.maxInFlight).To(BeNumerically("<=", 2))
+
+		})
+
+	})
+
+	Describe("HashtagExtractorOptions.Ranges", func() {
+
+		It("Should page through ranges in parallel and return the same records as paging in order", func() {
+
+			// given
+			sequentialAPI := newTimelineAPI(1000, 10*time.Minute)
+			rangesAPI := &timelineAPI{ids: sequentialAPI.ids, delay: 5 * time.Millisecond}
+
+			sequential := NewHashtagExtractor(sequentialAPI, 450, "#IoT")
+			ranges := NewHashtagExtractorWithOptions(rangesAPI, HashtagExtractorOptions{
+				N:        450,
+				Hashtags: []string{"#IoT"},
+				Ranges:   4,
+			})
+
+			// when
+			expected, err := sequential.Extract()
+			Expect(err).To(BeNil())
+
+			records, err := ranges.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(recordIDs(records)).To(Equal(recordIDs(expected)))
+			Expect(rangesAPI.maxInFlight).To(BeNumerically(">", 1))
+
+		})
+
+		It("Should stitch every range together when the quota exceeds the results", func() {
+
+			// given
+			api := newTimelineAPI(500, 15*time.Minute)
+			hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:        2000,
+				Hashtags: []string{"#IoT"},
+				Ranges:   3,
+			})
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(500))
+
+			for i, id := range recordIDs(records) {
+				Expect(id).To(Equal(fmt.Sprint(api.ids[i])))
+			}
+
+		})
+
+	})
+
+	Describe("HashtagExtractor next_results", func() {
+
+		It("Should follow next_results and stop when a page has none", func() {
+
+			// given
+			var followed []string
+
+			page := func(next string, ids ...string) twitter.SearchAPIResponse {
+
+				resp := twitter.SearchAPIResponse{SearchMetadata: twitter.SearchMetadata{Count: 2, NextResults: next}}
+
+				for _, id := range ids {
+					resp.Statuses = append(resp.Statuses, map[string]interface{}{"id_str": id})
+				}
+
+				return resp
+
+			}
+
+			api := &resultsAPI{
+				MockTwitterAPI: MockTwitterAPI{
+					FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+						return page("?max_id=12343&q=%23IoT", "12345", "12344"), nil
+					},
+				},
+				FetchResultsFn: func(results string, count int) (twitter.SearchAPIResponse, error) {
+
+					followed = append(followed, fmt.Sprintf("%s %d", results, count))
+
+					if results == "?max_id=12343&q=%23IoT" {
+						return page("?max_id=12341&q=%23IoT", "12343", "12342"), nil
+					}
+
+					return page("", "12341"), nil
+
+				},
+			}
+
+			hashtagExtractor := NewHashtagExtractor(api, 10, "#IoT")
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(recordIDs(records)).To(Equal([]string{"12345", "12344", "12343", "12342", "12341"}))
+			Expect(followed).To(Equal([]string{"?max_id=12343&q=%23IoT 8", "?max_id=12341&q=%23IoT 6"}))
+
+		})
+
+	})
+
+	Describe("HashtagExtractorOptions.Query", func() {
+
+		It("Should query each hashtag with the Query", func() {
+
+			// given
+			mu := sync.Mutex{}
+			var queries []string
+
+			api := &searchAPI{
+				FetchSearchFn: func(query twitter.SearchQuery, count int, sinceID int64, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					mu.Lock()
+					defer mu.Unlock()
+
+					queries = append(queries, query.Q())
+
+					return twitter.SearchAPIResponse{}, nil
+
+				},
+			}
+
+			hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:        5,
+				Hashtags: []string{"#IoT", "#Help"},
+				Query:    &twitter.SearchQuery{Hashtags: []string{"#ignored"}, ExcludeRetweets: true},
+			})
+
+			// when
+			_, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(queries).To(ConsistOf("#IoT -filter:retweets", "#Help -filter:retweets"))
+
+		})
+
+	})
+
+	Describe("HashtagExtractor with twitter.V2API", func() {
+
+		It("Should page through the recent search by next_token and load the joined tweets as CSV", func() {
+
+			// given
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				data := `{"id": "%d", "text": "#IoT %d", "author_id": "1"}`
+				page, next := []int64{30, 29, 28}, `"next_token": "p2"`
+
+				if r.URL.Query().Get("next_token") == "p2" {
+					page, next = []int64{27, 26}, `"result_count": 2`
+				}
+
+				var tweets []string
+
+				for _, id := range page {
+					tweets = append(tweets, fmt.Sprintf(data, id, id))
+				}
+
+				fmt.Fprintf(w, `{"data": [%s], "includes": {"users": [{"id": "1", "username": "meshify"}]}, "meta": {%s}}`, strings.Join(tweets, ","), next)
+
+			}))
+			defer server.Close()
+
+			api := twitter.NewAPIWithOptions("key", "secret", twitter.Options{BaseURL: server.URL})
+			api.SetBearerToken("bearerToken")
+
+			out := &bytes.Buffer{}
+
+			e := ETL{
+				Extractor: NewHashtagExtractor(twitter.NewV2API(api, twitter.V2Options{}), 10, "#IoT"),
+				Loader:    NewCSVLoader(out, "id_str", "text", "author.username"),
+			}
+
+			// when
+			err := e.ETL()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(out.String()).To(Equal("id_str,text,author.username\n" +
+				"30,#IoT 30,meshify\n29,#IoT 29,meshify\n28,#IoT 28,meshify\n27,#IoT 27,meshify\n26,#IoT 26,meshify\n"))
+
+		})
+
+	})
+
 })
@@ -0,0 +1,215 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"time"
+)
+
+// filterStreamProgress labels the progress of a filtered stream extraction in an *ExtractError
+const filterStreamProgress = "filtered stream"
+
+// errStreamTargetReached ends the stream once enough tweets have been extracted
+var errStreamTargetReached = errors.New("target reached")
+
+// StreamFilterer is an interface abstraction of the filtered stream of twitter.API
+type StreamFilterer interface {
+	FilterStream(ctx context.Context, opts twitter.StreamOptions, fn func(twitter.StreamMessage) error) error
+}
+
+// StreamRuleSetter is a StreamFilterer that can replace the rules of the stream
+type StreamRuleSetter interface {
+	StreamFilterer
+	SetStreamRules(ctx context.Context, rules ...twitter.StreamRule) ([]twitter.StreamRule, error)
+}
+
+// FilterStreamExtractor is the ContextExtractor and StreamExtractor returned by NewFilterStreamExtractor
+type FilterStreamExtractor interface {
+	ContextExtractor
+	StreamExtractor
+}
+
+// FilterStreamExtractorOptions configures an extractor constructed with NewFilterStreamExtractor
+type FilterStreamExtractorOptions struct {
+	// N is the number of unique tweets to extract. Zero means no limit.
+	N int
+
+	// Duration is how long to extract for. Zero means no limit.
+	Duration time.Duration
+
+	// Rules, if set, replace the rules of the stream before it is connected to. Rules that did not change are kept.
+	// Ignored unless the api is a StreamRuleSetter.
+	Rules []twitter.StreamRule
+
+	// Stream configures the fields requested and how dropped connections are reconnected
+	Stream twitter.StreamOptions
+}
+
+// NewFilterStreamExtractor returns a FilterStreamExtractor that collects tweets from the filtered stream as they are
+// posted, until N unique tweets have been extracted or Duration has passed, whichever comes first
+//
+// api: twitter api
+// opts: when to stop, and the rules of the stream
+func NewFilterStreamExtractor(api StreamFilterer, opts FilterStreamExtractorOptions) FilterStreamExtractor {
+	return filterStreamExtractor{
+		api:      api,
+		n:        opts.N,
+		duration: opts.Duration,
+		rules:    opts.Rules,
+		stream:   opts.Stream,
+	}
+}
+
+type filterStreamExtractor struct {
+	api      StreamFilterer
+	n        int
+	duration time.Duration
+	rules    []twitter.StreamRule
+	stream   twitter.StreamOptions
+}
+
+// Extract will collect tweets from the filtered stream and convert them to []Record.
+//
+// Each Record holds the tweet's data, along with "id_str", a copy of its id, and "matching_rules", a []string of the
+// tag, or id if untagged, of each rule it matched. Tweets delivered again after a reconnect are dropped.
+func (f filterStreamExtractor) Extract() ([]Record, error) {
+	return f.ExtractContext(context.Background())
+}
+
+// ExtractContext is Extract with a context.
+//
+// Reaching N or Duration is not an error. When ctx is done, or the stream fails, ctx.Err() or the stream's error is
+// returned, as an *ExtractError carrying the records collected so far (see ExtractError).
+func (f filterStreamExtractor) ExtractContext(ctx context.Context) ([]Record, error) {
+
+	var records []Record
+
+	collected, err := f.run(ctx, func(ctx context.Context, record Record) error {
+		records = append(records, record)
+		return nil
+	})
+
+	if err != nil {
+		return nil, f.extractError(ctx, err, collected, records)
+	}
+
+	return records, nil
+
+}
+
+// ExtractStream implements StreamExtractor. It behaves like ExtractContext, except that each record is sent to out as
+// soon as it is delivered, blocking while out is full. out is not closed.
+func (f filterStreamExtractor) ExtractStream(ctx context.Context, out chan<- Record) error {
+
+	collected, err := f.run(ctx, func(ctx context.Context, record Record) error {
+
+		select {
+		case out <- record:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+	})
+
+	if err != nil {
+		return f.extractError(ctx, err, collected, nil)
+	}
+
+	return nil
+
+}
+
+// run sets the rules of the stream and passes each unique tweet to emit, returning how many were emitted. emit is
+// passed a context that is done once Duration has passed.
+func (f filterStreamExtractor) run(ctx context.Context, emit func(context.Context, Record) error) (int, error) {
+
+	if api, ok := f.api.(StreamRuleSetter); ok && len(f.rules) > 0 {
+		if _, err := api.SetStreamRules(ctx, f.rules...); err != nil {
+			return 0, err
+		}
+	}
+
+	streamCtx := ctx
+
+	if f.duration > 0 {
+
+		var cancel context.CancelFunc
+
+		streamCtx, cancel = context.WithTimeout(ctx, f.duration)
+		defer cancel()
+
+	}
+
+	seen := &idSet{ids: map[string]struct{}{}}
+	collected := 0
+
+	err := f.api.FilterStream(streamCtx, f.stream, func(message twitter.StreamMessage) error {
+
+		if !seen.add(message.ID()) {
+			return nil
+		}
+
+		if err := emit(streamCtx, streamRecord(message)); err != nil {
+			return err
+		}
+
+		collected++
+
+		if f.n > 0 && collected >= f.n {
+			return errStreamTargetReached
+		}
+
+		return nil
+
+	})
+
+	switch {
+	case err == errStreamTargetReached:
+		return collected, nil
+	case ctx.Err() == nil && streamCtx.Err() != nil:
+		// Duration has passed
+		return collected, nil
+	}
+
+	return collected, err
+
+}
+
+// extractError wraps err with how many of the N tweets were collected
+func (f filterStreamExtractor) extractError(ctx context.Context, err error, collected int, records []Record) error {
+	return extractError(ctx, err, []HashtagProgress{{Hashtag: filterStreamProgress, Collected: collected, Target: f.n}}, records)
+}
+
+// streamRecord converts a tweet delivered by the filtered stream to a Record
+func streamRecord(message twitter.StreamMessage) Record {
+
+	record := Record{}
+
+	for k, v := range message.Data {
+		record[k] = v
+	}
+
+	if message.Includes != nil {
+		record["includes"] = message.Includes
+	}
+
+	rules := make([]string, len(message.MatchingRules))
+
+	for i, rule := range message.MatchingRules {
+
+		rules[i] = rule.Tag
+
+		if rule.Tag == "" {
+			rules[i] = rule.ID
+		}
+
+	}
+
+	record["id_str"] = message.ID()
+	record["matching_rules"] = rules
+
+	return record
+
+}
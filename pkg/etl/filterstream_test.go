@@ -0,0 +1,185 @@
+package etl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// streamAPI delivers a fixed sequence of tweet ids, then blocks until ctx is done. It records the rules it was set to.
+type streamAPI struct {
+	ids   []string
+	rules []twitter.StreamRule
+}
+
+func (s *streamAPI) FilterStream(ctx context.Context, opts twitter.StreamOptions, fn func(twitter.StreamMessage) error) error {
+
+	for _, id := range s.ids {
+
+		message := twitter.StreamMessage{
+			Data:          map[string]interface{}{"id": id, "text": "tweet " + id},
+			MatchingRules: []twitter.StreamRule{{ID: "1", Tag: "iot"}, {ID: "2"}},
+		}
+
+		if err := fn(message); err != nil {
+			return err
+		}
+
+	}
+
+	<-ctx.Done()
+
+	return ctx.Err()
+
+}
+
+func (s *streamAPI) SetStreamRules(ctx context.Context, rules ...twitter.StreamRule) ([]twitter.StreamRule, error) {
+	s.rules = rules
+	return rules, nil
+}
+
+var _ = Describe("FilterStreamExtractor", func() {
+
+	Describe("FilterStreamExtractor.Extract()", func() {
+
+		It("Should stop after N unique tweets", func() {
+
+			// given
+			api := &streamAPI{ids: []string{"1", "2", "2", "3", "4"}}
+			e := NewFilterStreamExtractor(api, FilterStreamExtractorOptions{N: 3})
+
+			// when
+			records, err := e.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(Equal([]Record{
+				{"id": "1", "id_str": "1", "text": "tweet 1", "matching_rules": []string{"iot", "2"}},
+				{"id": "2", "id_str": "2", "text": "tweet 2", "matching_rules": []string{"iot", "2"}},
+				{"id": "3", "id_str": "3", "text": "tweet 3", "matching_rules": []string{"iot", "2"}},
+			}))
+
+		})
+
+		It("Should stop once Duration has passed", func() {
+
+			// given
+			api := &streamAPI{ids: []string{"1", "2"}}
+			e := NewFilterStreamExtractor(api, FilterStreamExtractorOptions{N: 10, Duration: 50 * time.Millisecond})
+
+			// when
+			records, err := e.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(2))
+
+		})
+
+		It("Should set the Rules of the stream first", func() {
+
+			// given
+			api := &streamAPI{ids: []string{"1"}}
+			rules := []twitter.StreamRule{{Value: "#IoT", Tag: "iot"}}
+			e := NewFilterStreamExtractor(api, FilterStreamExtractorOptions{N: 1, Rules: rules})
+
+			// when
+			_, err := e.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(api.rules).To(Equal(rules))
+
+		})
+
+	})
+
+	Describe("FilterStreamExtractor.ExtractContext()", func() {
+
+		It("Should return an *ExtractError carrying the records collected when ctx is done", func() {
+
+			// given
+			api := &streamAPI{ids: []string{"1", "2"}}
+			e := NewFilterStreamExtractor(api, FilterStreamExtractorOptions{N: 10})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			// when
+			_, err := e.ExtractContext(ctx)
+
+			// then
+			var extractErr *ExtractError
+			Expect(errors.As(err, &extractErr)).To(BeTrue())
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Expect(extractErr.Records).To(HaveLen(2))
+			Expect(extractErr.Progress).To(Equal([]HashtagProgress{{Hashtag: "filtered stream", Collected: 2, Target: 10}}))
+
+		})
+
+		It("Should collect from a stand-in filtered stream through twitter.API", func() {
+
+			// given
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				for id := 1; id <= 3; id++ {
+					fmt.Fprintf(w, "{\"data\": {\"id\": \"%d\", \"text\": \"#IoT\"}, \"matching_rules\": [{\"id\": \"1\", \"tag\": \"iot\"}]}\r\n\r\n", id)
+				}
+
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+
+			}))
+			defer server.Close()
+
+			api := twitter.NewAPIWithOptions("key", "secret", twitter.Options{BaseURL: server.URL})
+			api.SetBearerToken("bearerToken")
+
+			e := NewFilterStreamExtractor(api, FilterStreamExtractorOptions{N: 3})
+
+			// when
+			records, err := e.ExtractContext(context.Background())
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(recordIDs(records)).To(Equal([]string{"1", "2", "3"}))
+
+		})
+
+	})
+
+	Describe("FilterStreamExtractor.ExtractStream()", func() {
+
+		It("Should send each unique tweet to out", func() {
+
+			// given
+			api := &streamAPI{ids: []string{"1", "1", "2"}}
+			e := NewFilterStreamExtractor(api, FilterStreamExtractorOptions{N: 2})
+			out := make(chan Record, 2)
+
+			// when
+			err := e.ExtractStream(context.Background(), out)
+			close(out)
+
+			// then
+			var ids []interface{}
+
+			for record := range out {
+				ids = append(ids, record["id_str"])
+			}
+
+			Expect(err).To(BeNil())
+			Expect(ids).To(Equal([]interface{}{"1", "2"}))
+
+		})
+
+	})
+
+})
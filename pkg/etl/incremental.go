@@ -0,0 +1,91 @@
+package etl
+
+import "sync"
+
+// SinceIDStore persists the newest tweet id extracted for each hashtag or user timeline, so that the next run only
+// extracts tweets newer than it. Implementations must be safe for concurrent use.
+type SinceIDStore interface {
+	LoadSinceIDs() (map[string]int64, error)
+	SaveSinceID(hashtag string, sinceID int64) error
+}
+
+// NewFileSinceIDStore is a constructor for FileSinceIDStore
+//
+// path: the JSON state file. It need not exist yet.
+func NewFileSinceIDStore(path string) *FileSinceIDStore {
+	return &FileSinceIDStore{
+		path: path,
+	}
+}
+
+// FileSinceIDStore is a SinceIDStore backed by a JSON file. Like FileCheckpointStore, every save rewrites the whole
+// file.
+type FileSinceIDStore struct {
+	path  string
+	mu    sync.Mutex
+	state *sinceIDState
+}
+
+// sinceIDState is the format of the state file
+type sinceIDState struct {
+	SinceIDs map[string]int64 `json:"since_ids"`
+}
+
+// LoadSinceIDs implements SinceIDStore. A missing file holds no ids.
+func (s *FileSinceIDStore) LoadSinceIDs() (map[string]int64, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	sinceIDs := map[string]int64{}
+
+	for hashtag, sinceID := range s.state.SinceIDs {
+		sinceIDs[hashtag] = sinceID
+	}
+
+	return sinceIDs, nil
+
+}
+
+// SaveSinceID implements SinceIDStore
+func (s *FileSinceIDStore) SaveSinceID(hashtag string, sinceID int64) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.read(); err != nil {
+		return err
+	}
+
+	s.state.SinceIDs[hashtag] = sinceID
+
+	return writeJSONFile(s.path, s.state)
+
+}
+
+// read loads the state file, unless it has been loaded already
+func (s *FileSinceIDStore) read() error {
+
+	if s.state != nil {
+		return nil
+	}
+
+	state := &sinceIDState{}
+
+	if err := readJSONFile(s.path, state); err != nil {
+		return err
+	}
+
+	if state.SinceIDs == nil {
+		state.SinceIDs = map[string]int64{}
+	}
+
+	s.state = state
+
+	return nil
+
+}
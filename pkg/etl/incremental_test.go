@@ -0,0 +1,229 @@
+package etl_test
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ = Describe("Incremental", func() {
+
+	var dir string
+
+	BeforeEach(func() {
+
+		var err error
+
+		dir, err = ioutil.TempDir("", "meshify")
+		Expect(err).To(BeNil())
+
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("FileSinceIDStore", func() {
+
+		It("Should load the ids saved by another store", func() {
+
+			// given
+			path := filepath.Join(dir, "since.json")
+
+			Expect(NewFileSinceIDStore(path).SaveSinceID("#IoT", 12345)).To(BeNil())
+
+			// when
+			sinceIDs, err := NewFileSinceIDStore(path).LoadSinceIDs()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(sinceIDs).To(Equal(map[string]int64{"#IoT": 12345}))
+
+		})
+
+	})
+
+	Describe("HashtagExtractorOptions.SinceIDs", func() {
+
+		It("Should only extract tweets newer than the previous run", func() {
+
+			// given
+			api := newTimelineAPI(10, time.Minute)
+			store := NewFileSinceIDStore(filepath.Join(dir, "since.json"))
+
+			opts := HashtagExtractorOptions{N: 100, Hashtags: []string{"#IoT"}, SinceIDs: store}
+
+			// the first run sees the older 6 tweets, the second all 10
+			older := &timelineAPI{ids: api.ids[4:]}
+
+			// when
+			first, err := NewHashtagExtractorWithOptions(older, opts).Extract()
+			Expect(err).To(BeNil())
+
+			second, err := NewHashtagExtractorWithOptions(api, opts).Extract()
+			Expect(err).To(BeNil())
+
+			third, err := NewHashtagExtractorWithOptions(api, opts).Extract()
+			Expect(err).To(BeNil())
+
+			// then
+			Expect(first).To(HaveLen(6))
+			Expect(recordIDs(second)).To(Equal([]string{
+				fmt.Sprint(api.ids[0]),
+				fmt.Sprint(api.ids[1]),
+				fmt.Sprint(api.ids[2]),
+				fmt.Sprint(api.ids[3]),
+			}))
+			Expect(third).To(BeEmpty())
+
+			sinceIDs, err := store.LoadSinceIDs()
+
+			Expect(err).To(BeNil())
+			Expect(sinceIDs["#IoT"]).To(Equal(api.ids[0]))
+
+		})
+
+		It("Should drop older tweets when the api can not exclude them", func() {
+
+			// given
+			store := NewFileSinceIDStore(filepath.Join(dir, "since.json"))
+			Expect(store.SaveSinceID("#IoT", 12342)).To(BeNil())
+
+			hashtagExtractor := NewHashtagExtractorWithOptions(MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+					return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{
+						{"id_str": "12345"},
+						{"id_str": "12344"},
+						{"id_str": "12343"},
+						{"id_str": "12342"},
+						{"id_str": "12341"},
+					}}, nil
+				},
+			}, HashtagExtractorOptions{N: 100, Hashtags: []string{"#IoT"}, SinceIDs: store})
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(recordIDs(records)).To(Equal([]string{"12345", "12344", "12343"}))
+
+		})
+
+		It("Should not save the newest id of a hashtag that failed", func() {
+
+			// given
+			store := NewFileSinceIDStore(filepath.Join(dir, "since.json"))
+			fetchErr := errors.New("fetch error")
+			calls := 0
+
+			hashtagExtractor := NewHashtagExtractorWithOptions(MockTwitterAPI{
+				FetchHashtagFn: func(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+					calls++
+
+					if calls > 1 {
+						return twitter.SearchAPIResponse{}, fetchErr
+					}
+
+					return twitter.SearchAPIResponse{Statuses: []map[string]interface{}{{"id_str": "12345"}}}, nil
+
+				},
+			}, HashtagExtractorOptions{N: 100, Hashtags: []string{"#IoT"}, SinceIDs: store})
+
+			// when
+			_, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(errors.Is(err, fetchErr)).To(BeTrue())
+
+			sinceIDs, err := store.LoadSinceIDs()
+
+			Expect(err).To(BeNil())
+			Expect(sinceIDs).To(BeEmpty())
+
+		})
+
+		It("Should keep the previous id of a hashtag whose quota stopped it short, and resume down to it", func() {
+
+			// given
+			api := newTimelineAPI(10, time.Minute)
+			store := NewFileSinceIDStore(filepath.Join(dir, "since.json"))
+			Expect(store.SaveSinceID("#IoT", api.ids[8])).To(BeNil())
+
+			checkpoints := NewFileCheckpointStore(filepath.Join(dir, "state.json"))
+
+			// when
+			first, err := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:           3,
+				Hashtags:    []string{"#IoT"},
+				SinceIDs:    store,
+				Checkpoints: checkpoints,
+			}).Extract()
+			Expect(err).To(BeNil())
+
+			afterFirst, err := store.LoadSinceIDs()
+			Expect(err).To(BeNil())
+
+			second, err := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:           100,
+				Hashtags:    []string{"#IoT"},
+				SinceIDs:    store,
+				Checkpoints: checkpoints,
+			}).Extract()
+			Expect(err).To(BeNil())
+
+			// then
+			Expect(first).To(HaveLen(3))
+			Expect(afterFirst["#IoT"]).To(Equal(api.ids[8]))
+
+			Expect(recordIDs(second)).To(Equal([]string{
+				fmt.Sprint(api.ids[3]),
+				fmt.Sprint(api.ids[4]),
+				fmt.Sprint(api.ids[5]),
+				fmt.Sprint(api.ids[6]),
+				fmt.Sprint(api.ids[7]),
+			}))
+
+			sinceIDs, err := store.LoadSinceIDs()
+
+			Expect(err).To(BeNil())
+			Expect(sinceIDs["#IoT"]).To(Equal(api.ids[0]))
+
+		})
+
+		It("Should only split the window newer than the previous run into id ranges", func() {
+
+			// given
+			api := newTimelineAPI(300, 20*time.Minute)
+			store := NewFileSinceIDStore(filepath.Join(dir, "since.json"))
+			Expect(store.SaveSinceID("#IoT", api.ids[100])).To(BeNil())
+
+			hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+				N:        1000,
+				Hashtags: []string{"#IoT"},
+				Ranges:   4,
+				SinceIDs: store,
+			})
+
+			// when
+			records, err := hashtagExtractor.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(HaveLen(100))
+			Expect(records[0]["id_str"]).To(Equal(fmt.Sprint(api.ids[0])))
+			Expect(records[99]["id_str"]).To(Equal(fmt.Sprint(api.ids[99])))
+
+		})
+
+	})
+
+})
@@ -1,11 +1,13 @@
 package etl
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"github.com/jeremywohl/flatten"
 	"io"
 	"sort"
+	"strings"
 )
 
 // WriteFlusher is an interface for writing records to a CSV file
@@ -37,6 +39,12 @@ type Loader interface {
 	Load([]Record) error
 }
 
+// ContextLoader is a Loader that can be cancelled through a context
+type ContextLoader interface {
+	Loader
+	LoadContext(ctx context.Context, records []Record) error
+}
+
 // LoaderFunc is a function impl of Loader
 type LoaderFunc func([]Record) error
 
@@ -50,13 +58,28 @@ var NoopLoader = LoaderFunc(func(r []Record) error {
 	return nil
 })
 
+// StreamLoader is an interface for ETL loading of records as they arrive, rather than all at once
+type StreamLoader interface {
+	LoadStream(ctx context.Context, in <-chan Record) error
+}
+
+// StreamLoaderFunc is a function impl of StreamLoader
+type StreamLoaderFunc func(ctx context.Context, in <-chan Record) error
+
+// LoadStream implements StreamLoader
+func (l StreamLoaderFunc) LoadStream(ctx context.Context, in <-chan Record) error {
+	return l(ctx, in)
+}
+
 // NewCSVLoader is a constructor for CSVLoader
 //
 // out: Writer where CSV formatted records will be written
-func NewCSVLoader(out io.Writer) *CSVLoader {
+// columns: CSV header, in order. If empty, the alphabetically sorted keys of every record are used
+func NewCSVLoader(out io.Writer, columns ...string) *CSVLoader {
 	return &CSVLoader{
 		flatter:      DefaultFlattener,
 		writeFlusher: csv.NewWriter(out),
+		columns:      columns,
 	}
 }
 
@@ -64,6 +87,8 @@ func NewCSVLoader(out io.Writer) *CSVLoader {
 type CSVLoader struct {
 	flatter      Flattener
 	writeFlusher WriteFlusher
+	columns      []string
+	omitHeader   bool
 }
 
 // SetFlattener sets the flattener for testing purposes
@@ -71,13 +96,26 @@ func (c *CSVLoader) SetFlattener(f Flattener) {
 	c.flatter = f
 }
 
+// SetOmitHeader stops the CSV header from being written, for appending to a file that already has one. The columns
+// should then match that header.
+func (c *CSVLoader) SetOmitHeader(omit bool) {
+	c.omitHeader = omit
+}
+
 // SetRecordWriter
 
 // Load will load the records in CSV format to the provided file
 //
-// The keys for the resulting CSV will be sorted alphabetically. Keys will automatically be flattened for records with
-// nested object structures
+// Unless columns were given, the keys for the resulting CSV will be sorted alphabetically. Keys will automatically be
+// flattened for records with nested object structures. Flattened keys that are not among the given columns are
+// dropped.
 func (c *CSVLoader) Load(records []Record) error {
+	return c.LoadContext(context.Background(), records)
+}
+
+// LoadContext is Load with a context. If ctx is done part way through, the rows written so far are flushed and
+// ctx.Err() is returned.
+func (c *CSVLoader) LoadContext(ctx context.Context, records []Record) error {
 
 	flattenedRecords, err := c.flattenRecords(records)
 
@@ -85,24 +123,35 @@ func (c *CSVLoader) Load(records []Record) error {
 		return err
 	}
 
-	uniqueKeys := uniqueKeysForRecords(flattenedRecords)
-	indexLookup := indexLookupForKeys(uniqueKeys)
+	csvHeader := c.columns
 
-	csvHeader := make([]string, len(uniqueKeys))
+	if len(csvHeader) < 1 {
+		csvHeader = uniqueKeysForRecords(flattenedRecords)
+		sort.Strings(csvHeader)
+	}
+
+	indexLookup := map[string]int{}
 
-	for _, k := range uniqueKeys {
-		csvHeader[indexLookup[k]] = k
+	for i, k := range csvHeader {
+		indexLookup[k] = i
 	}
 
-	c.writeFlusher.Write(csvHeader)
+	if !c.omitHeader {
+		c.writeFlusher.Write(csvHeader)
+	}
 
 	for _, record := range flattenedRecords {
 
-		csvRecord := make([]string, len(uniqueKeys))
+		if ctx.Err() != nil {
+			c.writeFlusher.Flush()
+			return ctx.Err()
+		}
+
+		csvRecord := make([]string, len(csvHeader))
 
 		for k, v := range record {
-			if v != nil {
-				csvRecord[indexLookup[k]] = fmt.Sprintf("%v", v)
+			if i, ok := indexLookup[k]; ok && v != nil {
+				csvRecord[i] = formatValue(v)
 			}
 		}
 
@@ -116,6 +165,105 @@ func (c *CSVLoader) Load(records []Record) error {
 
 }
 
+// NewCSVStreamLoader is a constructor for CSVStreamLoader
+//
+// out: Writer where CSV formatted records will be written
+// columns: CSV header, in order. If empty, the alphabetically sorted keys of the first record are used
+func NewCSVStreamLoader(out io.Writer, columns ...string) *CSVStreamLoader {
+	return &CSVStreamLoader{
+		flatter:      DefaultFlattener,
+		writeFlusher: csv.NewWriter(out),
+		columns:      columns,
+	}
+}
+
+// CSVStreamLoader loads records in CSV format as they arrive. Unlike CSVLoader it never holds more than one record, so
+// the CSV header must be known up front: flattened keys that are not among the columns are dropped.
+type CSVStreamLoader struct {
+	flatter      Flattener
+	writeFlusher WriteFlusher
+	columns      []string
+	omitHeader   bool
+}
+
+// SetFlattener sets the flattener for testing purposes
+func (c *CSVStreamLoader) SetFlattener(f Flattener) {
+	c.flatter = f
+}
+
+// SetOmitHeader stops the CSV header from being written, for appending to a file that already has one. The columns
+// should then match that header.
+func (c *CSVStreamLoader) SetOmitHeader(omit bool) {
+	c.omitHeader = omit
+}
+
+// LoadStream implements StreamLoader
+//
+// Every record received from in is written until in is closed, even once ctx is done, so that records already
+// extracted are never lost. Rows are flushed whenever in is momentarily empty.
+func (c *CSVStreamLoader) LoadStream(ctx context.Context, in <-chan Record) error {
+
+	var (
+		columns     = c.columns
+		indexLookup map[string]int
+	)
+
+	if len(columns) > 0 {
+		indexLookup = c.writeHeader(columns)
+	}
+
+	defer c.writeFlusher.Flush()
+
+	for record := range in {
+
+		flattenedRecord, err := c.flatter.Flatten(record)
+
+		if err != nil {
+			return err
+		}
+
+		if indexLookup == nil {
+			columns = uniqueKeysForRecords([]Record{flattenedRecord})
+			sort.Strings(columns)
+			indexLookup = c.writeHeader(columns)
+		}
+
+		csvRecord := make([]string, len(columns))
+
+		for k, v := range flattenedRecord {
+			if i, ok := indexLookup[k]; ok && v != nil {
+				csvRecord[i] = formatValue(v)
+			}
+		}
+
+		c.writeFlusher.Write(csvRecord)
+
+		if len(in) == 0 {
+			c.writeFlusher.Flush()
+		}
+
+	}
+
+	return nil
+
+}
+
+func (c *CSVStreamLoader) writeHeader(columns []string) map[string]int {
+
+	indexLookup := map[string]int{}
+
+	for i, column := range columns {
+		indexLookup[column] = i
+	}
+
+	if !c.omitHeader {
+		c.writeFlusher.Write(columns)
+	}
+
+	return indexLookup
+
+}
+
 func (c CSVLoader) flattenRecords(records []Record) ([]Record, error) {
 
 	var flattened []Record
@@ -136,6 +284,18 @@ func (c CSVLoader) flattenRecords(records []Record) ([]Record, error) {
 
 }
 
+// formatValue formats a flattened value for a CSV cell. A []string, such as a merged "hashtag" value, is joined with
+// spaces.
+func formatValue(v interface{}) string {
+
+	if values, ok := v.([]string); ok {
+		return strings.Join(values, " ")
+	}
+
+	return fmt.Sprintf("%v", v)
+
+}
+
 func uniqueKeysForRecords(records []Record) []string {
 
 	var result []string
@@ -163,16 +323,3 @@ func uniqueKeysForRecords(records []Record) []string {
 	return result
 
 }
-
-func indexLookupForKeys(keys []string) map[string]int {
-
-	keyIndices := map[string]int{}
-	sort.Strings(keys)
-
-	for i, key := range keys {
-		keyIndices[key] = i
-	}
-
-	return keyIndices
-
-}
@@ -3,6 +3,7 @@ package etl_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/csv"
 	"errors"
 	. "github.com/onsi/ginkgo"
@@ -101,4 +102,201 @@ var _ = Describe("Load", func() {
 
 	})
 
+	Describe("CSVLoader.Load() values", func() {
+
+		It("Should join []string values with spaces", func() {
+
+			// given
+			b := &bytes.Buffer{}
+			reader := csv.NewReader(b)
+			csvLoader := NewCSVLoader(b)
+
+			// when
+			err := csvLoader.Load([]Record{{"hashtag": []string{"#IoT", "#Help"}}})
+
+			// then
+			Expect(err).To(BeNil())
+
+			r, err := reader.ReadAll()
+
+			Expect(err).To(BeNil())
+			Expect(r).To(Equal([][]string{{"hashtag"}, {"#IoT #Help"}}))
+
+		})
+
+	})
+
+	Describe("CSVLoader.LoadContext()", func() {
+
+		It("Should flush the header and return ctx.Err() when ctx is done", func() {
+
+			// given
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			b := &bytes.Buffer{}
+			reader := csv.NewReader(b)
+
+			csvLoader := NewCSVLoader(b)
+			records := []Record{{"key": "value1"}, {"key": "value2"}}
+
+			// when
+			err := csvLoader.LoadContext(ctx, records)
+
+			// then
+			Expect(err).To(Equal(context.Canceled))
+
+			r, err := reader.ReadAll()
+
+			Expect(err).To(BeNil())
+			Expect(r).To(Equal([][]string{{"key"}}))
+
+		})
+
+	})
+
+	Describe("CSVStreamLoader.LoadStream()", func() {
+
+		stream := func(records ...Record) <-chan Record {
+
+			in := make(chan Record, len(records))
+
+			for _, record := range records {
+				in <- record
+			}
+
+			close(in)
+
+			return in
+
+		}
+
+		It("Should use the sorted keys of the first record as the header when no columns are given", func() {
+
+			// given
+			b := &bytes.Buffer{}
+			reader := csv.NewReader(b)
+			csvLoader := NewCSVStreamLoader(b)
+
+			// when
+			err := csvLoader.LoadStream(context.Background(), stream(
+				Record{"b": "b value", "a": "a value"},
+				Record{"a": "a value 2", "c": "dropped"},
+			))
+
+			// then
+			Expect(err).To(BeNil())
+
+			r, err := reader.ReadAll()
+
+			Expect(err).To(BeNil())
+			Expect(r).To(Equal([][]string{
+				{"a", "b"},
+				{"a value", "b value"},
+				{"a value 2", ""},
+			}))
+
+		})
+
+		It("Should write the given columns in order", func() {
+
+			// given
+			b := &bytes.Buffer{}
+			reader := csv.NewReader(b)
+			csvLoader := NewCSVStreamLoader(b, "user.screen_name", "id_str")
+
+			// when
+			err := csvLoader.LoadStream(context.Background(), stream(
+				Record{"id_str": "12345", "user": map[string]interface{}{"screen_name": "tniswong"}},
+			))
+
+			// then
+			Expect(err).To(BeNil())
+
+			r, err := reader.ReadAll()
+
+			Expect(err).To(BeNil())
+			Expect(r).To(Equal([][]string{
+				{"user.screen_name", "id_str"},
+				{"tniswong", "12345"},
+			}))
+
+		})
+
+		It("Should return an error if the flattener fails", func() {
+
+			// given
+			flattenerErr := errors.New("flattener error")
+
+			csvLoader := NewCSVStreamLoader(&bytes.Buffer{})
+			csvLoader.SetFlattener(FlattenerFunc(func(map[string]interface{}) (map[string]interface{}, error) {
+				return nil, flattenerErr
+			}))
+
+			// when
+			err := csvLoader.LoadStream(context.Background(), stream(Record{"key": "value"}))
+
+			// then
+			Expect(err).To(Equal(flattenerErr))
+
+		})
+
+	})
+
+	Describe("CSVLoader columns", func() {
+
+		It("Should write the given columns in order and drop any other keys", func() {
+
+			// given
+			b := &bytes.Buffer{}
+			reader := csv.NewReader(b)
+			csvLoader := NewCSVLoader(b, "text", "id_str")
+
+			// when
+			err := csvLoader.Load([]Record{{"id_str": "12345", "text": "hello", "lang": "en"}})
+
+			// then
+			Expect(err).To(BeNil())
+
+			r, err := reader.ReadAll()
+
+			Expect(err).To(BeNil())
+			Expect(r).To(Equal([][]string{{"text", "id_str"}, {"hello", "12345"}}))
+
+		})
+
+		It("Should not write the header when SetOmitHeader is set", func() {
+
+			// given
+			b := &bytes.Buffer{}
+			reader := csv.NewReader(b)
+
+			csvLoader := NewCSVLoader(b, "id_str")
+			csvLoader.SetOmitHeader(true)
+
+			streamLoader := NewCSVStreamLoader(b, "id_str")
+			streamLoader.SetOmitHeader(true)
+
+			in := make(chan Record, 1)
+			in <- Record{"id_str": "67890"}
+			close(in)
+
+			// when
+			err := csvLoader.Load([]Record{{"id_str": "12345"}})
+			Expect(err).To(BeNil())
+
+			err = streamLoader.LoadStream(context.Background(), in)
+
+			// then
+			Expect(err).To(BeNil())
+
+			r, err := reader.ReadAll()
+
+			Expect(err).To(BeNil())
+			Expect(r).To(Equal([][]string{{"12345"}, {"67890"}}))
+
+		})
+
+	})
+
 })
@@ -0,0 +1,222 @@
+package etl
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// lookupProgress labels the progress of a lookup extraction in an *ExtractError
+const lookupProgress = "lookup"
+
+// TweetLooker is an interface abstraction of the statuses/lookup of twitter.API
+type TweetLooker interface {
+	LookupTweets(ctx context.Context, ids []int64) (twitter.LookupAPIResponse, error)
+}
+
+// LookupExtractor is the ContextExtractor and StreamExtractor returned by NewLookupExtractor
+type LookupExtractor interface {
+	ContextExtractor
+	StreamExtractor
+}
+
+// LookupExtractorOptions configures an extractor constructed with NewLookupExtractor
+type LookupExtractorOptions struct {
+	// IDs are the ids of the tweets to extract
+	IDs []int64
+
+	// Missing, if set, is called with the ids of each batch that were not found. Optional.
+	Missing func(ids []int64)
+}
+
+// NewLookupExtractor returns a LookupExtractor that rehydrates tweets from their ids, MaxLookupIDs at a time
+//
+// api: twitter api
+// opts: the ids to look up, and where to report those that no longer exist
+func NewLookupExtractor(api TweetLooker, opts LookupExtractorOptions) LookupExtractor {
+	return lookupExtractor{
+		api:     api,
+		ids:     opts.IDs,
+		missing: opts.Missing,
+	}
+}
+
+type lookupExtractor struct {
+	api     TweetLooker
+	ids     []int64
+	missing func(ids []int64)
+}
+
+// Extract will look up the tweets and convert them to []Record, in the order of their ids. Tweets that no longer exist
+// are left out, and reported to Missing.
+func (l lookupExtractor) Extract() ([]Record, error) {
+	return l.ExtractContext(context.Background())
+}
+
+// ExtractContext is Extract with a context.
+//
+// When ctx is done, or a lookup fails, ctx.Err() or the lookup's error is returned, as an *ExtractError carrying the
+// records collected so far (see ExtractError).
+func (l lookupExtractor) ExtractContext(ctx context.Context) ([]Record, error) {
+
+	var records []Record
+
+	err := l.run(ctx, func(record Record) error {
+		records = append(records, record)
+		return nil
+	})
+
+	if err != nil {
+		return nil, l.extractError(ctx, err, len(records), records)
+	}
+
+	return records, nil
+
+}
+
+// ExtractStream implements StreamExtractor. It behaves like ExtractContext, except that the records of each batch are
+// sent to out as soon as it has been looked up, blocking while out is full. out is not closed.
+func (l lookupExtractor) ExtractStream(ctx context.Context, out chan<- Record) error {
+
+	collected := 0
+
+	err := l.run(ctx, func(record Record) error {
+
+		select {
+		case out <- record:
+			collected++
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+	})
+
+	if err != nil {
+		return l.extractError(ctx, err, collected, nil)
+	}
+
+	return nil
+
+}
+
+// run looks up the ids a batch at a time, passing each tweet found to emit
+func (l lookupExtractor) run(ctx context.Context, emit func(Record) error) error {
+
+	for start := 0; start < len(l.ids); start += twitter.MaxLookupIDs {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := start + twitter.MaxLookupIDs
+
+		if end > len(l.ids) {
+			end = len(l.ids)
+		}
+
+		resp, err := l.api.LookupTweets(ctx, l.ids[start:end])
+
+		if err != nil {
+			return err
+		}
+
+		if len(resp.Missing) > 0 && l.missing != nil {
+			l.missing(resp.Missing)
+		}
+
+		for _, status := range resp.Statuses {
+			if err := emit(Record(status)); err != nil {
+				return err
+			}
+		}
+
+	}
+
+	return nil
+
+}
+
+// extractError wraps err with how many of the tweets were collected
+func (l lookupExtractor) extractError(ctx context.Context, err error, collected int, records []Record) error {
+	return extractError(ctx, err, []HashtagProgress{{Hashtag: lookupProgress, Collected: collected, Target: len(l.ids)}}, records)
+}
+
+// ReadTweetIDs reads tweet ids from r, which is either a list of ids, one per line, or a CSV file with an "id_str"
+// column, such as one written by a CSVLoader. Repeated ids are only returned once.
+func ReadTweetIDs(r io.Reader) ([]int64, error) {
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var (
+		ids    []int64
+		seen   = map[int64]bool{}
+		column = 0
+		line   = 0
+	)
+
+	for {
+
+		row, err := reader.Read()
+
+		if err == io.EOF {
+			return ids, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line++
+
+		if line == 1 {
+
+			if i := indexOf(row, "id_str"); i >= 0 {
+				column = i
+				continue
+			}
+
+		}
+
+		if column >= len(row) {
+			return nil, fmt.Errorf("line %d: no id_str column", line)
+		}
+
+		value := strings.TrimSpace(row[column])
+
+		if value == "" {
+			continue
+		}
+
+		id, err := strconv.ParseInt(value, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid tweet id %q", line, value)
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+
+	}
+
+}
+
+// indexOf returns the index of the first element of values equal to value, or -1
+func indexOf(values []string, value string) int {
+
+	for i, v := range values {
+		if strings.TrimSpace(v) == value {
+			return i
+		}
+	}
+
+	return -1
+
+}
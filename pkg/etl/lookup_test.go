@@ -0,0 +1,176 @@
+package etl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"strings"
+)
+
+// lookupAPI finds every odd id, and records the batches it was asked for
+type lookupAPI struct {
+	batches [][]int64
+	err     error
+}
+
+func (l *lookupAPI) LookupTweets(ctx context.Context, ids []int64) (twitter.LookupAPIResponse, error) {
+
+	l.batches = append(l.batches, ids)
+
+	if l.err != nil && len(l.batches) > 1 {
+		return twitter.LookupAPIResponse{}, l.err
+	}
+
+	var resp twitter.LookupAPIResponse
+
+	for _, id := range ids {
+
+		if id%2 == 0 {
+			resp.Missing = append(resp.Missing, id)
+			continue
+		}
+
+		resp.Statuses = append(resp.Statuses, map[string]interface{}{"id_str": fmt.Sprint(id)})
+
+	}
+
+	return resp, nil
+
+}
+
+var _ = Describe("LookupExtractor", func() {
+
+	ids := func(n int) []int64 {
+
+		var ids []int64
+
+		for id := int64(1); id <= int64(n); id++ {
+			ids = append(ids, id)
+		}
+
+		return ids
+
+	}
+
+	Describe("LookupExtractor.Extract()", func() {
+
+		It("Should look up the ids a batch at a time, reporting those that are missing", func() {
+
+			// given
+			api := &lookupAPI{}
+			var missing []int64
+
+			e := NewLookupExtractor(api, LookupExtractorOptions{
+				IDs: ids(150),
+				Missing: func(ids []int64) {
+					missing = append(missing, ids...)
+				},
+			})
+
+			// when
+			records, err := e.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(api.batches).To(HaveLen(2))
+			Expect(api.batches[0]).To(HaveLen(twitter.MaxLookupIDs))
+			Expect(records).To(HaveLen(75))
+			Expect(records[1]).To(Equal(Record{"id_str": "3"}))
+			Expect(missing).To(HaveLen(75))
+			Expect(missing[0]).To(Equal(int64(2)))
+
+		})
+
+		It("Should return an *ExtractError carrying the records looked up before a lookup failed", func() {
+
+			// given
+			lookupErr := errors.New("lookup error")
+			api := &lookupAPI{err: lookupErr}
+			e := NewLookupExtractor(api, LookupExtractorOptions{IDs: ids(150)})
+
+			// when
+			_, err := e.Extract()
+
+			// then
+			var extractErr *ExtractError
+			Expect(errors.As(err, &extractErr)).To(BeTrue())
+			Expect(errors.Is(err, lookupErr)).To(BeTrue())
+			Expect(extractErr.Records).To(HaveLen(50))
+			Expect(extractErr.Progress).To(Equal([]HashtagProgress{{Hashtag: "lookup", Collected: 50, Target: 150}}))
+
+		})
+
+	})
+
+	Describe("LookupExtractor.ExtractStream()", func() {
+
+		It("Should send each tweet found to out", func() {
+
+			// given
+			e := NewLookupExtractor(&lookupAPI{}, LookupExtractorOptions{IDs: ids(4)})
+			out := make(chan Record, 2)
+
+			// when
+			err := e.ExtractStream(context.Background(), out)
+			close(out)
+
+			// then
+			var found []interface{}
+
+			for record := range out {
+				found = append(found, record["id_str"])
+			}
+
+			Expect(err).To(BeNil())
+			Expect(found).To(Equal([]interface{}{"1", "3"}))
+
+		})
+
+	})
+
+})
+
+var _ = Describe("ReadTweetIDs()", func() {
+
+	It("Should read one id per line", func() {
+
+		// when
+		ids, err := ReadTweetIDs(strings.NewReader("1261326399320715264\n\n1261326399320715000\n1261326399320715264\n"))
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(ids).To(Equal([]int64{1261326399320715264, 1261326399320715000}))
+
+	})
+
+	It("Should read the id_str column of a CSV file", func() {
+
+		// given
+		csv := "created_at,id_str,text\n" +
+			"Fri May 15 16:03:42 +0000 2020,1261326399320715264,\"hello, world\"\n" +
+			"Fri May 15 16:03:41 +0000 2020,1261326399320715000,\"multi\nline\"\n"
+
+		// when
+		ids, err := ReadTweetIDs(strings.NewReader(csv))
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(ids).To(Equal([]int64{1261326399320715264, 1261326399320715000}))
+
+	})
+
+	It("Should return an error for a value that is not an id", func() {
+
+		// when
+		_, err := ReadTweetIDs(strings.NewReader("1\nabc\n"))
+
+		// then
+		Expect(err).To(MatchError(`line 2: invalid tweet id "abc"`))
+
+	})
+
+})
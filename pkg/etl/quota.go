@@ -0,0 +1,124 @@
+package etl
+
+import (
+	"sort"
+	"sync"
+)
+
+// allocation tracks how many records a single hashtag worker may collect
+type allocation struct {
+	quota   int
+	granted int
+	budget  *budget
+}
+
+// remaining returns how many more records may be collected, given how many have been collected so far. Once the
+// granted records have all been collected, more are drawn from the shared budget, up to quota.
+func (a *allocation) remaining(collected int) int {
+
+	if collected >= a.granted && a.budget != nil {
+		a.granted += a.budget.take(a.quota - a.granted)
+	}
+
+	return a.granted - collected
+
+}
+
+// release returns the granted records that were not collected to the shared budget, for workers still running
+func (a *allocation) release(collected int) {
+
+	if a.budget != nil && a.granted > collected {
+		a.budget.give(a.granted - collected)
+		a.granted = collected
+	}
+
+}
+
+// budget is a pool of records shared by every hashtag worker. It is safe for concurrent use.
+type budget struct {
+	mu   sync.Mutex
+	pool int
+}
+
+// take removes up to n records from the pool, returning how many were removed
+func (b *budget) take(n int) int {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n > b.pool {
+		n = b.pool
+	}
+
+	if n < 0 {
+		n = 0
+	}
+
+	b.pool -= n
+
+	return n
+
+}
+
+// give returns n records to the pool
+func (b *budget) give(n int) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pool += n
+
+}
+
+// allocate creates an allocation for each of quotas. If total > 0, it is divided fairly: each quota is granted an
+// equal share of total, except that a quota smaller than its share is granted only the quota, and the difference is
+// divided between the rest. Records a worker can not collect, because its results run out, are returned to a shared
+// budget for the workers still running.
+//
+// If total < 1, each allocation is granted its full quota.
+func allocate(quotas []int, total int) []*allocation {
+
+	allocations := make([]*allocation, len(quotas))
+
+	for i, quota := range quotas {
+		allocations[i] = &allocation{quota: quota, granted: quota}
+	}
+
+	if total < 1 {
+		return allocations
+	}
+
+	shared := &budget{}
+
+	// grant the smallest quotas first, so what they can't use is divided between the larger ones
+	order := make([]int, len(quotas))
+
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return quotas[order[a]] < quotas[order[b]]
+	})
+
+	left := total
+
+	for n, i := range order {
+
+		share := left / (len(order) - n)
+
+		if share > quotas[i] {
+			share = quotas[i]
+		}
+
+		allocations[i].granted = share
+		allocations[i].budget = shared
+		left -= share
+
+	}
+
+	shared.pool = left
+
+	return allocations
+
+}
@@ -0,0 +1,198 @@
+package etl_test
+
+import (
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"sync"
+	"time"
+)
+
+// supplyAPI serves up to supply[hashtag] tweets for each hashtag, at most 100 per request, recording each count
+// requested
+type supplyAPI struct {
+	mu        sync.Mutex
+	supply    map[string]int
+	served    map[string]int
+	total     int
+	requested map[string][]int
+	before    func(hashtag string, call int)
+}
+
+func newSupplyAPI(supply map[string]int) *supplyAPI {
+	return &supplyAPI{
+		supply:    supply,
+		served:    map[string]int{},
+		requested: map[string][]int{},
+	}
+}
+
+func (s *supplyAPI) FetchHashtag(hashtag string, count int, maxID int64) (twitter.SearchAPIResponse, error) {
+
+	s.mu.Lock()
+	call := len(s.requested[hashtag])
+	s.requested[hashtag] = append(s.requested[hashtag], count)
+	s.mu.Unlock()
+
+	if s.before != nil {
+		s.before(hashtag, call)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := twitter.SearchAPIResponse{}
+
+	for x := 0; x < count && x < twitter.MaxPerRequest && s.served[hashtag] < s.supply[hashtag]; x++ {
+		s.served[hashtag]++
+		s.total++
+		resp.Statuses = append(resp.Statuses, map[string]interface{}{
+			"id_str": fmt.Sprint(100000 - s.total),
+			"text":   hashtag,
+		})
+	}
+
+	return resp, nil
+
+}
+
+func countByHashtag(records []Record) map[string]int {
+
+	counts := map[string]int{}
+
+	for _, record := range records {
+		for _, hashtag := range record["hashtag"].([]string) {
+			counts[hashtag]++
+		}
+	}
+
+	return counts
+
+}
+
+var _ = Describe("Quota", func() {
+
+	It("Should only request the number of tweets still needed", func() {
+
+		// given
+		api := newSupplyAPI(map[string]int{"#IoT": 1000})
+		hashtagExtractor := NewHashtagExtractor(api, 150, "#IoT")
+
+		// when
+		records, err := hashtagExtractor.Extract()
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(records).To(HaveLen(150))
+		Expect(api.requested["#IoT"]).To(Equal([]int{150, 50}))
+
+	})
+
+	It("Should use Quotas in place of N for the given hashtags", func() {
+
+		// given
+		api := newSupplyAPI(map[string]int{"#IoT": 1000, "#Help": 1000})
+		hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+			N:        5,
+			Hashtags: []string{"#IoT", "#Help"},
+			Quotas:   map[string]int{"#Help": 3},
+		})
+
+		// when
+		records, err := hashtagExtractor.Extract()
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(countByHashtag(records)).To(Equal(map[string]int{"#IoT": 5, "#Help": 3}))
+
+	})
+
+	It("Should divide the Budget equally between hashtags", func() {
+
+		// given
+		api := newSupplyAPI(map[string]int{"#IoT": 1000, "#Help": 1000, "#Go": 1000})
+		hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+			N:        100,
+			Hashtags: []string{"#IoT", "#Help", "#Go"},
+			Budget:   10,
+		})
+
+		// when
+		records, err := hashtagExtractor.Extract()
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(records).To(HaveLen(10))
+
+		for _, count := range countByHashtag(records) {
+			Expect(count).To(BeNumerically("~", 3, 1))
+		}
+
+	})
+
+	It("Should divide what a smaller quota can not use between the other hashtags", func() {
+
+		// given
+		api := newSupplyAPI(map[string]int{"#IoT": 1000, "#Help": 1000, "#Go": 1000})
+		hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+			N:        100,
+			Hashtags: []string{"#IoT", "#Help", "#Go"},
+			Quotas:   map[string]int{"#Go": 2},
+			Budget:   10,
+		})
+
+		// when
+		records, err := hashtagExtractor.Extract()
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(countByHashtag(records)).To(Equal(map[string]int{"#IoT": 4, "#Help": 4, "#Go": 2}))
+
+	})
+
+	It("Should give what a hashtag with too few results did not use to the hashtags still running", func() {
+
+		// given
+		api := newSupplyAPI(map[string]int{"#IoT": 1000, "#Help": 1})
+		api.before = func(hashtag string, call int) {
+
+			// hold #IoT's first page until #Help has run out of results and released its share
+			if hashtag == "#IoT" && call == 0 {
+				for {
+
+					api.mu.Lock()
+					helpCalls := len(api.requested["#Help"])
+					api.mu.Unlock()
+
+					if helpCalls > 1 {
+						break
+					}
+
+					time.Sleep(time.Millisecond)
+
+				}
+
+				time.Sleep(50 * time.Millisecond)
+			}
+
+		}
+
+		hashtagExtractor := NewHashtagExtractorWithOptions(api, HashtagExtractorOptions{
+			N:        100,
+			Hashtags: []string{"#IoT", "#Help"},
+			Budget:   10,
+		})
+
+		// when
+		records, err := hashtagExtractor.Extract()
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(countByHashtag(records)).To(Equal(map[string]int{"#IoT": 9, "#Help": 1}))
+		Expect(api.requested["#IoT"]).To(Equal([]int{5, 4}))
+
+	})
+
+})
@@ -0,0 +1,296 @@
+package etl
+
+import (
+	"context"
+	"github.com/tniswong/meshify/pkg/twitter"
+)
+
+// TimelineFetcher is an interface abstraction of the user timelines of twitter.API
+type TimelineFetcher interface {
+	FetchUserTimeline(ctx context.Context, user twitter.TimelineUser, count int, sinceID int64, maxID int64) (twitter.TimelineAPIResponse, error)
+}
+
+// UserTimelineExtractor is the ContextExtractor and StreamExtractor returned by NewUserTimelineExtractor
+type UserTimelineExtractor interface {
+	ContextExtractor
+	StreamExtractor
+}
+
+// UserTimelineExtractorOptions configures an extractor constructed with NewUserTimelineExtractor
+type UserTimelineExtractorOptions struct {
+	// N is the number of tweets to extract per user, newest first. Only the most recent twitter.MaxTimelineTweets of
+	// each user can be extracted, so larger quotas are capped.
+	N int
+
+	// Users are the users whose timelines to extract
+	Users []twitter.TimelineUser
+
+	// Quotas overrides N for individual users, keyed by twitter.TimelineUser.String(), such as "@TwitterDev"
+	Quotas map[string]int
+
+	// Budget caps the total number of tweets extracted across all users, divided between them as
+	// HashtagExtractorOptions.Budget is between hashtags. Zero means no cap.
+	Budget int
+
+	// Workers caps how many timelines are extracted at once. Zero extracts every timeline at once.
+	Workers int
+
+	// SinceIDs, if set, makes extraction incremental as HashtagExtractorOptions.SinceIDs does for hashtags, keyed by
+	// twitter.TimelineUser.String(): each timeline only extracts tweets newer than the id it was loaded with, and the
+	// newest id it extracted is saved once it has paged back to that id.
+	SinceIDs SinceIDStore
+}
+
+// NewUserTimelineExtractor returns a UserTimelineExtractor that asynchronously pages through the timeline of each user
+//
+// api: twitter api
+// opts: whose timelines to extract, and how many tweets of each
+func NewUserTimelineExtractor(api TimelineFetcher, opts UserTimelineExtractorOptions) UserTimelineExtractor {
+	return timelineExtractor{
+		api:      api,
+		n:        opts.N,
+		users:    opts.Users,
+		quotas:   opts.Quotas,
+		budget:   opts.Budget,
+		workers:  opts.Workers,
+		sinceIDs: opts.SinceIDs,
+	}
+}
+
+type timelineExtractor struct {
+	api      TimelineFetcher
+	n        int
+	users    []twitter.TimelineUser
+	quotas   map[string]int
+	budget   int
+	workers  int
+	sinceIDs SinceIDStore
+}
+
+// timelineJob is the work assigned to a single timeline worker
+type timelineJob struct {
+	User   twitter.TimelineUser
+	Target int
+	Alloc  *allocation
+
+	// SinceID is the newest id extracted by the previous incremental run. Only newer records are extracted.
+	SinceID int64
+}
+
+// Extract will page through the timeline of each user and convert the tweets to []Record.
+//
+// Timelines are extracted asynchronously by a pool of Workers goroutines. Each resulting Record is hydrated with an
+// extra key: "timeline", which contains the twitter.TimelineUser.String() of the user whose timeline it was found in.
+func (t timelineExtractor) Extract() ([]Record, error) {
+	return t.ExtractContext(context.Background())
+}
+
+// ExtractContext is Extract with a context.
+//
+// When ctx is done, or any worker fails, every other worker stops after its in-flight request and ctx.Err() or the
+// worker's error is returned, as an *ExtractError carrying how far each timeline got along with the records collected
+// so far (see ExtractError).
+func (t timelineExtractor) ExtractContext(ctx context.Context) ([]Record, error) {
+
+	return t.run(ctx, func(ctx context.Context, job timelineJob) workerResult {
+
+		var records []Record
+
+		collected, err := t.collect(ctx, job, func(record Record) error {
+			records = append(records, record)
+			return nil
+		})
+
+		return t.result(job, records, collected, err)
+
+	})
+
+}
+
+// ExtractStream implements StreamExtractor. It behaves like ExtractContext, except that each record is sent to out as
+// soon as its page has been fetched, blocking while out is full. out is not closed.
+func (t timelineExtractor) ExtractStream(ctx context.Context, out chan<- Record) error {
+
+	_, err := t.run(ctx, func(ctx context.Context, job timelineJob) workerResult {
+
+		collected, err := t.collect(ctx, job, func(record Record) error {
+
+			select {
+			case out <- record:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+		})
+
+		return t.result(job, nil, collected, err)
+
+	})
+
+	return err
+
+}
+
+// run extracts each timeline with worker, in a pool of t.workers goroutines, and merges the results. The first failure
+// cancels the remaining workers.
+func (t timelineExtractor) run(ctx context.Context, worker func(context.Context, timelineJob) workerResult) ([]Record, error) {
+
+	sinceIDs := map[string]int64{}
+
+	if t.sinceIDs != nil {
+
+		var err error
+
+		if sinceIDs, err = t.sinceIDs.LoadSinceIDs(); err != nil {
+			return nil, err
+		}
+
+	}
+
+	var (
+		jobs   = make([]timelineJob, len(t.users))
+		quotas = make([]int, len(t.users))
+		labels = make([]string, len(t.users))
+	)
+
+	for i, user := range t.users {
+		labels[i] = user.String()
+		quotas[i] = t.quota(labels[i])
+		jobs[i] = timelineJob{User: user, Target: quotas[i], SinceID: sinceIDs[labels[i]]}
+	}
+
+	for i, alloc := range allocate(quotas, t.budget) {
+		jobs[i].Alloc = alloc
+	}
+
+	records, progress, err := fanOut(ctx, len(jobs), t.workers, func(ctx context.Context, i int) workerResult {
+		return worker(ctx, jobs[i])
+	})
+
+	if err != nil {
+		return nil, extractError(ctx, err, sortProgress(progress, labels), records)
+	}
+
+	return records, nil
+
+}
+
+// quota returns the number of tweets to extract for the user labelled label, capped at twitter.MaxTimelineTweets
+func (t timelineExtractor) quota(label string) int {
+
+	quota := t.n
+
+	if q, ok := t.quotas[label]; ok {
+		quota = q
+	}
+
+	if quota > twitter.MaxTimelineTweets {
+		quota = twitter.MaxTimelineTweets
+	}
+
+	return quota
+
+}
+
+// result reports what a worker collected for job
+func (t timelineExtractor) result(job timelineJob, records []Record, collected int, err error) workerResult {
+	return workerResult{
+		Label:     job.User.String(),
+		Records:   records,
+		Collected: collected,
+		Target:    job.Target,
+		Done:      err == nil,
+		Err:       err,
+	}
+}
+
+// collect pages through the timeline of job.User, newest first, and passes each record to emit until job.Alloc is used
+// up or the timeline runs out, back to job.SinceID. Returns the number of records emitted. Once the timeline runs out,
+// the newest id emitted is saved to t.sinceIDs.
+func (t timelineExtractor) collect(ctx context.Context, job timelineJob, emit func(Record) error) (int, error) {
+
+	collected, newestID, exhausted, err := t.collectPages(ctx, job, emit)
+
+	// as for hashtags, a timeline stopped short of job.SinceID by its quota keeps it
+	if err == nil && exhausted && t.sinceIDs != nil && newestID > job.SinceID {
+		err = t.sinceIDs.SaveSinceID(job.User.String(), newestID)
+	}
+
+	return collected, err
+
+}
+
+// collectPages does the paging of collect, and returns the newest id emitted along with the number of records, and
+// whether the timeline ran out
+func (t timelineExtractor) collectPages(ctx context.Context, job timelineJob, emit func(Record) error) (collected int, newestID int64, exhausted bool, err error) {
+
+	var (
+		maxID int64
+		label = job.User.String()
+		alloc = job.Alloc
+	)
+
+	// hand whatever was not collected back to the timelines still running
+	defer func() {
+		alloc.release(collected)
+	}()
+
+	for remaining := alloc.remaining(collected); remaining > 0; remaining = alloc.remaining(collected) {
+
+		if ctx.Err() != nil {
+			return collected, newestID, false, ctx.Err()
+		}
+
+		resp, err := t.api.FetchUserTimeline(ctx, job.User, remaining, job.SinceID, maxID)
+
+		if err != nil {
+			return collected, newestID, false, err
+		}
+
+		// a page may hold fewer tweets than requested, so the timeline has only run out once a page is empty
+		if len(resp.Statuses) < 1 {
+			return collected, newestID, true, nil
+		}
+
+		if len(resp.Statuses) > remaining {
+			resp.Statuses = resp.Statuses[:remaining]
+		}
+
+		for _, status := range resp.Statuses {
+
+			record := Record{}
+
+			for k, v := range status {
+				record[k] = v
+			}
+
+			record["timeline"] = label
+
+			id, err := getRecordID(record)
+
+			if err != nil {
+				return collected, newestID, false, err
+			}
+
+			if err := emit(record); err != nil {
+				return collected, newestID, false, err
+			}
+
+			collected++
+
+			if id > newestID {
+				newestID = id
+			}
+
+			if maxID == 0 || id <= maxID {
+				maxID = id - 1
+			}
+
+		}
+
+	}
+
+	return collected, newestID, false, nil
+
+}
@@ -0,0 +1,262 @@
+package etl_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/etl"
+	"github.com/tniswong/meshify/pkg/twitter"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// userTimelineAPI serves timelines of sizes[user] tweets, with ids counting down from user*100000, a page of at most
+// MaxPerTimelineRequest at a time, and none at or below sinceID. Users in failing fail.
+type userTimelineAPI struct {
+	mu       sync.Mutex
+	sizes    map[string]int
+	failing  map[string]error
+	requests int
+}
+
+func (t *userTimelineAPI) FetchUserTimeline(ctx context.Context, user twitter.TimelineUser, count int, sinceID int64, maxID int64) (twitter.TimelineAPIResponse, error) {
+
+	t.mu.Lock()
+	t.requests++
+	t.mu.Unlock()
+
+	if err := t.failing[user.String()]; err != nil {
+		return twitter.TimelineAPIResponse{}, err
+	}
+
+	if count > twitter.MaxPerTimelineRequest {
+		count = twitter.MaxPerTimelineRequest
+	}
+
+	newest := user.UserID * 100000
+	oldest := newest - int64(t.sizes[user.String()]) + 1
+
+	if maxID == 0 || maxID > newest {
+		maxID = newest
+	}
+
+	var resp twitter.TimelineAPIResponse
+
+	for id := maxID; id >= oldest && id > sinceID && len(resp.Statuses) < count; id-- {
+		resp.Statuses = append(resp.Statuses, map[string]interface{}{"id_str": fmt.Sprint(id)})
+	}
+
+	return resp, nil
+
+}
+
+func timelineIDs(records []Record, timeline string) []string {
+
+	var ids []string
+
+	for _, record := range records {
+		if record["timeline"] == timeline {
+			ids = append(ids, record["id_str"].(string))
+		}
+	}
+
+	return ids
+
+}
+
+var _ = Describe("UserTimelineExtractor", func() {
+
+	var (
+		one = twitter.TimelineUser{UserID: 1}
+		two = twitter.TimelineUser{UserID: 2}
+	)
+
+	Describe("UserTimelineExtractor.Extract()", func() {
+
+		It("Should page through the timeline of each user, newest first, up to its quota", func() {
+
+			// given
+			api := &userTimelineAPI{sizes: map[string]int{"1": 500, "2": 500}}
+
+			e := NewUserTimelineExtractor(api, UserTimelineExtractorOptions{
+				N:      3,
+				Users:  []twitter.TimelineUser{one, two},
+				Quotas: map[string]int{"2": 250},
+			})
+
+			// when
+			records, err := e.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(timelineIDs(records, "1")).To(Equal([]string{"100000", "99999", "99998"}))
+
+			ids := timelineIDs(records, "2")
+			Expect(ids).To(HaveLen(250))
+			Expect(ids[249]).To(Equal("199751"))
+
+		})
+
+		It("Should stop at the end of a timeline, and at twitter.MaxTimelineTweets", func() {
+
+			// given
+			api := &userTimelineAPI{sizes: map[string]int{"1": 5000, "2": 7}}
+
+			e := NewUserTimelineExtractor(api, UserTimelineExtractorOptions{
+				N:     5000,
+				Users: []twitter.TimelineUser{one, two},
+			})
+
+			// when
+			records, err := e.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(timelineIDs(records, "1")).To(HaveLen(twitter.MaxTimelineTweets))
+			Expect(timelineIDs(records, "2")).To(HaveLen(7))
+			Expect(api.requests).To(Equal(twitter.MaxTimelineTweets/twitter.MaxPerTimelineRequest + 2))
+
+		})
+
+		It("Should give the Budget a short timeline does not use to the others", func() {
+
+			// given
+			api := &userTimelineAPI{sizes: map[string]int{"1": 100, "2": 1}}
+
+			e := NewUserTimelineExtractor(api, UserTimelineExtractorOptions{
+				N:       10,
+				Users:   []twitter.TimelineUser{two, one},
+				Budget:  8,
+				Workers: 1,
+			})
+
+			// when
+			records, err := e.Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(timelineIDs(records, "1")).To(HaveLen(7))
+			Expect(timelineIDs(records, "2")).To(HaveLen(1))
+
+		})
+
+		It("Should only extract tweets newer than the SinceIDs of the previous run, then save the newest", func() {
+
+			// given
+			dir, err := ioutil.TempDir("", "meshify")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			store := NewFileSinceIDStore(filepath.Join(dir, "since.json"))
+			Expect(store.SaveSinceID("1", 99995)).To(BeNil())
+
+			api := &userTimelineAPI{sizes: map[string]int{"1": 10}}
+			opts := UserTimelineExtractorOptions{N: 100, Users: []twitter.TimelineUser{one}, SinceIDs: store}
+
+			// when
+			first, err := NewUserTimelineExtractor(api, opts).Extract()
+			Expect(err).To(BeNil())
+
+			second, err := NewUserTimelineExtractor(api, opts).Extract()
+			Expect(err).To(BeNil())
+
+			// then
+			Expect(timelineIDs(first, "1")).To(Equal([]string{"100000", "99999", "99998", "99997", "99996"}))
+			Expect(second).To(BeEmpty())
+
+			sinceIDs, err := store.LoadSinceIDs()
+			Expect(err).To(BeNil())
+			Expect(sinceIDs).To(Equal(map[string]int64{"1": 100000}))
+
+		})
+
+		It("Should keep the SinceIDs of a timeline whose quota stopped it short of them", func() {
+
+			// given
+			dir, err := ioutil.TempDir("", "meshify")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+
+			store := NewFileSinceIDStore(filepath.Join(dir, "since.json"))
+			Expect(store.SaveSinceID("1", 99995)).To(BeNil())
+
+			api := &userTimelineAPI{sizes: map[string]int{"1": 10}}
+
+			// when
+			records, err := NewUserTimelineExtractor(api, UserTimelineExtractorOptions{
+				N:        2,
+				Users:    []twitter.TimelineUser{one},
+				SinceIDs: store,
+			}).Extract()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(timelineIDs(records, "1")).To(Equal([]string{"100000", "99999"}))
+
+			sinceIDs, err := store.LoadSinceIDs()
+			Expect(err).To(BeNil())
+			Expect(sinceIDs).To(Equal(map[string]int64{"1": 99995}))
+
+		})
+
+		It("Should return an *ExtractError with the progress of each timeline when one fails", func() {
+
+			// given
+			fetchErr := errors.New("fetch error")
+			api := &userTimelineAPI{sizes: map[string]int{"1": 5}, failing: map[string]error{"2": fetchErr}}
+
+			e := NewUserTimelineExtractor(api, UserTimelineExtractorOptions{
+				N:       5,
+				Users:   []twitter.TimelineUser{one, two},
+				Workers: 1,
+			})
+
+			// when
+			_, err := e.Extract()
+
+			// then
+			var extractErr *ExtractError
+			Expect(errors.As(err, &extractErr)).To(BeTrue())
+			Expect(errors.Is(err, fetchErr)).To(BeTrue())
+			Expect(extractErr.Records).To(HaveLen(5))
+			Expect(extractErr.Progress).To(Equal([]HashtagProgress{
+				{Hashtag: "1", Collected: 5, Target: 5, Done: true},
+				{Hashtag: "2", Collected: 0, Target: 5},
+			}))
+
+		})
+
+	})
+
+	Describe("UserTimelineExtractor.ExtractStream()", func() {
+
+		It("Should send each record to out", func() {
+
+			// given
+			api := &userTimelineAPI{sizes: map[string]int{"1": 5}}
+			e := NewUserTimelineExtractor(api, UserTimelineExtractorOptions{N: 2, Users: []twitter.TimelineUser{one}})
+			out := make(chan Record, 2)
+
+			// when
+			err := e.ExtractStream(context.Background(), out)
+			close(out)
+
+			// then
+			var records []Record
+
+			for record := range out {
+				records = append(records, record)
+			}
+
+			Expect(err).To(BeNil())
+			Expect(timelineIDs(records, "1")).To(Equal([]string{"100000", "99999"}))
+
+		})
+
+	})
+
+})
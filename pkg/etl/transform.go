@@ -0,0 +1,126 @@
+package etl
+
+import "github.com/tniswong/meshify/pkg/twitter"
+
+// Transformer is an interface for the ETL transform step. Each record may be mapped to a new record, dropped by
+// returning no records, or split into many records.
+type Transformer interface {
+	Transform(Record) ([]Record, error)
+}
+
+// TransformerFunc is a function impl of Transformer
+type TransformerFunc func(Record) ([]Record, error)
+
+// Transform implements Transformer
+func (t TransformerFunc) Transform(r Record) ([]Record, error) {
+	return t(r)
+}
+
+// NoopTransformer returns each record unchanged
+var NoopTransformer = TransformerFunc(func(r Record) ([]Record, error) {
+	return []Record{r}, nil
+})
+
+// Map returns a Transformer that replaces each record with the result of fn
+func Map(fn func(Record) Record) Transformer {
+	return TransformerFunc(func(r Record) ([]Record, error) {
+		return []Record{fn(r)}, nil
+	})
+}
+
+// Filter returns a Transformer that drops each record for which keep returns false
+func Filter(keep func(Record) bool) Transformer {
+	return TransformerFunc(func(r Record) ([]Record, error) {
+
+		if !keep(r) {
+			return nil, nil
+		}
+
+		return []Record{r}, nil
+
+	})
+}
+
+// Chain returns a Transformer that applies each of transformers in order, passing every record output by one
+// Transformer to the next
+func Chain(transformers ...Transformer) Transformer {
+	return TransformerFunc(func(r Record) ([]Record, error) {
+
+		records := []Record{r}
+
+		for _, t := range transformers {
+
+			var err error
+
+			if records, err = transformAll(t, records); err != nil {
+				return nil, err
+			}
+
+		}
+
+		return records, nil
+
+	})
+}
+
+// transformAll applies t to each of records, and merges the results into a single []Record
+func transformAll(t Transformer, records []Record) ([]Record, error) {
+
+	var transformed []Record
+
+	for _, record := range records {
+
+		result, err := t.Transform(record)
+
+		if err != nil {
+			return nil, err
+		}
+
+		transformed = append(transformed, result...)
+
+	}
+
+	return transformed, nil
+
+}
+
+// transformStream applies t to each record received from in and sends the results to out, until in is closed or t
+// fails
+func transformStream(t Transformer, in <-chan Record, out chan<- Record) error {
+
+	for record := range in {
+
+		result, err := t.Transform(record)
+
+		if err != nil {
+			return err
+		}
+
+		for _, r := range result {
+			out <- r
+		}
+
+	}
+
+	return nil
+
+}
+
+// NormalizeText sets the "text" field of each record to the complete text of the tweet, whichever tweet mode or API
+// version it was fetched with, as resolved by twitter.Tweet.CompleteText. A record that is not a tweet, or has no
+// text, is left unchanged.
+var NormalizeText = Map(func(r Record) Record {
+
+	tweet, err := twitter.TweetFromStatus(r)
+
+	if err != nil {
+		return r
+	}
+
+	if text := tweet.CompleteText(); text != "" {
+		r["text"] = text
+	}
+
+	return r
+
+})
@@ -0,0 +1,204 @@
+package etl_test
+
+import (
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/etl"
+)
+
+var _ = Describe("Transform", func() {
+
+	split := TransformerFunc(func(r Record) ([]Record, error) {
+		return []Record{
+			{"id_str": r["id_str"], "part": 1},
+			{"id_str": r["id_str"], "part": 2},
+		}, nil
+	})
+
+	Describe("Map()", func() {
+
+		It("Should replace each record with the result of fn", func() {
+
+			// given
+			t := Map(func(r Record) Record {
+				return Record{"id_str": r["id_str"], "mapped": true}
+			})
+
+			// when
+			records, err := t.Transform(Record{"id_str": "12345"})
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(Equal([]Record{{"id_str": "12345", "mapped": true}}))
+
+		})
+
+	})
+
+	Describe("Filter()", func() {
+
+		It("Should drop records for which keep returns false", func() {
+
+			// given
+			t := Filter(func(r Record) bool {
+				return r["lang"] == "en"
+			})
+
+			// when
+			kept, err1 := t.Transform(Record{"lang": "en"})
+			dropped, err2 := t.Transform(Record{"lang": "fr"})
+
+			// then
+			Expect(err1).To(BeNil())
+			Expect(err2).To(BeNil())
+			Expect(kept).To(HaveLen(1))
+			Expect(dropped).To(BeEmpty())
+
+		})
+
+	})
+
+	Describe("Chain()", func() {
+
+		It("Should pass every record output by one Transformer to the next", func() {
+
+			// given
+			t := Chain(
+				split,
+				Filter(func(r Record) bool {
+					return r["part"] == 2
+				}),
+				Map(func(r Record) Record {
+					r["chained"] = true
+					return r
+				}),
+			)
+
+			// when
+			records, err := t.Transform(Record{"id_str": "12345"})
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(Equal([]Record{{"id_str": "12345", "part": 2, "chained": true}}))
+
+		})
+
+		It("Should return the first error encountered", func() {
+
+			// given
+			transformErr := errors.New("transform error")
+			t := Chain(
+				split,
+				TransformerFunc(func(r Record) ([]Record, error) {
+					return nil, transformErr
+				}),
+			)
+
+			// when
+			_, err := t.Transform(Record{"id_str": "12345"})
+
+			// then
+			Expect(err).To(Equal(transformErr))
+
+		})
+
+		It("Should return each record unchanged when empty", func() {
+
+			// when
+			records, err := Chain().Transform(Record{"id_str": "12345"})
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(Equal([]Record{{"id_str": "12345"}}))
+
+		})
+
+	})
+
+	Describe("NormalizeText", func() {
+
+		It("Should resolve extended_tweet.full_text, then full_text, then text", func() {
+
+			// given
+			records := []Record{
+				{"text": "short", "full_text": "full", "extended_tweet": map[string]interface{}{"full_text": "extended"}},
+				{"full_text": "full"},
+				{"text": "short"},
+			}
+
+			// when
+			var texts []interface{}
+
+			for _, record := range records {
+				transformed, err := NormalizeText.Transform(record)
+				Expect(err).To(BeNil())
+				texts = append(texts, transformed[0]["text"])
+			}
+
+			// then
+			Expect(texts).To(Equal([]interface{}{"extended", "full", "short"}))
+
+		})
+
+		It("Should rebuild a retweet from the complete text of the retweeted status", func() {
+
+			// given
+			record := Record{
+				"full_text": "RT @TwitterAPI: trunc…",
+				"retweeted_status": map[string]interface{}{
+					"user":      map[string]interface{}{"screen_name": "TwitterAPI"},
+					"full_text": "the complete text",
+				},
+			}
+
+			// when
+			records, err := NormalizeText.Transform(record)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records[0]["text"]).To(Equal("RT @TwitterAPI: the complete text"))
+
+		})
+
+		It("Should rebuild an API v2 retweet from the joined retweeted tweet", func() {
+
+			// given
+			record := Record{
+				"text": "RT @TwitterDev: trunc…",
+				"referenced_tweets": []interface{}{
+					map[string]interface{}{"type": "quoted", "id": "1"},
+					map[string]interface{}{
+						"type": "retweeted",
+						"id":   "2",
+						"tweet": map[string]interface{}{
+							"author": map[string]interface{}{"username": "TwitterDev"},
+							"text":   "the complete text",
+						},
+					},
+				},
+			}
+
+			// when
+			records, err := NormalizeText.Transform(record)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records[0]["text"]).To(Equal("RT @TwitterDev: the complete text"))
+
+		})
+
+		It("Should leave a record without any text unchanged", func() {
+
+			// when
+			records, err := NormalizeText.Transform(Record{"id_str": "12345"})
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(records).To(Equal([]Record{{"id_str": "12345"}}))
+
+		})
+
+	})
+
+})
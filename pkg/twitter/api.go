@@ -2,9 +2,9 @@ package twitter
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 const (
@@ -26,6 +27,10 @@ const (
 
 	// SearchURL is the twitter search API url
 	SearchURL = BaseURL + "1.1/search/tweets.json"
+
+	tokenPath           = "oauth2/token"
+	invalidateTokenPath = "oauth2/invalidate_token"
+	searchPath          = "1.1/search/tweets.json"
 )
 
 // Decoder is a convenience interface for testing purposes
@@ -54,29 +59,134 @@ func (d DoerFunc) Do(r *http.Request) (*http.Response, error) {
 	return d(r)
 }
 
-// NoopDoer is a test helper that returns &http.Response{}, nil
+// NoopDoer is a test helper that returns &http.Response{Body: http.NoBody}, nil
 var NoopDoer = DoerFunc(func(*http.Request) (*http.Response, error) {
-	return &http.Response{}, nil
+	return &http.Response{Body: http.NoBody}, nil
 })
 
 // SearchAPIResponse represents the responses from the twitter search API
 type SearchAPIResponse struct {
+	// Statuses holds each tweet exactly as returned, with numbers decoded as json.Number so that no precision is lost
 	Statuses []map[string]interface{}
+
+	// Tweets holds the typed form of each of Statuses, in the same order. A status that could not be decoded as a Tweet
+	// has its DecodeErr set.
+	Tweets []Tweet
+
+	SearchMetadata SearchMetadata `json:"search_metadata"`
+}
+
+// SearchMetadata describes a page of search results (see:
+// https://developer.twitter.com/en/docs/tweets/search/api-reference/get-search-tweets)
+type SearchMetadata struct {
+	// MaxID is the id of the newest tweet the search covered
+	MaxID int64 `json:"max_id"`
+
+	// SinceID is the since_id of the request, zero if none
+	SinceID int64 `json:"since_id"`
+
+	// NextResults is the query string for the next, older, page of results, to be passed to FetchResults. It carries
+	// every parameter of the search it follows. Empty on the last page.
+	NextResults string `json:"next_results"`
+
+	// RefreshURL is the query string for results newer than this search, exactly as returned by Twitter. Like the
+	// next_results Twitter returns, it carries q but drops the rest of the search, such as lang and geocode.
+	RefreshURL string `json:"refresh_url"`
+
+	// Count is the count of the request
+	Count int `json:"count"`
+
+	// CompletedIn is how long the search took, in seconds
+	CompletedIn float64 `json:"completed_in"`
+
+	// Query is the url encoded q of the request
+	Query string `json:"query"`
 }
 
 type tokenAPIResponse struct {
 	AccessToken string `json:"access_token"`
 }
 
+// Options configures an API constructed with NewAPIWithOptions. Zero values fall back to the NewAPI defaults.
+type Options struct {
+	// BaseURL is the root url of the API, including the trailing slash. Defaults to BaseURL.
+	BaseURL string
+
+	// Timeout is the http client timeout for each request. Defaults to no timeout.
+	Timeout time.Duration
+
+	// UserAgent is sent as the User-Agent header of each request when set.
+	UserAgent string
+
+	// RateLimiter schedules search requests. Pass the same RateLimiter to several APIs sharing one set of credentials.
+	// Defaults to a new RateLimiter.
+	RateLimiter *RateLimiter
+
+	// RetryPolicy retries transient failures of every request, including token requests. Defaults to no retries.
+	RetryPolicy *RetryPolicy
+
+	// TweetMode is sent with every search that does not set its own. TweetModeExtended returns the complete text of
+	// tweets longer than 140 characters in full_text. Defaults to the API default, TweetModeCompat.
+	TweetMode TweetMode
+
+	// Authenticator authorizes every request other than token requests, for example with an OAuth1Authenticator for
+	// user context. Defaults to an app-only bearer token, acquired with the consumer key and secret. The filtered
+	// stream and its rules only accept an app-only bearer token, so they always use one.
+	Authenticator Authenticator
+}
+
 // NewAPI is a constructor for API
 //
 // key: Consumer API Key
 // secret: Consumer API Secret Key
 func NewAPI(key string, secret string) *API {
-	return &API{
-		key:    key,
-		secret: secret,
-		client: &http.Client{},
+	return NewAPIWithOptions(key, secret, Options{})
+}
+
+// NewAPIWithOptions is a constructor for API that allows the endpoints and http client to be configured, for example
+// to target a local stand-in server rather than api.twitter.com
+//
+// key: Consumer API Key
+// secret: Consumer API Secret Key
+// opts: endpoint and http client configuration
+func NewAPIWithOptions(key string, secret string, opts Options) *API {
+
+	baseURL := opts.BaseURL
+
+	if baseURL == "" {
+		baseURL = BaseURL
+	}
+
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	limiter := opts.RateLimiter
+
+	if limiter == nil {
+		limiter = NewRateLimiter()
+	}
+
+	var client Doer = &http.Client{Timeout: opts.Timeout}
+
+	if opts.RetryPolicy != nil {
+		client = NewRetryDoer(client, *opts.RetryPolicy)
+	}
+
+	api := &API{
+		key:       key,
+		secret:    secret,
+		baseURL:   baseURL,
+		userAgent: opts.UserAgent,
+		tweetMode: opts.TweetMode,
+		limiter:   limiter,
+		// the rate limit windows apart from the search window (see API)
+		lookupLimiter:   NewRateLimiter(),
+		timelineLimiter: NewRateLimiter(),
+		trendsLimiter:   NewRateLimiter(),
+		client:          client,
+		// a stream never completes, so it has no timeout. Stalls are detected by FilterStream instead.
+		streamClient: &http.Client{},
 		decoderFactory: func(r io.Reader) Decoder {
 			return json.NewDecoder(r)
 		},
@@ -84,16 +194,38 @@ func NewAPI(key string, secret string) *API {
 			return http.NewRequest(method, url, reader)
 		},
 	}
+
+	api.bearer = &bearerAuthenticator{api: api}
+	api.auth = opts.Authenticator
+
+	if api.auth == nil {
+		api.auth = api.bearer
+	}
+
+	return api
+
 }
 
 // API provides access the Twitter API
+//
+// statuses/lookup, statuses/user_timeline and trends/place each have a rate limit window of their own, apart from the
+// search window reported by RateLimit, so their requests are scheduled by a RateLimiter of their own.
 type API struct {
-	key            string
-	secret         string
-	bearerToken    string
-	client         Doer
-	decoderFactory func(io.Reader) Decoder
-	requestFactory func(string, string, io.Reader) (*http.Request, error)
+	key             string
+	secret          string
+	baseURL         string
+	userAgent       string
+	tweetMode       TweetMode
+	auth            Authenticator
+	bearer          *bearerAuthenticator
+	limiter         *RateLimiter
+	lookupLimiter   *RateLimiter
+	timelineLimiter *RateLimiter
+	trendsLimiter   *RateLimiter
+	client          Doer
+	streamClient    Doer
+	decoderFactory  func(io.Reader) Decoder
+	requestFactory  func(string, string, io.Reader) (*http.Request, error)
 }
 
 // SetClient setter for client. This is for testing purposes
@@ -101,6 +233,11 @@ func (a *API) SetClient(client Doer) {
 	a.client = client
 }
 
+// SetStreamClient setter for the client of FilterStream. This is for testing purposes
+func (a *API) SetStreamClient(client Doer) {
+	a.streamClient = client
+}
+
 // SetDecoderFactory setter for decoderFactory. This is for testing purposes
 func (a *API) SetDecoderFactory(decoderFactory func(io.Reader) Decoder) {
 	a.decoderFactory = decoderFactory
@@ -111,67 +248,297 @@ func (a *API) SetRequestFactory(requestFactory func(string, string, io.Reader) (
 	a.requestFactory = requestFactory
 }
 
-// SetBearerToken setter for bearerToken. This is for testing purposes
+// SetBearerToken setter for the app-only bearer token. This is for testing purposes
 func (a *API) SetBearerToken(bearerToken string) {
-	a.bearerToken = bearerToken
+	a.bearer.setToken(bearerToken)
+}
+
+// SetRateLimiter setter for limiter
+func (a *API) SetRateLimiter(limiter *RateLimiter) {
+	a.limiter = limiter
+}
+
+// RateLimit returns the most recently reported search rate limit window. ok is false until a search response carrying
+// rate limit headers has been seen.
+func (a *API) RateLimit() (window RateLimit, ok bool) {
+	return a.limiter.State()
 }
 
 // FetchHashtag will query the Twitter Search API for a hashtag
 //
 // hashtag: hashtag to query
 // count: number of records to retrieve
-// maxId: maxId for the query (see: https://developer.twitter.com/en/docs/tweets/timelines/guides/working-with-timelines)
+// maxId: maxId for the query (see:
+// https://developer.twitter.com/en/docs/tweets/timelines/guides/working-with-timelines)
+//
+// Requests are scheduled by the API's RateLimiter. When the rate limit window is used up, or Twitter responds with
+// 429, FetchHashtag blocks until the window resets and then retries, up to MaxRateLimitedAttempts times. Other
+// responses with a status >= 400, and the last 429, are returned as *APIError.
 func (a *API) FetchHashtag(hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return a.FetchHashtagContext(context.Background(), hashtag, count, maxID)
+}
 
-	if a.bearerToken == "" {
+// FetchHashtagContext is FetchHashtag with a context. Cancelling ctx aborts any in-flight request, token acquisition
+// or rate limit wait, and returns ctx.Err().
+func (a *API) FetchHashtagContext(ctx context.Context, hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return a.FetchHashtagRange(ctx, hashtag, count, 0, maxID)
+}
 
-		bearerToken, err := a.newBearerToken()
+// FetchHashtagRange is FetchHashtagContext restricted to tweets with sinceID < id <= maxID. Either bound is ignored
+// when zero. See IDRange for splitting a time window into ranges that can be queried in parallel.
+func (a *API) FetchHashtagRange(ctx context.Context, hashtag string, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+	return a.FetchSearch(ctx, HashtagQuery(hashtag), count, sinceID, maxID)
+}
 
-		if err != nil {
-			return SearchAPIResponse{}, err
-		}
+// FetchSearch will query the Twitter Search API with any SearchQuery, for tweets with sinceID < id <= maxID. Either
+// bound is ignored when zero. Returns ErrEmptyQuery or ErrQueryTooLong, without a request, if query is not valid.
+//
+// query: what to search for
+// count: number of records to retrieve
+func (a *API) FetchSearch(ctx context.Context, query SearchQuery, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+
+	if err := query.Validate(); err != nil {
+		return SearchAPIResponse{}, err
+	}
+
+	return a.search(ctx, a.searchParams(query, count, sinceID, maxID))
 
-		a.bearerToken = bearerToken
+}
+
+// FetchResults follows the NextResults query string of a previous SearchAPIResponse
+//
+// results: query string, such as "?max_id=12345&q=%23IoT&count=100"
+// count: number of records to retrieve, overriding the count of results. Ignored if zero.
+func (a *API) FetchResults(ctx context.Context, results string, count int) (SearchAPIResponse, error) {
+
+	params, err := url.ParseQuery(strings.TrimPrefix(results, "?"))
 
+	if err != nil {
+		return SearchAPIResponse{}, err
 	}
 
-	auth := authorization(a.bearerToken)
-	req, err := a.searchRequest(auth, hashtag, count, maxID)
+	if count > 0 {
+		params.Set("count", fmt.Sprintf("%v", int(math.Min(float64(count), float64(MaxPerRequest)))))
+	}
+
+	if a.tweetMode != "" && params.Get("tweet_mode") == "" {
+		params.Set("tweet_mode", string(a.tweetMode))
+	}
+
+	return a.search(ctx, params)
+
+}
+
+// search fetches the search results for params. The NextResults Twitter returns only carries max_id, q, count and
+// include_entities=1, so it is rewritten as params with the max_id replaced, for the next page to keep the rest of the
+// search, such as lang, geocode and since_id.
+func (a *API) search(ctx context.Context, params url.Values) (SearchAPIResponse, error) {
+
+	var result SearchAPIResponse
+
+	err := a.fetch(ctx, func() (*http.Request, error) {
+		return a.searchRequestWithParams(params)
+	}, &result)
 
 	if err != nil {
 		return SearchAPIResponse{}, err
 	}
 
+	result.SearchMetadata.NextResults = nextResults(params, result.SearchMetadata.NextResults)
+
+	return result, nil
+
+}
+
+// nextResults returns params with the max_id of next, the next_results of the response to params. next is returned
+// unchanged if it has no max_id.
+func nextResults(params url.Values, next string) string {
+
+	parsed, err := url.ParseQuery(strings.TrimPrefix(next, "?"))
+
+	if next == "" || err != nil || parsed.Get("max_id") == "" {
+		return next
+	}
+
+	rebuilt := url.Values{}
+
+	for name, values := range params {
+		rebuilt[name] = values
+	}
+
+	rebuilt.Set("max_id", parsed.Get("max_id"))
+
+	return "?" + rebuilt.Encode()
+
+}
+
+// InvalidateToken revokes the cached bearer token via oauth2/invalidate_token. The next request acquires a new one.
+func (a *API) InvalidateToken() error {
+	return a.bearer.invalidate()
+}
+
+// invalidateToken revokes bearerToken via oauth2/invalidate_token
+func (a *API) invalidateToken(bearerToken string) error {
+
+	req, err := a.invalidateTokenRequest(tokenAuthorization(a.key, a.secret), bearerToken)
+	if err != nil {
+		return err
+	}
+
 	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return newAPIError(resp, req.URL.String(), bodyBytes)
+	}
+
+	return nil
+
+}
+
+// fetch executes the request built by newRequest, authorized by the Authenticator, and decodes the response into
+// result. If the credentials have expired or been invalidated, and the Authenticator is an ExpiringAuthenticator, they
+// are renewed and the request is retried once.
+func (a *API) fetch(ctx context.Context, newRequest func() (*http.Request, error), result interface{}) error {
+	return a.fetchVia(ctx, a.doRateLimited, newRequest, result)
+}
+
+// fetchVia is fetch with the request executed by do, for endpoints outside the search rate limit window
+func (a *API) fetchVia(ctx context.Context, do func(context.Context, *http.Request) (*http.Response, error), newRequest func() (*http.Request, error), result interface{}) error {
+	return a.fetchAuthenticatedBy(ctx, a.auth, do, newRequest, result)
+}
+
+// fetchAuthenticatedBy is fetchVia with the request authorized by auth rather than the API's Authenticator
+func (a *API) fetchAuthenticatedBy(ctx context.Context, auth Authenticator, do func(context.Context, *http.Request) (*http.Response, error), newRequest func() (*http.Request, error), result interface{}) error {
+
+	for attempt := 1; ; attempt++ {
+
+		req, err := a.fetchOnce(ctx, auth, do, newRequest, result)
+
+		if apiErr, ok := err.(*APIError); ok && req != nil && attempt == 1 && isInvalidToken(apiErr) {
+			if auth, ok := auth.(ExpiringAuthenticator); ok {
+				auth.Expire(req)
+				continue
+			}
+		}
+
+		return err
+
+	}
+
+}
+
+// fetchOnce builds, authenticates and executes a single request, returning it along with any error. Credentials that
+// do not depend on the request, such as a bearer token, are acquired before it is built.
+func (a *API) fetchOnce(ctx context.Context, auth Authenticator, do func(context.Context, *http.Request) (*http.Response, error), newRequest func() (*http.Request, error), result interface{}) (*http.Request, error) {
+
+	if p, ok := auth.(preparer); ok {
+		if err := p.prepare(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := newRequest()
 
 	if err != nil {
-		return SearchAPIResponse{}, err
+		return nil, err
+	}
+
+	// the Authenticator travels with req, to authorize it again if it is resent
+	req = req.WithContext(context.WithValue(ctx, authenticatorKey{}, auth))
+
+	if err := auth.Authenticate(ctx, req); err != nil {
+		return req, err
 	}
 
+	resp, err := do(ctx, req)
+
+	if err != nil {
+		return req, err
+	}
+
+	defer resp.Body.Close()
+
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 
 	if err != nil {
-		return SearchAPIResponse{}, err
+		return req, err
 	}
 
 	if resp.StatusCode >= 400 {
-		return SearchAPIResponse{}, errors.New(string(bodyBytes))
+		return req, newAPIError(resp, req.URL.String(), bodyBytes)
 	}
 
-	var result SearchAPIResponse
-
 	d := a.decoderFactory(bytes.NewBuffer(bodyBytes))
-	err = d.Decode(&result)
 
-	if err != nil {
-		return SearchAPIResponse{}, err
+	return req, d.Decode(result)
+
+}
+
+// doRateLimited executes req once the limiter allows it, waiting out and retrying 429 responses, authorized afresh for
+// each attempt. After MaxRateLimitedAttempts consecutive 429 responses the last one is returned, to be reported as an
+// *APIError.
+func (a *API) doRateLimited(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return a.doLimitedBy(ctx, a.limiter, req)
+}
+
+// doLimitedBy is doRateLimited for a rate limit window other than that of the v1.1 search
+func (a *API) doLimitedBy(ctx context.Context, limiter *RateLimiter, req *http.Request) (*http.Response, error) {
+
+	for attempt := 1; ; attempt++ {
+
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		// a resent request is authorized after waiting, so that an OAuth 1.0a timestamp is not left behind by the wait
+		if attempt > 1 {
+
+			next, err := reauthenticate(req)
+
+			if err != nil {
+				return nil, err
+			}
+
+			req = next
+
+		}
+
+		resp, err := a.client.Do(req)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests {
+			limiter.Update(resp.Header)
+			return resp, nil
+		}
+
+		limiter.Exhaust(resp.Header)
+
+		if attempt >= MaxRateLimitedAttempts {
+			return resp, nil
+		}
+
+		if resp.Body != nil {
+			resp.Body.Close()
+		}
+
 	}
 
-	return result, nil
+}
 
+func isInvalidToken(err *APIError) bool {
+	return err.StatusCode == http.StatusUnauthorized || err.HasCode(ErrCodeInvalidToken)
 }
 
-func (a API) newBearerToken() (string, error) {
+func (a *API) newBearerToken(ctx context.Context) (string, error) {
 
 	auth := tokenAuthorization(a.key, a.secret)
 
@@ -180,11 +547,20 @@ func (a API) newBearerToken() (string, error) {
 		return "", err
 	}
 
+	req = req.WithContext(ctx)
+
 	resp, err := a.client.Do(req)
 	if err != nil {
 		return "", err
 	}
 
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return "", newAPIError(resp, req.URL.String(), bodyBytes)
+	}
+
 	d := a.decoderFactory(resp.Body)
 	respBody := tokenAPIResponse{}
 
@@ -197,26 +573,37 @@ func (a API) newBearerToken() (string, error) {
 
 }
 
-func (a API) searchRequest(auth string, q string, count int, maxID int64) (*http.Request, error) {
+func (a *API) searchParams(query SearchQuery, count int, sinceID int64, maxID int64) url.Values {
 
-	req, err := a.requestFactory("GET", SearchURL, nil)
-
-	if err != nil {
-		return nil, err
+	if query.TweetMode == "" {
+		query.TweetMode = a.tweetMode
 	}
 
-	params := url.Values{}
-	params.Add("q", q)
-	params.Add("lang", "en")
+	params := query.Params()
 	params.Add("count", fmt.Sprintf("%v", int(math.Min(float64(count), float64(MaxPerRequest)))))
-	params.Add("include_entities", "false")
+
+	if sinceID > 0 {
+		params.Add("since_id", fmt.Sprintf("%v", sinceID))
+	}
 
 	if maxID > 0 {
 		params.Add("max_id", fmt.Sprintf("%v", maxID))
 	}
 
+	return params
+
+}
+
+func (a *API) searchRequestWithParams(params url.Values) (*http.Request, error) {
+
+	req, err := a.requestFactory("GET", a.endpoint(searchPath), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
 	req.URL.RawQuery = params.Encode()
-	req.Header.Add("Authorization", auth)
+	a.setUserAgent(req)
 
 	return req, nil
 
@@ -232,13 +619,45 @@ func authorization(token string) string {
 
 }
 
-func (a API) tokenRequest(auth string) (*http.Request, error) {
+func (a *API) tokenRequest(auth string) (*http.Request, error) {
 
 	reqBody := url.Values{
 		"grant_type": []string{"client_credentials"},
 	}
 
-	req, err := a.requestFactory("POST", TokenURL, strings.NewReader(reqBody.Encode()))
+	req, err := a.requestFactory("POST", a.endpoint(tokenPath), strings.NewReader(reqBody.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", auth)
+	a.setUserAgent(req)
+
+	return req, nil
+
+}
+
+func (a *API) endpoint(path string) string {
+	return a.baseURL + path
+}
+
+func (a *API) setUserAgent(req *http.Request) {
+
+	if a.userAgent != "" {
+		req.Header.Set("User-Agent", a.userAgent)
+	}
+
+}
+
+func (a *API) invalidateTokenRequest(auth string, bearerToken string) (*http.Request, error) {
+
+	reqBody := url.Values{
+		"access_token": []string{bearerToken},
+	}
+
+	req, err := a.requestFactory("POST", a.endpoint(invalidateTokenPath), strings.NewReader(reqBody.Encode()))
 
 	if err != nil {
 		return nil, err
@@ -246,6 +665,7 @@ func (a API) tokenRequest(auth string) (*http.Request, error) {
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Authorization", auth)
+	a.setUserAgent(req)
 
 	return req, nil
 
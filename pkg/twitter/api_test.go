@@ -1,6 +1,7 @@
 package twitter_test
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,8 +11,12 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var _ = Describe("API", func() {
@@ -68,6 +73,32 @@ var _ = Describe("API", func() {
 
 			})
 
+			It("should return an *APIError if tokenRequest status >= 400", func() {
+
+				// given
+				api := NewAPI("key", "secret")
+				api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+
+					if req.Method == "POST" && req.URL.String() == TokenURL {
+						return &http.Response{
+							StatusCode: 403,
+							Body:       ioutil.NopCloser(strings.NewReader(`{"errors":[{"code":99,"message":"Unable to verify your credentials"}]}`)),
+						}, nil
+					}
+
+					return NoopDoer(req)
+
+				}))
+
+				// when
+				_, err := api.FetchHashtag("#IoT", 5, 0)
+
+				// then
+				Expect(IsAuthError(err)).To(BeTrue())
+				Expect(err.(*APIError).URL).To(Equal(TokenURL))
+
+			})
+
 			It("should return an error if decoder fails", func() {
 
 				// given
@@ -167,7 +198,9 @@ var _ = Describe("API", func() {
 				_, err := api.FetchHashtag("#IoT", 5, 0)
 
 				// then
-				Expect(err).To(Not(BeNil()))
+				Expect(err).To(BeAssignableToTypeOf(&APIError{}))
+				Expect(err.(*APIError).StatusCode).To(Equal(400))
+				Expect(err.(*APIError).Body).To(Equal("Error: 400"))
 
 			})
 
@@ -206,6 +239,89 @@ var _ = Describe("API", func() {
 
 		})
 
+		Context("when rate limited", func() {
+
+			It("should wait for the window to reset and retry after a 429", func() {
+
+				// given
+				now := time.Unix(1540000000, 0)
+				limiter := NewRateLimiter()
+				// the window resets 10ms from now
+				limiter.SetClock(func() time.Time { return now.Add(-10 * time.Millisecond) })
+
+				calls := 0
+
+				api := NewAPI("key", "secret")
+				api.SetBearerToken("bearerToken")
+				api.SetRateLimiter(limiter)
+				api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+
+					calls++
+
+					if calls == 1 {
+						return &http.Response{
+							StatusCode: http.StatusTooManyRequests,
+							Header:     rateLimitHeader(450, 0, now),
+							Body:       ioutil.NopCloser(strings.NewReader(`{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`)),
+						}, nil
+					}
+
+					return &http.Response{
+						StatusCode: 200,
+						Header:     rateLimitHeader(450, 449, now.Add(15*time.Minute)),
+						Body:       ioutil.NopCloser(strings.NewReader(`{"statuses": []}`)),
+					}, nil
+
+				}))
+
+				// when
+				_, err := api.FetchHashtag("#IoT", 5, 0)
+
+				// then
+				Expect(err).To(BeNil())
+				Expect(calls).To(Equal(2))
+
+				window, ok := api.RateLimit()
+				Expect(ok).To(BeTrue())
+				Expect(window.Remaining).To(Equal(449))
+
+			})
+
+			It("should return an *APIError after MaxRateLimitedAttempts consecutive 429s", func() {
+
+				// given
+				now := time.Unix(1540000000, 0)
+				limiter := NewRateLimiter()
+				limiter.SetClock(func() time.Time { return now.Add(-10 * time.Millisecond) })
+
+				calls := 0
+
+				api := NewAPI("key", "secret")
+				api.SetBearerToken("bearerToken")
+				api.SetRateLimiter(limiter)
+				api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+
+					calls++
+
+					return &http.Response{
+						StatusCode: http.StatusTooManyRequests,
+						Header:     rateLimitHeader(450, 0, now),
+						Body:       ioutil.NopCloser(strings.NewReader(`{"errors":[{"code":88,"message":"Rate limit exceeded"}]}`)),
+					}, nil
+
+				}))
+
+				// when
+				_, err := api.FetchHashtag("#IoT", 5, 0)
+
+				// then
+				Expect(IsRateLimited(err)).To(BeTrue())
+				Expect(calls).To(Equal(MaxRateLimitedAttempts))
+
+			})
+
+		})
+
 		Describe("TokenRequest", func() {
 
 			It("Should have body of grant_type=client_credentials", func() {
@@ -429,4 +545,416 @@ var _ = Describe("API", func() {
 
 	})
 
+	Describe("NewAPIWithOptions()", func() {
+
+		It("Should send requests to the configured BaseURL with the configured User-Agent", func() {
+
+			// given
+			var paths, userAgents []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				paths = append(paths, r.URL.Path)
+				userAgents = append(userAgents, r.Header.Get("User-Agent"))
+
+				switch r.URL.Path {
+				case "/oauth2/token":
+					fmt.Fprint(w, `{"access_token": "authCode"}`)
+				case "/1.1/search/tweets.json":
+					fmt.Fprint(w, `{"statuses": [{"id_str": "12345"}]}`)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+
+			}))
+			defer server.Close()
+
+			api := NewAPIWithOptions("key", "secret", Options{
+				BaseURL:   server.URL,
+				UserAgent: "meshify-test",
+			})
+
+			// when
+			resp, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.Statuses).To(HaveLen(1))
+			Expect(paths).To(Equal([]string{"/oauth2/token", "/1.1/search/tweets.json"}))
+			Expect(userAgents).To(Equal([]string{"meshify-test", "meshify-test"}))
+
+		})
+
+		It("Should return an error when the server does not respond within the Timeout", func() {
+
+			// given
+			done := make(chan struct{})
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-done
+			}))
+			defer server.Close()
+			defer close(done)
+
+			api := NewAPIWithOptions("key", "secret", Options{
+				BaseURL: server.URL,
+				Timeout: 50 * time.Millisecond,
+			})
+			api.SetBearerToken("bearerToken")
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(Not(BeNil()))
+
+		})
+
+	})
+
+	Describe("Bearer token", func() {
+
+		It("Should be acquired exactly once by concurrent FetchHashtag calls", func() {
+
+			// given
+			var tokenRequests int32
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				switch r.URL.Path {
+				case "/oauth2/token":
+					atomic.AddInt32(&tokenRequests, 1)
+					fmt.Fprint(w, `{"access_token": "authCode"}`)
+				default:
+					fmt.Fprint(w, `{"statuses": []}`)
+				}
+
+			}))
+			defer server.Close()
+
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+			wg := &sync.WaitGroup{}
+
+			// when
+			for x := 0; x < 10; x++ {
+
+				wg.Add(1)
+
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					_, err := api.FetchHashtag("#IoT", 5, 0)
+					Expect(err).To(BeNil())
+				}()
+
+			}
+
+			wg.Wait()
+
+			// then
+			Expect(atomic.LoadInt32(&tokenRequests)).To(Equal(int32(1)))
+
+		})
+
+		It("Should be re-acquired when the search endpoint reports an invalid or expired token", func() {
+
+			// given
+			var authorizations []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				switch r.URL.Path {
+				case "/oauth2/token":
+					fmt.Fprint(w, `{"access_token": "freshToken"}`)
+				default:
+
+					authorizations = append(authorizations, r.Header.Get("Authorization"))
+
+					if r.Header.Get("Authorization") != "Bearer freshToken" {
+						w.WriteHeader(http.StatusUnauthorized)
+						fmt.Fprint(w, `{"errors":[{"code":89,"message":"Invalid or expired token."}]}`)
+						return
+					}
+
+					fmt.Fprint(w, `{"statuses": []}`)
+
+				}
+
+			}))
+			defer server.Close()
+
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+			api.SetBearerToken("expiredToken")
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(authorizations).To(Equal([]string{"Bearer expiredToken", "Bearer freshToken"}))
+
+		})
+
+		It("Should only be re-acquired once per request", func() {
+
+			// given
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				switch r.URL.Path {
+				case "/oauth2/token":
+					fmt.Fprint(w, `{"access_token": "authCode"}`)
+				default:
+					w.WriteHeader(http.StatusUnauthorized)
+					fmt.Fprint(w, `{"errors":[{"code":89,"message":"Invalid or expired token."}]}`)
+				}
+
+			}))
+			defer server.Close()
+
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(IsAuthError(err)).To(BeTrue())
+
+		})
+
+		It("Should be revoked by InvalidateToken", func() {
+
+			// given
+			var invalidated url.Values
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				switch r.URL.Path {
+				case "/oauth2/invalidate_token":
+					r.ParseForm()
+					invalidated = r.PostForm
+					fmt.Fprint(w, `{"access_token": "bearerToken"}`)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+
+			}))
+			defer server.Close()
+
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+			api.SetBearerToken("bearerToken")
+
+			// when
+			err := api.InvalidateToken()
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(invalidated.Get("access_token")).To(Equal("bearerToken"))
+
+		})
+
+	})
+
+	Describe("API.FetchHashtagContext()", func() {
+
+		It("Should abort the in-flight request when ctx is cancelled", func() {
+
+			// given
+			done := make(chan struct{})
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				<-done
+			}))
+			defer server.Close()
+			defer close(done)
+
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+			api.SetBearerToken("bearerToken")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			// when
+			_, err := api.FetchHashtagContext(ctx, "#IoT", 5, 0)
+
+			// then
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+
+		})
+
+	})
+
+	Describe("API.FetchHashtagRange()", func() {
+
+		It("Should bound the search with since_id and max_id", func() {
+
+			// given
+			var query url.Values
+
+			api := NewAPI("key", "secret")
+			api.SetBearerToken("bearerToken")
+			api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				query = req.URL.Query()
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"statuses": []}`)),
+				}, nil
+			}))
+
+			// when
+			_, err := api.FetchHashtagRange(context.Background(), "#IoT", 5, 100, 200)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(query.Get("since_id")).To(Equal("100"))
+			Expect(query.Get("max_id")).To(Equal("200"))
+
+		})
+
+	})
+
+	Describe("API.FetchResults()", func() {
+
+		It("Should follow the query string with count overridden, and decode the search_metadata", func() {
+
+			// given
+			var query url.Values
+
+			api := NewAPI("key", "secret")
+			api.SetBearerToken("bearerToken")
+			api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				query = req.URL.Query()
+				return &http.Response{
+					StatusCode: 200,
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"statuses": [{"id_str": "12344"}],
+						"search_metadata": {
+							"completed_in": 0.035,
+							"max_id": 1050118621198921728,
+							"next_results": "?max_id=12343&q=%23IoT&count=1&include_entities=1",
+							"query": "%23IoT",
+							"refresh_url": "?since_id=12345&q=%23IoT&include_entities=1",
+							"count": 1,
+							"since_id": 0
+						}
+					}`)),
+				}, nil
+			}))
+
+			// when
+			resp, err := api.FetchResults(context.Background(), "?max_id=12344&q=%23IoT&count=100&include_entities=1", 1)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(query.Get("max_id")).To(Equal("12344"))
+			Expect(query.Get("q")).To(Equal("#IoT"))
+			Expect(query.Get("count")).To(Equal("1"))
+			Expect(resp.Statuses).To(HaveLen(1))
+			Expect(resp.SearchMetadata).To(Equal(SearchMetadata{
+				MaxID:       1050118621198921728,
+				NextResults: "?count=1&include_entities=1&max_id=12343&q=%23IoT",
+				RefreshURL:  "?since_id=12345&q=%23IoT&include_entities=1",
+				Count:       1,
+				CompletedIn: 0.035,
+				Query:       "%23IoT",
+			}))
+
+		})
+
+		It("Should keep every parameter of the search in NextResults, taking only the max_id from Twitter", func() {
+
+			// given
+			var queries []url.Values
+
+			api := NewAPI("key", "secret")
+			api.SetBearerToken("bearerToken")
+			api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				queries = append(queries, req.URL.Query())
+				return &http.Response{
+					StatusCode: 200,
+					Body: ioutil.NopCloser(strings.NewReader(`{
+						"statuses": [{"id_str": "12344"}],
+						"search_metadata": {"next_results": "?max_id=12343&q=%23IoT&count=100&include_entities=1"}
+					}`)),
+				}, nil
+			}))
+
+			resp, err := api.FetchSearch(context.Background(), SearchQuery{Hashtags: []string{"#IoT"}, Lang: "en"}, 100, 5, 0)
+			Expect(err).To(BeNil())
+
+			// when
+			_, err = api.FetchResults(context.Background(), resp.SearchMetadata.NextResults, 100)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(queries).To(HaveLen(2))
+			Expect(queries[1].Get("q")).To(Equal(queries[0].Get("q")))
+			Expect(queries[1].Get("lang")).To(Equal("en"))
+			Expect(queries[1].Get("since_id")).To(Equal("5"))
+			Expect(queries[1].Get("include_entities")).To(Equal(queries[0].Get("include_entities")))
+			Expect(queries[1].Get("max_id")).To(Equal("12343"))
+
+		})
+
+	})
+
+	Describe("Options.TweetMode", func() {
+
+		var (
+			query url.Values
+			api   *API
+		)
+
+		BeforeEach(func() {
+
+			api = NewAPIWithOptions("key", "secret", Options{TweetMode: TweetModeExtended})
+			api.SetBearerToken("bearerToken")
+			api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				query = req.URL.Query()
+				return &http.Response{
+					StatusCode: 200,
+					Body:       ioutil.NopCloser(strings.NewReader(`{"statuses": []}`)),
+				}, nil
+			}))
+
+		})
+
+		It("Should be sent with a search that does not set its own", func() {
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(query.Get("tweet_mode")).To(Equal("extended"))
+
+		})
+
+		It("Should not override the TweetMode of the SearchQuery", func() {
+
+			// given
+			search := SearchQuery{Hashtags: []string{"#IoT"}, TweetMode: TweetModeCompat}
+
+			// when
+			_, err := api.FetchSearch(context.Background(), search, 5, 0, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(query.Get("tweet_mode")).To(Equal("compat"))
+
+		})
+
+		It("Should be added to followed results that do not carry it", func() {
+
+			// when
+			_, err := api.FetchResults(context.Background(), "?max_id=12344&q=%23IoT&count=100", 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(query.Get("tweet_mode")).To(Equal("extended"))
+
+		})
+
+	})
+
 })
@@ -0,0 +1,331 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator authorizes each request made by an API
+type Authenticator interface {
+	// Authenticate sets the Authorization header of req, once it has been built and just before it is sent
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// ExpiringAuthenticator is an Authenticator whose credentials can expire or be invalidated. When a request is rejected
+// because of them, Expire is called with the request, which is then authenticated and sent once more.
+type ExpiringAuthenticator interface {
+	Authenticator
+	Expire(req *http.Request)
+}
+
+// AuthenticatorFunc is a function impl of Authenticator
+type AuthenticatorFunc func(ctx context.Context, req *http.Request) error
+
+// Authenticate implements Authenticator
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, req *http.Request) error {
+	return f(ctx, req)
+}
+
+// preparer is implemented by Authenticators whose credentials do not depend on the request they authorize, so they can
+// be acquired before it is built
+type preparer interface {
+	prepare(ctx context.Context) error
+}
+
+// authenticatorKey is the context key of the Authenticator a request made by an API was authorized with
+type authenticatorKey struct{}
+
+// reauthenticate returns a copy of req authorized once more by the Authenticator it was first authorized with, for a
+// request that is sent again, so that each attempt carries a new OAuth 1.0a nonce and timestamp. req is returned as it
+// is if it was not made by an API.
+func reauthenticate(req *http.Request) (*http.Request, error) {
+
+	auth, ok := req.Context().Value(authenticatorKey{}).(Authenticator)
+
+	if !ok {
+		return req, nil
+	}
+
+	next := req.Clone(req.Context())
+
+	if err := auth.Authenticate(req.Context(), next); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+
+}
+
+// bearerAuthenticator is the default Authenticator of an API. It authorizes requests with an app-only bearer token,
+// acquired from oauth2/token with the consumer key and secret of the API on first use, and again once it expires (see:
+// https://developer.twitter.com/en/docs/authentication/oauth-2-0/application-only).
+type bearerAuthenticator struct {
+	api   *API
+	mu    sync.Mutex
+	token string
+}
+
+// Authenticate implements Authenticator. Concurrent callers share one token acquisition.
+func (b *bearerAuthenticator) Authenticate(ctx context.Context, req *http.Request) error {
+
+	token, err := b.acquire(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", authorization(token))
+
+	return nil
+
+}
+
+// prepare implements preparer, acquiring the token ahead of the request
+func (b *bearerAuthenticator) prepare(ctx context.Context) error {
+
+	_, err := b.acquire(ctx)
+
+	return err
+
+}
+
+// acquire returns the cached token, acquiring one first if there is none
+func (b *bearerAuthenticator) acquire(ctx context.Context) (string, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.token == "" {
+
+		token, err := b.api.newBearerToken(ctx)
+
+		if err != nil {
+			return "", err
+		}
+
+		b.token = token
+
+	}
+
+	return b.token, nil
+
+}
+
+// Expire implements ExpiringAuthenticator, discarding the token req was authorized with, unless another caller already
+// replaced it
+func (b *bearerAuthenticator) Expire(req *http.Request) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if authorization(b.token) == req.Header.Get("Authorization") {
+		b.token = ""
+	}
+
+}
+
+// setToken replaces the cached token
+func (b *bearerAuthenticator) setToken(token string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.token = token
+
+}
+
+// invalidate revokes the cached token via oauth2/invalidate_token
+func (b *bearerAuthenticator) invalidate() error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.token == "" {
+		return nil
+	}
+
+	if err := b.api.invalidateToken(b.token); err != nil {
+		return err
+	}
+
+	b.token = ""
+
+	return nil
+
+}
+
+// NewOAuth1Authenticator is a constructor for OAuth1Authenticator
+//
+// consumerKey: Consumer API Key
+// consumerSecret: Consumer API Secret Key
+// accessToken: Access Token of the user the requests are made on behalf of
+// accessTokenSecret: Access Token Secret of the user
+func NewOAuth1Authenticator(consumerKey string, consumerSecret string, accessToken string, accessTokenSecret string) *OAuth1Authenticator {
+	return &OAuth1Authenticator{
+		consumerKey:       consumerKey,
+		consumerSecret:    consumerSecret,
+		accessToken:       accessToken,
+		accessTokenSecret: accessTokenSecret,
+		now:               time.Now,
+		nonce:             randomNonce,
+	}
+}
+
+// OAuth1Authenticator is an Authenticator that signs each request with OAuth 1.0a HMAC-SHA1, on behalf of a user (see:
+// https://developer.twitter.com/en/docs/authentication/oauth-1-0a/authorizing-a-request). User context requests have
+// rate limits of their own, per user, rather than sharing the limits of the app.
+type OAuth1Authenticator struct {
+	consumerKey       string
+	consumerSecret    string
+	accessToken       string
+	accessTokenSecret string
+	now               func() time.Time
+	nonce             func() string
+}
+
+// SetClock setter for the clock the oauth_timestamp is taken from. This is for testing purposes
+func (o *OAuth1Authenticator) SetClock(now func() time.Time) {
+	o.now = now
+}
+
+// SetNonce setter for the source of oauth_nonce. This is for testing purposes
+func (o *OAuth1Authenticator) SetNonce(nonce func() string) {
+	o.nonce = nonce
+}
+
+// Authenticate implements Authenticator. The signature covers the method, url, query parameters and, if the body is
+// form encoded, the body parameters of req.
+func (o *OAuth1Authenticator) Authenticate(ctx context.Context, req *http.Request) error {
+
+	oauthParams := map[string]string{
+		"oauth_consumer_key":     o.consumerKey,
+		"oauth_nonce":            o.nonce(),
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        fmt.Sprintf("%d", o.now().Unix()),
+		"oauth_token":            o.accessToken,
+		"oauth_version":          "1.0",
+	}
+
+	params, err := requestParams(req)
+
+	if err != nil {
+		return err
+	}
+
+	for k, v := range oauthParams {
+		params.Add(k, v)
+	}
+
+	oauthParams["oauth_signature"] = o.signature(req.Method, req.URL, params)
+
+	keys := make([]string, 0, len(oauthParams))
+
+	for k := range oauthParams {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	header := make([]string, len(keys))
+
+	for i, k := range keys {
+		header[i] = fmt.Sprintf(`%s="%s"`, percentEncode(k), percentEncode(oauthParams[k]))
+	}
+
+	req.Header.Set("Authorization", "OAuth "+strings.Join(header, ", "))
+
+	return nil
+
+}
+
+// signature returns the HMAC-SHA1 signature of the request (see:
+// https://developer.twitter.com/en/docs/authentication/oauth-1-0a/creating-a-signature)
+func (o *OAuth1Authenticator) signature(method string, u *url.URL, params url.Values) string {
+
+	// each key and value is encoded, then sorted by key and value
+	var pairs []string
+
+	for k, values := range params {
+		for _, v := range values {
+			pairs = append(pairs, percentEncode(k)+"="+percentEncode(v))
+		}
+	}
+
+	sort.Strings(pairs)
+
+	baseURL := strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + u.EscapedPath()
+
+	base := strings.ToUpper(method) + "&" + percentEncode(baseURL) + "&" + percentEncode(strings.Join(pairs, "&"))
+	key := percentEncode(o.consumerSecret) + "&" + percentEncode(o.accessTokenSecret)
+
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(base))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+}
+
+// requestParams returns the query parameters of req, along with its body parameters if the body is form encoded. The
+// body is restored so it can still be sent.
+func requestParams(req *http.Request) (url.Values, error) {
+
+	params := url.Values{}
+
+	for k, v := range req.URL.Query() {
+		params[k] = append(params[k], v...)
+	}
+
+	if req.Body == nil || req.Body == http.NoBody || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return params, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	form, err := url.ParseQuery(string(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range form {
+		params[k] = append(params[k], v...)
+	}
+
+	return params, nil
+
+}
+
+// percentEncode encodes s as RFC 3986 requires, leaving only unreserved characters as they are
+func percentEncode(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// randomNonce returns a random, single use oauth_nonce
+func randomNonce() string {
+
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+
+}
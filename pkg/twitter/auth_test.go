@@ -0,0 +1,289 @@
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expiringAuthenticator authorizes requests with "Token <n>", where n is the number of times it has been expired
+type expiringAuthenticator struct {
+	expired int
+}
+
+func (e *expiringAuthenticator) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", fmt.Sprintf("Token %d", e.expired))
+	return nil
+}
+
+func (e *expiringAuthenticator) Expire(req *http.Request) {
+	e.expired++
+}
+
+// oauthParams returns the parameters of the OAuth 1.0a Authorization header of req
+func oauthParams(req *http.Request) map[string]string {
+
+	params := map[string]string{}
+
+	for _, param := range strings.Split(strings.TrimPrefix(req.Header.Get("Authorization"), "OAuth "), ", ") {
+		kv := strings.SplitN(param, "=", 2)
+		value, _ := url.PathUnescape(strings.Trim(kv[1], `"`))
+		params[kv[0]] = value
+	}
+
+	return params
+
+}
+
+// resign signs the request received by a server at baseURL once more, with the nonce and timestamp it was sent with
+func resign(baseURL string, received *http.Request) string {
+
+	params := oauthParams(received)
+	timestamp, _ := strconv.ParseInt(params["oauth_timestamp"], 10, 64)
+
+	auth := NewOAuth1Authenticator("key", "secret", "token", "tokenSecret")
+	auth.SetNonce(func() string { return params["oauth_nonce"] })
+	auth.SetClock(func() time.Time { return time.Unix(timestamp, 0) })
+
+	req, err := http.NewRequest(received.Method, baseURL+received.URL.RequestURI(), nil)
+	Expect(err).To(BeNil())
+	Expect(auth.Authenticate(context.Background(), req)).To(Succeed())
+
+	return req.Header.Get("Authorization")
+
+}
+
+var _ = Describe("Authenticator", func() {
+
+	Describe("OAuth1Authenticator.Authenticate()", func() {
+
+		// the example from https://developer.twitter.com/en/docs/authentication/oauth-1-0a/creating-a-signature
+		const body = "status=Hello%20Ladies%20%2b%20Gentlemen%2c%20a%20signed%20OAuth%20request%21"
+
+		var (
+			auth *OAuth1Authenticator
+			req  *http.Request
+		)
+
+		BeforeEach(func() {
+
+			auth = NewOAuth1Authenticator(
+				"xvz1evFS4wEEPTGEFPHBog",
+				"kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw",
+				"370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb",
+				"LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE",
+			)
+
+			auth.SetClock(func() time.Time { return time.Unix(1318622958, 0) })
+			auth.SetNonce(func() string { return "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg" })
+
+			var err error
+
+			req, err = http.NewRequest("POST", "https://api.twitter.com/1.1/statuses/update.json?include_entities=true", strings.NewReader(body))
+			Expect(err).To(BeNil())
+
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		})
+
+		It("Should sign the request with HMAC-SHA1", func() {
+
+			// when
+			err := auth.Authenticate(context.Background(), req)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(req.Header.Get("Authorization")).To(Equal("OAuth " + strings.Join([]string{
+				`oauth_consumer_key="xvz1evFS4wEEPTGEFPHBog"`,
+				`oauth_nonce="kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg"`,
+				`oauth_signature="hCtSmYh%2BiHYCEqBWrE7C7hYmtUk%3D"`,
+				`oauth_signature_method="HMAC-SHA1"`,
+				`oauth_timestamp="1318622958"`,
+				`oauth_token="370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb"`,
+				`oauth_version="1.0"`,
+			}, ", ")))
+
+		})
+
+		It("Should leave the body to be sent", func() {
+
+			// when
+			err := auth.Authenticate(context.Background(), req)
+
+			// then
+			Expect(err).To(BeNil())
+
+			sent, err := ioutil.ReadAll(req.Body)
+			Expect(err).To(BeNil())
+			Expect(string(sent)).To(Equal(body))
+
+		})
+
+	})
+
+	Describe("Options.Authenticator", func() {
+
+		var (
+			requests []*http.Request
+			statuses []int
+			server   *httptest.Server
+		)
+
+		BeforeEach(func() {
+
+			requests = nil
+			statuses = nil
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				requests = append(requests, r)
+
+				// the statuses given by a test are responded with first, in order
+				if len(requests) <= len(statuses) {
+					w.WriteHeader(statuses[len(requests)-1])
+					return
+				}
+
+				if r.Header.Get("Authorization") == "Token 0" {
+					w.WriteHeader(http.StatusUnauthorized)
+					fmt.Fprint(w, `{"errors":[{"code":89,"message":"Invalid or expired token."}]}`)
+					return
+				}
+
+				fmt.Fprint(w, `{"statuses": [], "search_metadata": {}}`)
+
+			}))
+
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("Should authorize each request instead of a bearer token", func() {
+
+			// given
+			auth := NewOAuth1Authenticator("key", "secret", "token", "tokenSecret")
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL, Authenticator: auth})
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].URL.Path).To(Equal("/1.1/search/tweets.json"))
+			Expect(requests[0].Header.Get("Authorization")).To(HavePrefix("OAuth "))
+			Expect(requests[0].Header.Get("Authorization")).To(ContainSubstring(`oauth_token="token"`))
+
+		})
+
+		It("Should return the error of an AuthenticatorFunc without sending the request", func() {
+
+			// given
+			authErr := errors.New("authenticate error")
+
+			api := NewAPIWithOptions("key", "secret", Options{
+				BaseURL: server.URL,
+				Authenticator: AuthenticatorFunc(func(ctx context.Context, req *http.Request) error {
+					return authErr
+				}),
+			})
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(Equal(authErr))
+			Expect(requests).To(BeEmpty())
+
+		})
+
+		It("Should expire an ExpiringAuthenticator and retry once when its credentials are rejected", func() {
+
+			// given
+			auth := &expiringAuthenticator{}
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL, Authenticator: auth})
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(auth.expired).To(Equal(1))
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[1].Header.Get("Authorization")).To(Equal("Token 1"))
+
+		})
+
+		It("Should sign a request retried after a transient failure with a new nonce", func() {
+
+			// given
+			statuses = []int{http.StatusServiceUnavailable}
+
+			auth := NewOAuth1Authenticator("key", "secret", "token", "tokenSecret")
+			api := NewAPIWithOptions("key", "secret", Options{
+				BaseURL:       server.URL,
+				Authenticator: auth,
+				RetryPolicy:   &RetryPolicy{MaxAttempts: 2, RetryableStatus: []int{http.StatusServiceUnavailable}},
+			})
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(requests).To(HaveLen(2))
+			Expect(oauthParams(requests[1])["oauth_nonce"]).NotTo(Equal(oauthParams(requests[0])["oauth_nonce"]))
+			Expect(requests[1].Header.Get("Authorization")).To(Equal(resign(server.URL, requests[1])))
+
+		})
+
+		It("Should sign a request resent after a 429 with a new nonce", func() {
+
+			// given
+			statuses = []int{http.StatusTooManyRequests}
+
+			now := time.Unix(1540000000, 0)
+			limiter := NewRateLimiter()
+			// the window resets 10ms from now
+			limiter.SetClock(func() time.Time { return now.Add(-10 * time.Millisecond) })
+
+			auth := NewOAuth1Authenticator("key", "secret", "token", "tokenSecret")
+			api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL, Authenticator: auth, RateLimiter: limiter})
+			api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+
+				resp, err := http.DefaultClient.Do(req)
+
+				if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+					resp.Header = rateLimitHeader(450, 0, now)
+				}
+
+				return resp, err
+
+			}))
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(requests).To(HaveLen(2))
+			Expect(oauthParams(requests[1])["oauth_nonce"]).NotTo(Equal(oauthParams(requests[0])["oauth_nonce"]))
+			Expect(requests[1].Header.Get("Authorization")).To(Equal(resign(server.URL, requests[1])))
+
+		})
+
+	})
+
+})
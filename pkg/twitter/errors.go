@@ -0,0 +1,211 @@
+package twitter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Twitter API error codes (see: https://developer.twitter.com/en/docs/basics/response-codes)
+const (
+	// ErrCodeAuthFailed is returned when the request could not be authenticated
+	ErrCodeAuthFailed = 32
+
+	// ErrCodeSuspended is returned when the account or app has been suspended
+	ErrCodeSuspended = 64
+
+	// ErrCodeRateLimitExceeded is returned when the rate limit window has been used up
+	ErrCodeRateLimitExceeded = 88
+
+	// ErrCodeInvalidToken is returned when the bearer token is invalid or expired
+	ErrCodeInvalidToken = 89
+
+	// ErrCodeUnableToVerify is returned when the consumer key and secret could not be verified
+	ErrCodeUnableToVerify = 99
+
+	// ErrCodeBadAuthData is returned when the request carried missing or malformed authentication data
+	ErrCodeBadAuthData = 215
+
+	// ErrCodeLocked is returned when the account has been temporarily locked
+	ErrCodeLocked = 326
+)
+
+// ErrorDetail is a single entry of the errors array returned by the Twitter API
+type ErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError is returned for Twitter API responses with a status >= 400
+type APIError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+
+	// Errors holds the decoded {"errors": [...]} payload. Empty if the body was not in that format.
+	Errors []ErrorDetail
+
+	// RateLimit is the rate limit window reported by the response headers, if any
+	RateLimit RateLimit
+
+	// URL is the url of the request that failed
+	URL string
+
+	// Body is the raw response body
+	Body string
+}
+
+// Problem is a single entry of the errors array returned by the Twitter API v2 (see:
+// https://developer.twitter.com/en/support/twitter-api/error-troubleshooting)
+type Problem struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Type   string `json:"type"`
+
+	// Value and ID identify the stream rule a problem refers to, if any
+	Value string `json:"value"`
+	ID    string `json:"id"`
+}
+
+// ProblemError is returned when a Twitter API v2 response reports problems alongside, or in place of, its data
+type ProblemError struct {
+	Problems []Problem
+}
+
+// Error implements error
+func (e *ProblemError) Error() string {
+
+	problems := make([]string, len(e.Problems))
+
+	for i, p := range e.Problems {
+
+		problem := p.Title
+
+		if p.Detail != "" {
+			problem += ": " + p.Detail
+		}
+
+		if p.Value != "" {
+			problem += fmt.Sprintf(" (%s)", p.Value)
+		}
+
+		problems[i] = problem
+
+	}
+
+	return "twitter: " + strings.Join(problems, "; ")
+
+}
+
+// newAPIError builds an APIError from a failed response and its already-read body
+func newAPIError(resp *http.Response, url string, body []byte) *APIError {
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		URL:        url,
+		Body:       string(body),
+	}
+
+	var payload struct {
+		Errors []ErrorDetail `json:"errors"`
+	}
+
+	if err := json.Unmarshal(body, &payload); err == nil {
+		apiErr.Errors = payload.Errors
+	}
+
+	if window, ok := parseRateLimit(resp.Header); ok {
+		apiErr.RateLimit = window
+	}
+
+	return apiErr
+
+}
+
+// Error implements error
+func (e *APIError) Error() string {
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("twitter: %d %s", e.StatusCode, http.StatusText(e.StatusCode)))
+
+	if e.URL != "" {
+		sb.WriteString(fmt.Sprintf(" (%s)", e.URL))
+	}
+
+	if len(e.Errors) < 1 {
+
+		if e.Body != "" {
+			sb.WriteString(": ")
+			sb.WriteString(e.Body)
+		}
+
+		return sb.String()
+
+	}
+
+	for i, detail := range e.Errors {
+
+		if i == 0 {
+			sb.WriteString(": ")
+		} else {
+			sb.WriteString("; ")
+		}
+
+		sb.WriteString(fmt.Sprintf("[%d] %s", detail.Code, detail.Message))
+
+	}
+
+	return sb.String()
+
+}
+
+// HasCode reports whether the response carried the Twitter error code
+func (e *APIError) HasCode(code int) bool {
+
+	for _, detail := range e.Errors {
+		if detail.Code == code {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// IsRateLimited reports whether the request was rejected because the rate limit window was used up
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.HasCode(ErrCodeRateLimitExceeded)
+}
+
+// IsAuthError reports whether the request was rejected because of bad credentials or an invalid token
+func (e *APIError) IsAuthError() bool {
+	return e.StatusCode == http.StatusUnauthorized ||
+		e.HasCode(ErrCodeAuthFailed) ||
+		e.HasCode(ErrCodeInvalidToken) ||
+		e.HasCode(ErrCodeUnableToVerify) ||
+		e.HasCode(ErrCodeBadAuthData)
+}
+
+// IsSuspended reports whether the request was rejected because the account or app is suspended or locked
+func (e *APIError) IsSuspended() bool {
+	return e.HasCode(ErrCodeSuspended) || e.HasCode(ErrCodeLocked)
+}
+
+// IsRateLimited reports whether err is, or wraps, a rate limited *APIError
+func IsRateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.IsRateLimited()
+}
+
+// IsAuthError reports whether err is, or wraps, an authentication *APIError
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.IsAuthError()
+}
+
+// IsSuspended reports whether err is, or wraps, a suspended account *APIError
+func IsSuspended(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.IsSuspended()
+}
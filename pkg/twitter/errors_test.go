@@ -0,0 +1,87 @@
+package twitter_test
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Errors", func() {
+
+	fetchWithResponse := func(resp *http.Response) error {
+
+		api := NewAPI("key", "secret")
+		api.SetBearerToken("bearerToken")
+		api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return resp, nil
+		}))
+
+		_, err := api.FetchHashtag("#IoT", 5, 0)
+
+		return err
+
+	}
+
+	Describe("APIError", func() {
+
+		It("Should decode the Twitter errors payload, status, url and rate limit reset", func() {
+
+			// given
+			reset := time.Unix(1540000000, 0)
+
+			// when
+			err := fetchWithResponse(&http.Response{
+				StatusCode: 400,
+				Header:     rateLimitHeader(450, 10, reset),
+				Body:       ioutil.NopCloser(strings.NewReader(`{"errors":[{"code":215,"message":"Bad Authentication data."}]}`)),
+			})
+
+			// then
+			apiErr, ok := err.(*APIError)
+
+			Expect(ok).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(400))
+			Expect(apiErr.Errors).To(Equal([]ErrorDetail{{Code: 215, Message: "Bad Authentication data."}}))
+			Expect(apiErr.RateLimit.Reset.Equal(reset)).To(BeTrue())
+			Expect(apiErr.URL).To(HavePrefix(SearchURL))
+			Expect(apiErr.Error()).To(ContainSubstring("[215] Bad Authentication data."))
+
+		})
+
+		It("Should classify auth, rate limit and suspension errors", func() {
+
+			// given
+			authErr := &APIError{StatusCode: 403, Errors: []ErrorDetail{{Code: ErrCodeBadAuthData}}}
+			rateLimitErr := &APIError{StatusCode: 420, Errors: []ErrorDetail{{Code: ErrCodeRateLimitExceeded}}}
+			suspendedErr := &APIError{StatusCode: 403, Errors: []ErrorDetail{{Code: ErrCodeSuspended}}}
+
+			// then
+			Expect(IsAuthError(authErr)).To(BeTrue())
+			Expect(IsRateLimited(authErr)).To(BeFalse())
+			Expect(IsRateLimited(rateLimitErr)).To(BeTrue())
+			Expect(IsAuthError(rateLimitErr)).To(BeFalse())
+			Expect(IsSuspended(suspendedErr)).To(BeTrue())
+			Expect(IsSuspended(authErr)).To(BeFalse())
+
+		})
+
+		It("Should be detected through wrapped errors", func() {
+
+			// given
+			err := fmt.Errorf("fetching #IoT: %w", &APIError{StatusCode: 401})
+
+			// then
+			Expect(IsAuthError(err)).To(BeTrue())
+			Expect(IsAuthError(errors.New("401"))).To(BeFalse())
+
+		})
+
+	})
+
+})
@@ -0,0 +1,151 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxLookupIDs is the maximum number of tweet ids per statuses/lookup request
+	MaxLookupIDs = 100
+
+	lookupPath = "1.1/statuses/lookup.json"
+)
+
+// LookupAPIResponse represents the tweets returned by statuses/lookup
+type LookupAPIResponse struct {
+	// Statuses holds each tweet found, exactly as returned, in the order its id was requested
+	Statuses []map[string]interface{}
+
+	// Tweets holds the typed form of each of Statuses, in the same order
+	Tweets []Tweet
+
+	// Missing holds the ids of the tweets that were not found, because they have been deleted, their author is
+	// protected or suspended, or they never existed
+	Missing []int64
+}
+
+// LookupTweets fetches the tweets with the given ids via statuses/lookup, for example to rehydrate a dataset of tweet
+// ids (see: https://developer.twitter.com/en/docs/tweets/post-and-engage/api-reference/get-statuses-lookup). The ids
+// are requested in batches of MaxLookupIDs. Repeated ids are only requested once.
+//
+// Requests are scheduled against the statuses/lookup rate limit window (see API).
+//
+// ids: the ids of the tweets to fetch
+func (a *API) LookupTweets(ctx context.Context, ids []int64) (LookupAPIResponse, error) {
+
+	var (
+		result LookupAPIResponse
+		seen   = map[int64]bool{}
+		unique []int64
+	)
+
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	for start := 0; start < len(unique); start += MaxLookupIDs {
+
+		end := start + MaxLookupIDs
+
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		batch, err := a.lookupBatch(ctx, unique[start:end])
+
+		if err != nil {
+			return LookupAPIResponse{}, err
+		}
+
+		result.Statuses = append(result.Statuses, batch.Statuses...)
+		result.Tweets = append(result.Tweets, batch.Tweets...)
+		result.Missing = append(result.Missing, batch.Missing...)
+
+	}
+
+	return result, nil
+
+}
+
+// lookupBatch fetches up to MaxLookupIDs tweets with a single request
+func (a *API) lookupBatch(ctx context.Context, ids []int64) (LookupAPIResponse, error) {
+
+	// with map=true, missing tweets are returned as null rather than left out
+	var mapped struct {
+		ID map[string]json.RawMessage `json:"id"`
+	}
+
+	err := a.fetchVia(ctx, func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		return a.doLimitedBy(ctx, a.lookupLimiter, req)
+	}, func() (*http.Request, error) {
+		return a.lookupRequest(ids)
+	}, &mapped)
+
+	if err != nil {
+		return LookupAPIResponse{}, err
+	}
+
+	var (
+		result LookupAPIResponse
+		found  []json.RawMessage
+	)
+
+	for _, id := range ids {
+
+		status := mapped.ID[strconv.FormatInt(id, 10)]
+
+		if len(status) == 0 || bytes.Equal(bytes.TrimSpace(status), []byte("null")) {
+			result.Missing = append(result.Missing, id)
+			continue
+		}
+
+		found = append(found, status)
+
+	}
+
+	if result.Statuses, result.Tweets, err = decodeStatuses(found); err != nil {
+		return LookupAPIResponse{}, err
+	}
+
+	return result, nil
+
+}
+
+func (a *API) lookupRequest(ids []int64) (*http.Request, error) {
+
+	req, err := a.requestFactory("GET", a.endpoint(lookupPath), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	idStrs := make([]string, len(ids))
+
+	for i, id := range ids {
+		idStrs[i] = strconv.FormatInt(id, 10)
+	}
+
+	params := url.Values{}
+	params.Set("id", strings.Join(idStrs, ","))
+	params.Set("map", "true")
+	params.Set("include_entities", "true")
+
+	if a.tweetMode != "" {
+		params.Set("tweet_mode", string(a.tweetMode))
+	}
+
+	req.URL.RawQuery = params.Encode()
+	a.setUserAgent(req)
+
+	return req, nil
+
+}
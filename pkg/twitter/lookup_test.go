@@ -0,0 +1,122 @@
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("API.LookupTweets()", func() {
+
+	var (
+		requests []*http.Request
+		server   *httptest.Server
+		api      *API
+	)
+
+	BeforeEach(func() {
+
+		requests = nil
+
+		// every odd id exists
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			requests = append(requests, r)
+
+			mapped := map[string]interface{}{}
+
+			for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+
+				mapped[id] = nil
+
+				if id[len(id)-1]%2 == 1 {
+					mapped[id] = map[string]interface{}{"id": json.Number(id), "id_str": id, "text": "tweet " + id}
+				}
+
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": mapped})
+
+		}))
+
+		api = NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+		api.SetBearerToken("bearerToken")
+
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should return the tweets found, in the order requested, and the ids that were not", func() {
+
+		// when
+		resp, err := api.LookupTweets(context.Background(), []int64{5, 2, 3, 4})
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal("/1.1/statuses/lookup.json"))
+		Expect(requests[0].URL.Query().Get("id")).To(Equal("5,2,3,4"))
+		Expect(requests[0].URL.Query().Get("map")).To(Equal("true"))
+		Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer bearerToken"))
+
+		Expect(resp.Statuses).To(HaveLen(2))
+		Expect(resp.Statuses[0]["id_str"]).To(Equal("5"))
+		Expect(resp.Statuses[0]["id"]).To(Equal(json.Number("5")))
+		Expect(resp.Tweets[1].ID).To(Equal(int64(3)))
+		Expect(resp.Tweets[1].Text).To(Equal("tweet 3"))
+		Expect(resp.Missing).To(Equal([]int64{2, 4}))
+
+	})
+
+	It("Should request at most MaxLookupIDs ids at a time, each only once", func() {
+
+		// given
+		var ids []int64
+
+		for id := int64(1); id <= 250; id++ {
+			ids = append(ids, id, id)
+		}
+
+		// when
+		resp, err := api.LookupTweets(context.Background(), ids)
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(requests).To(HaveLen(3))
+
+		for i, n := range []int{100, 100, 50} {
+			Expect(strings.Split(requests[i].URL.Query().Get("id"), ",")).To(HaveLen(n), fmt.Sprintf("request %d", i))
+		}
+
+		Expect(resp.Statuses).To(HaveLen(125))
+		Expect(resp.Missing).To(HaveLen(125))
+
+	})
+
+	It("Should return an *APIError when the lookup fails", func() {
+
+		// given
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":[{"code":200,"message":"Forbidden."}]}`)
+		})
+
+		// when
+		_, err := api.LookupTweets(context.Background(), []int64{1})
+
+		// then
+		apiErr, ok := err.(*APIError)
+		Expect(ok).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusForbidden))
+
+	})
+
+})
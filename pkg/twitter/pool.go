@@ -0,0 +1,243 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrEmptyPool is returned by NewPool when it is given no fetchers
+var ErrEmptyPool = errors.New("twitter: pool has no credentials")
+
+// Credential is the consumer key and secret of a Twitter app
+type Credential struct {
+	Key    string `json:"key"`
+	Secret string `json:"secret"`
+}
+
+// Fetcher is the search interface shared by API, V2API and Pool. RateLimit reports the rate limit window its searches
+// are made against.
+type Fetcher interface {
+	FetchHashtag(hashtag string, count int, maxID int64) (SearchAPIResponse, error)
+	FetchHashtagContext(ctx context.Context, hashtag string, count int, maxID int64) (SearchAPIResponse, error)
+	FetchHashtagRange(ctx context.Context, hashtag string, count int, sinceID int64, maxID int64) (SearchAPIResponse, error)
+	FetchSearch(ctx context.Context, query SearchQuery, count int, sinceID int64, maxID int64) (SearchAPIResponse, error)
+	FetchResults(ctx context.Context, results string, count int) (SearchAPIResponse, error)
+	RateLimit() (window RateLimit, ok bool)
+}
+
+// NewCredentialPool is a constructor for a Pool of one API per credential, each with a rate limit window of its own
+//
+// credentials: the consumer key and secret of each app
+// opts: configures every API. RateLimiter and Authenticator are ignored, as they belong to one set of credentials.
+func NewCredentialPool(credentials []Credential, opts Options) (*Pool, error) {
+	return newCredentialPool(credentials, opts, func(api *API) Fetcher {
+		return api
+	})
+}
+
+// NewV2CredentialPool is NewCredentialPool for the API v2 recent search, with one V2API per credential
+//
+// credentials: the consumer key and secret of each app
+// opts: configures every API. RateLimiter and Authenticator are ignored, as they belong to one set of credentials.
+// v2Opts: the fields requested with each search. RateLimiter is ignored, for the same reason.
+func NewV2CredentialPool(credentials []Credential, opts Options, v2Opts V2Options) (*Pool, error) {
+
+	v2Opts.RateLimiter = nil
+
+	return newCredentialPool(credentials, opts, func(api *API) Fetcher {
+		return NewV2API(api, v2Opts)
+	})
+
+}
+
+// newCredentialPool returns a Pool of the Fetcher search returns for the API of each credential
+func newCredentialPool(credentials []Credential, opts Options, search func(*API) Fetcher) (*Pool, error) {
+
+	opts.RateLimiter = nil
+	opts.Authenticator = nil
+
+	fetchers := make([]Fetcher, len(credentials))
+
+	for i, credential := range credentials {
+		fetchers[i] = search(NewAPIWithOptions(credential.Key, credential.Secret, opts))
+	}
+
+	return NewPool(fetchers...)
+
+}
+
+// NewPool is a constructor for Pool
+//
+// fetchers: the APIs to route searches between, each searching against a rate limit window of its own
+func NewPool(fetchers ...Fetcher) (*Pool, error) {
+
+	if len(fetchers) == 0 {
+		return nil, ErrEmptyPool
+	}
+
+	members := make([]*poolMember, len(fetchers))
+
+	for i, fetcher := range fetchers {
+		members[i] = &poolMember{fetcher: fetcher}
+	}
+
+	return &Pool{
+		members: members,
+		now:     time.Now,
+	}, nil
+
+}
+
+// Pool routes each search to whichever of several APIs has the most requests left in its rate limit window, so that
+// the searches of several Twitter apps add up to more than the limit of any one. It has the same Fetch methods as API.
+//
+// An API whose window has not been reported yet, or has reset, is assumed to have a whole window left. When every
+// window is used up, the search goes to the API whose window resets first, and waits for it. Ties go to the API with
+// the fewest searches in flight, then the fewest made.
+type Pool struct {
+	mu      sync.Mutex
+	members []*poolMember
+	now     func() time.Time
+}
+
+type poolMember struct {
+	fetcher  Fetcher
+	inFlight int
+	uses     int
+}
+
+// SetClock setter for the clock rate limit windows are compared against. This is for testing purposes
+func (p *Pool) SetClock(now func() time.Time) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.now = now
+
+}
+
+// RateLimit returns the rate limit window of the API the next search would be routed to. ok is false until that API
+// has seen a response carrying rate limit headers.
+func (p *Pool) RateLimit() (window RateLimit, ok bool) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pick().fetcher.RateLimit()
+
+}
+
+// FetchHashtag is API.FetchHashtag, made with the API that has the most headroom
+func (p *Pool) FetchHashtag(hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return p.FetchHashtagContext(context.Background(), hashtag, count, maxID)
+}
+
+// FetchHashtagContext is API.FetchHashtagContext, made with the API that has the most headroom
+func (p *Pool) FetchHashtagContext(ctx context.Context, hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return p.do(func(f Fetcher) (SearchAPIResponse, error) {
+		return f.FetchHashtagContext(ctx, hashtag, count, maxID)
+	})
+}
+
+// FetchHashtagRange is API.FetchHashtagRange, made with the API that has the most headroom
+func (p *Pool) FetchHashtagRange(ctx context.Context, hashtag string, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+	return p.do(func(f Fetcher) (SearchAPIResponse, error) {
+		return f.FetchHashtagRange(ctx, hashtag, count, sinceID, maxID)
+	})
+}
+
+// FetchSearch is API.FetchSearch, made with the API that has the most headroom
+func (p *Pool) FetchSearch(ctx context.Context, query SearchQuery, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+	return p.do(func(f Fetcher) (SearchAPIResponse, error) {
+		return f.FetchSearch(ctx, query, count, sinceID, maxID)
+	})
+}
+
+// FetchResults is API.FetchResults, made with the API that has the most headroom. The page may be fetched with
+// different credentials than the page before it.
+func (p *Pool) FetchResults(ctx context.Context, results string, count int) (SearchAPIResponse, error) {
+	return p.do(func(f Fetcher) (SearchAPIResponse, error) {
+		return f.FetchResults(ctx, results, count)
+	})
+}
+
+// do calls fetch with the member that has the most headroom, counting it as in flight until fetch returns
+func (p *Pool) do(fetch func(Fetcher) (SearchAPIResponse, error)) (SearchAPIResponse, error) {
+
+	p.mu.Lock()
+
+	member := p.pick()
+	member.inFlight++
+	member.uses++
+
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		member.inFlight--
+		p.mu.Unlock()
+	}()
+
+	return fetch(member.fetcher)
+
+}
+
+// pick returns the member with the most headroom. p.mu must be held.
+func (p *Pool) pick() *poolMember {
+
+	now := p.now()
+
+	var (
+		best         *poolMember
+		bestHeadroom int
+		bestReset    time.Time
+	)
+
+	for _, member := range p.members {
+
+		headroom, reset := p.headroom(member, now)
+
+		if best == nil || better(member, headroom, reset, best, bestHeadroom, bestReset) {
+			best, bestHeadroom, bestReset = member, headroom, reset
+		}
+
+	}
+
+	return best
+
+}
+
+// headroom returns how many requests the member has left in its window, and when the window resets. The requests of an
+// unknown or reset window are unlimited, as far as the pool can tell. Searches in flight have already been taken from
+// the requests left, as RateLimiter.Wait reserves each request as it starts.
+func (p *Pool) headroom(member *poolMember, now time.Time) (int, time.Time) {
+
+	window, ok := member.fetcher.RateLimit()
+
+	if !ok || !now.Before(window.Reset) {
+		return math.MaxInt32, time.Time{}
+	}
+
+	return window.Remaining, window.Reset
+
+}
+
+// better reports whether member a should be picked over member b
+func better(a *poolMember, aHeadroom int, aReset time.Time, b *poolMember, bHeadroom int, bReset time.Time) bool {
+
+	switch {
+	case aHeadroom != bHeadroom && (aHeadroom > 0 || bHeadroom > 0):
+		return aHeadroom > bHeadroom
+	case aHeadroom <= 0 && !aReset.Equal(bReset):
+		// every window is used up, so wait for the one that resets first
+		return aReset.Before(bReset)
+	case a.inFlight != b.inFlight:
+		return a.inFlight < b.inFlight
+	}
+
+	return a.uses < b.uses
+
+}
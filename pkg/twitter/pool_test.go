@@ -0,0 +1,305 @@
+package twitter_test
+
+import (
+	"context"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// windowFetcher reports a fixed rate limit window and counts the searches made with it. When reserve is set, each
+// search uses up a request of the window as it starts, as RateLimiter.Wait does. When release is set, each search
+// blocks until it is closed.
+type windowFetcher struct {
+	mu       sync.Mutex
+	window   RateLimit
+	known    bool
+	searches int
+	reserve  bool
+	release  chan struct{}
+}
+
+func (w *windowFetcher) FetchHashtag(hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return w.FetchHashtagContext(context.Background(), hashtag, count, maxID)
+}
+
+func (w *windowFetcher) FetchHashtagContext(ctx context.Context, hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return w.FetchHashtagRange(ctx, hashtag, count, 0, maxID)
+}
+
+func (w *windowFetcher) FetchHashtagRange(ctx context.Context, hashtag string, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+	return w.FetchSearch(ctx, HashtagQuery(hashtag), count, sinceID, maxID)
+}
+
+func (w *windowFetcher) FetchSearch(ctx context.Context, query SearchQuery, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+	return w.search()
+}
+
+func (w *windowFetcher) FetchResults(ctx context.Context, results string, count int) (SearchAPIResponse, error) {
+	return w.search()
+}
+
+func (w *windowFetcher) search() (SearchAPIResponse, error) {
+
+	w.mu.Lock()
+
+	w.searches++
+
+	if w.reserve {
+		w.window.Remaining--
+	}
+
+	w.mu.Unlock()
+
+	if w.release != nil {
+		<-w.release
+	}
+
+	return SearchAPIResponse{}, nil
+
+}
+
+func (w *windowFetcher) searchCount() int {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.searches
+
+}
+
+func (w *windowFetcher) RateLimit() (RateLimit, bool) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.window, w.known
+
+}
+
+var _ = Describe("Pool", func() {
+
+	now := time.Unix(1500000000, 0)
+
+	Describe("NewPool()", func() {
+
+		It("Should require at least one fetcher", func() {
+
+			// when
+			_, err := NewPool()
+
+			// then
+			Expect(err).To(Equal(ErrEmptyPool))
+
+		})
+
+	})
+
+	Describe("Pool.FetchHashtag()", func() {
+
+		It("Should route each search to the fetcher with the most requests left", func() {
+
+			// given
+			low := &windowFetcher{window: RateLimit{Remaining: 10, Reset: now.Add(time.Minute)}, known: true}
+			high := &windowFetcher{window: RateLimit{Remaining: 90, Reset: now.Add(time.Minute)}, known: true}
+
+			pool, err := NewPool(low, high)
+			Expect(err).To(BeNil())
+			pool.SetClock(func() time.Time { return now })
+
+			// when
+			_, err = pool.FetchHashtag("#IoT", 100, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(low.searches).To(Equal(0))
+			Expect(high.searches).To(Equal(1))
+
+		})
+
+		It("Should route searches still in flight by the requests each window has left once they are reserved", func() {
+
+			// given
+			release := make(chan struct{})
+			more := &windowFetcher{
+				window:  RateLimit{Remaining: 10, Reset: now.Add(time.Minute)},
+				known:   true,
+				reserve: true,
+				release: release,
+			}
+			fewer := &windowFetcher{
+				window:  RateLimit{Remaining: 8, Reset: now.Add(time.Minute)},
+				known:   true,
+				reserve: true,
+				release: release,
+			}
+
+			pool, err := NewPool(more, fewer)
+			Expect(err).To(BeNil())
+			pool.SetClock(func() time.Time { return now })
+
+			var wg sync.WaitGroup
+
+			// when
+			for i := 1; i <= 6; i++ {
+
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+					pool.FetchHashtag("#IoT", 100, 0)
+				}()
+
+				// each search starts before the next is routed
+				Eventually(func() int { return more.searchCount() + fewer.searchCount() }).Should(Equal(i))
+
+			}
+
+			// then
+			Expect(more.searchCount()).To(Equal(4))
+			Expect(fewer.searchCount()).To(Equal(2))
+
+			close(release)
+			wg.Wait()
+
+		})
+
+		It("Should assume unknown and reset windows are whole, taking turns between them", func() {
+
+			// given
+			unknown := &windowFetcher{}
+			reset := &windowFetcher{window: RateLimit{Remaining: 0, Reset: now.Add(-time.Second)}, known: true}
+			known := &windowFetcher{window: RateLimit{Remaining: 100, Reset: now.Add(time.Minute)}, known: true}
+
+			pool, err := NewPool(unknown, reset, known)
+			Expect(err).To(BeNil())
+			pool.SetClock(func() time.Time { return now })
+
+			// when
+			for i := 0; i < 4; i++ {
+				_, err = pool.FetchHashtag("#IoT", 100, 0)
+				Expect(err).To(BeNil())
+			}
+
+			// then
+			Expect(unknown.searches).To(Equal(2))
+			Expect(reset.searches).To(Equal(2))
+			Expect(known.searches).To(Equal(0))
+
+		})
+
+		It("Should wait for the window that resets first once every window is used up", func() {
+
+			// given
+			later := &windowFetcher{window: RateLimit{Remaining: 0, Reset: now.Add(10 * time.Minute)}, known: true}
+			sooner := &windowFetcher{window: RateLimit{Remaining: 0, Reset: now.Add(time.Minute)}, known: true}
+
+			pool, err := NewPool(later, sooner)
+			Expect(err).To(BeNil())
+			pool.SetClock(func() time.Time { return now })
+
+			// when
+			_, err = pool.FetchHashtag("#IoT", 100, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(sooner.searches).To(Equal(1))
+
+			window, ok := pool.RateLimit()
+			Expect(ok).To(BeTrue())
+			Expect(window.Reset).To(Equal(now.Add(time.Minute)))
+
+		})
+
+	})
+
+	Describe("NewCredentialPool()", func() {
+
+		It("Should search with the credentials that have the most requests left in their own window", func() {
+
+			// given
+			remaining := map[string]int{"Bearer key1": 1, "Bearer key2": 100}
+			var searchedWith []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				if r.URL.Path == "/oauth2/token" {
+					key, _, _ := r.BasicAuth()
+					fmt.Fprintf(w, `{"access_token": "%s"}`, key)
+					return
+				}
+
+				auth := r.Header.Get("Authorization")
+				searchedWith = append(searchedWith, auth)
+
+				remaining[auth]--
+
+				w.Header().Set("x-rate-limit-limit", "180")
+				w.Header().Set("x-rate-limit-remaining", fmt.Sprint(remaining[auth]))
+				w.Header().Set("x-rate-limit-reset", fmt.Sprint(time.Now().Add(15*time.Minute).Unix()))
+				fmt.Fprint(w, `{"statuses": [], "search_metadata": {}}`)
+
+			}))
+			defer server.Close()
+
+			pool, err := NewCredentialPool([]Credential{{Key: "key1", Secret: "secret1"}, {Key: "key2", Secret: "secret2"}}, Options{BaseURL: server.URL})
+			Expect(err).To(BeNil())
+
+			// when
+			for i := 0; i < 4; i++ {
+				_, err = pool.FetchHashtag("#IoT", 100, 0)
+				Expect(err).To(BeNil())
+			}
+
+			// then
+			Expect(searchedWith).To(Equal([]string{"Bearer key1", "Bearer key2", "Bearer key2", "Bearer key2"}))
+
+		})
+
+	})
+
+	Describe("NewV2CredentialPool()", func() {
+
+		It("Should make recent searches with the credentials of each app", func() {
+
+			// given
+			var searchedWith []string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				if r.URL.Path == "/oauth2/token" {
+					key, _, _ := r.BasicAuth()
+					fmt.Fprintf(w, `{"access_token": "%s"}`, key)
+					return
+				}
+
+				Expect(r.URL.Path).To(Equal("/2/tweets/search/recent"))
+				searchedWith = append(searchedWith, r.Header.Get("Authorization"))
+
+				fmt.Fprint(w, `{"data": [], "meta": {"result_count": 0}}`)
+
+			}))
+			defer server.Close()
+
+			pool, err := NewV2CredentialPool([]Credential{{Key: "key1", Secret: "secret1"}, {Key: "key2", Secret: "secret2"}}, Options{BaseURL: server.URL}, V2Options{})
+			Expect(err).To(BeNil())
+
+			// when
+			for i := 0; i < 2; i++ {
+				_, err = pool.FetchHashtag("#IoT", 10, 0)
+				Expect(err).To(BeNil())
+			}
+
+			// then
+			Expect(searchedWith).To(ConsistOf("Bearer key1", "Bearer key2"))
+
+		})
+
+	})
+
+})
@@ -0,0 +1,370 @@
+package twitter
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxQueryLength is the longest q the Search API accepts, once url encoded
+	MaxQueryLength = 500
+
+	// MaxQueryLengthV2 is the longest query the API v2 recent search accepts
+	MaxQueryLengthV2 = 512
+
+	// queryDateFormat is the format of the since: and until: operators
+	queryDateFormat = "2006-01-02"
+)
+
+var (
+	// ErrEmptyQuery is returned by FetchSearch for a SearchQuery with no search terms
+	ErrEmptyQuery = errors.New("twitter: search query has no search terms")
+
+	// ErrQueryTooLong is returned by FetchSearch for a SearchQuery whose q exceeds MaxQueryLength
+	ErrQueryTooLong = fmt.Errorf("twitter: search query exceeds %d characters", MaxQueryLength)
+
+	// ErrQueryTooLongV2 is returned by V2API.FetchSearch for a SearchQuery whose query exceeds MaxQueryLengthV2
+	ErrQueryTooLongV2 = fmt.Errorf("twitter: search query exceeds %d characters", MaxQueryLengthV2)
+
+	// ErrUnsupportedV2 is returned by V2API.FetchSearch for a SearchQuery using fields the API v2 recent search does
+	// not support
+	ErrUnsupportedV2 = errors.New("twitter: search query is not supported by the API v2 recent search")
+)
+
+// ResultType selects which results the Search API returns
+type ResultType string
+
+const (
+	// ResultTypeMixed returns both popular and real time results. This is the API default.
+	ResultTypeMixed ResultType = "mixed"
+
+	// ResultTypeRecent returns only the most recent results
+	ResultTypeRecent ResultType = "recent"
+
+	// ResultTypePopular returns only the most popular results
+	ResultTypePopular ResultType = "popular"
+)
+
+// TweetMode selects how tweets longer than 140 characters are returned
+type TweetMode string
+
+const (
+	// TweetModeCompat truncates text to 140 characters. This is the API default.
+	TweetModeCompat TweetMode = "compat"
+
+	// TweetModeExtended returns the full text in full_text
+	TweetModeExtended TweetMode = "extended"
+)
+
+// SearchQuery describes a Search API request (see:
+// https://developer.twitter.com/en/docs/tweets/rules-and-filtering/overview/standard-operators). Fields combine with
+// AND. Where a field lists several values, they combine with OR, except for Keywords and, unless AnyHashtag is set,
+// Hashtags.
+type SearchQuery struct {
+	// Keywords must all appear. A keyword containing spaces is searched as an exact phrase.
+	Keywords []string
+
+	// Hashtags must all appear, or any of them if AnyHashtag is set. The leading '#' is optional.
+	Hashtags   []string
+	AnyHashtag bool
+
+	// From matches tweets sent by any of these accounts. The leading '@' is optional, as for To and Mentions.
+	From []string
+
+	// To matches replies to any of these accounts
+	To []string
+
+	// Mentions matches tweets mentioning any of these accounts
+	Mentions []string
+
+	// ExcludeRetweets and ExcludeReplies drop retweets and replies
+	ExcludeRetweets bool
+	ExcludeReplies  bool
+
+	// Media and Links keep only tweets with media or links
+	Media bool
+	Links bool
+
+	// MinFaves keeps only tweets with at least this many likes. Ignored if zero.
+	MinFaves int
+
+	// Since and Until keep only tweets created on or after Since, and before Until. Only the UTC date is used. Ignored
+	// if zero.
+	Since time.Time
+	Until time.Time
+
+	// Geocode keeps only tweets by users located within a radius of a point, as "latitude,longitude,radius" where the
+	// radius is in "mi" or "km" (ex: "37.781157,-122.398720,1mi")
+	Geocode string
+
+	// Lang keeps only tweets in this ISO 639-1 language
+	Lang string
+
+	// ResultType defaults to ResultTypeMixed
+	ResultType ResultType
+
+	// TweetMode defaults to TweetModeCompat
+	TweetMode TweetMode
+
+	// IncludeEntities includes the entities node of each tweet
+	IncludeEntities bool
+}
+
+// HashtagQuery returns the SearchQuery used by FetchHashtag: English tweets with hashtag, without entities
+func HashtagQuery(hashtag string) SearchQuery {
+	return SearchQuery{
+		Hashtags: []string{hashtag},
+		Lang:     "en",
+	}
+}
+
+// Q renders the q parameter
+func (s SearchQuery) Q() string {
+
+	var filters []string
+
+	if s.ExcludeRetweets {
+		filters = append(filters, "-filter:retweets")
+	}
+
+	if s.ExcludeReplies {
+		filters = append(filters, "-filter:replies")
+	}
+
+	if s.Media {
+		filters = append(filters, "filter:media")
+	}
+
+	if s.Links {
+		filters = append(filters, "filter:links")
+	}
+
+	if s.MinFaves > 0 {
+		filters = append(filters, fmt.Sprintf("min_faves:%d", s.MinFaves))
+	}
+
+	if !s.Since.IsZero() {
+		filters = append(filters, "since:"+s.Since.UTC().Format(queryDateFormat))
+	}
+
+	if !s.Until.IsZero() {
+		filters = append(filters, "until:"+s.Until.UTC().Format(queryDateFormat))
+	}
+
+	return s.render(filters)
+
+}
+
+// QueryV2 renders the query parameter of the API v2 recent search (see:
+// https://developer.twitter.com/en/docs/twitter-api/tweets/search/integrate/build-a-query). Lang is an operator in
+// API v2, while Since and Until are sent as the start_time and end_time parameters.
+func (s SearchQuery) QueryV2() string {
+
+	var filters []string
+
+	if s.ExcludeRetweets {
+		filters = append(filters, "-is:retweet")
+	}
+
+	if s.ExcludeReplies {
+		filters = append(filters, "-is:reply")
+	}
+
+	if s.Media {
+		filters = append(filters, "has:media")
+	}
+
+	if s.Links {
+		filters = append(filters, "has:links")
+	}
+
+	if s.Lang != "" {
+		filters = append(filters, "lang:"+s.Lang)
+	}
+
+	return s.render(filters)
+
+}
+
+// render combines the search terms with filters, each of which is ANDed on
+func (s SearchQuery) render(filters []string) string {
+
+	// each group is a list of alternatives, combined with OR
+	var groups [][]string
+
+	for _, keyword := range s.Keywords {
+		groups = append(groups, []string{phrase(keyword)})
+	}
+
+	hashtags := prefixAll("#", s.Hashtags)
+
+	if s.AnyHashtag {
+		groups = appendAny(groups, hashtags)
+	} else {
+		for _, hashtag := range hashtags {
+			groups = append(groups, []string{hashtag})
+		}
+	}
+
+	groups = appendAny(groups, operators("from:", trimAll("@", s.From)))
+	groups = appendAny(groups, operators("to:", trimAll("@", s.To)))
+	groups = appendAny(groups, prefixAll("@", s.Mentions))
+
+	for _, filter := range filters {
+		groups = append(groups, []string{filter})
+	}
+
+	terms := make([]string, len(groups))
+
+	for i, group := range groups {
+
+		terms[i] = strings.Join(group, " OR ")
+
+		// a lone OR group needs no parentheses
+		if len(group) > 1 && len(groups) > 1 {
+			terms[i] = "(" + terms[i] + ")"
+		}
+
+	}
+
+	return strings.Join(terms, " ")
+
+}
+
+// Params renders the query string parameters of the request, other than count, since_id and max_id
+func (s SearchQuery) Params() url.Values {
+
+	params := url.Values{}
+	params.Add("q", s.Q())
+
+	if s.Lang != "" {
+		params.Add("lang", s.Lang)
+	}
+
+	if s.ResultType != "" {
+		params.Add("result_type", string(s.ResultType))
+	}
+
+	if s.Geocode != "" {
+		params.Add("geocode", s.Geocode)
+	}
+
+	if s.TweetMode != "" {
+		params.Add("tweet_mode", string(s.TweetMode))
+	}
+
+	params.Add("include_entities", fmt.Sprintf("%v", s.IncludeEntities))
+
+	return params
+
+}
+
+// Validate returns ErrEmptyQuery or ErrQueryTooLong if the Search API would reject q
+func (s SearchQuery) Validate() error {
+
+	q := s.Q()
+
+	if q == "" {
+		return ErrEmptyQuery
+	}
+
+	if len(url.QueryEscape(q)) > MaxQueryLength {
+		return ErrQueryTooLong
+	}
+
+	return nil
+
+}
+
+// ValidateV2 returns ErrEmptyQuery, ErrQueryTooLongV2 or ErrUnsupportedV2 if the API v2 recent search would reject
+// the query. MinFaves, Geocode and ResultTypePopular have no API v2 equivalent. TweetMode and IncludeEntities are
+// ignored.
+func (s SearchQuery) ValidateV2() error {
+
+	switch {
+	case s.MinFaves > 0:
+		return fmt.Errorf("%w: min_faves", ErrUnsupportedV2)
+	case s.Geocode != "":
+		return fmt.Errorf("%w: geocode", ErrUnsupportedV2)
+	case s.ResultType == ResultTypePopular:
+		return fmt.Errorf("%w: result_type popular", ErrUnsupportedV2)
+	}
+
+	// a query of nothing but operators, such as lang:en, is rejected too
+	if s.render(nil) == "" {
+		return ErrEmptyQuery
+	}
+
+	if len(s.QueryV2()) > MaxQueryLengthV2 {
+		return ErrQueryTooLongV2
+	}
+
+	return nil
+
+}
+
+// phrase quotes keyword if it contains spaces
+func phrase(keyword string) string {
+
+	keyword = strings.Replace(keyword, `"`, "", -1)
+
+	if strings.ContainsAny(keyword, " \t") {
+		return `"` + keyword + `"`
+	}
+
+	return keyword
+
+}
+
+// prefixAll ensures each of values starts with prefix
+func prefixAll(prefix string, values []string) []string {
+
+	prefixed := make([]string, len(values))
+
+	for i, v := range values {
+		prefixed[i] = prefix + strings.TrimPrefix(v, prefix)
+	}
+
+	return prefixed
+
+}
+
+// trimAll removes prefix from each of values
+func trimAll(prefix string, values []string) []string {
+
+	trimmed := make([]string, len(values))
+
+	for i, v := range values {
+		trimmed[i] = strings.TrimPrefix(v, prefix)
+	}
+
+	return trimmed
+
+}
+
+// operators prefixes each of values with operator
+func operators(operator string, values []string) []string {
+
+	terms := make([]string, len(values))
+
+	for i, v := range values {
+		terms[i] = operator + v
+	}
+
+	return terms
+
+}
+
+// appendAny appends alternatives to groups as a single group, if there are any
+func appendAny(groups [][]string, alternatives []string) [][]string {
+
+	if len(alternatives) < 1 {
+		return groups
+	}
+
+	return append(groups, alternatives)
+
+}
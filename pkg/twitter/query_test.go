@@ -0,0 +1,180 @@
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ = Describe("SearchQuery", func() {
+
+	Describe("SearchQuery.Q()", func() {
+
+		It("Should render a single hashtag as-is", func() {
+			Expect(HashtagQuery("#IoT").Q()).To(Equal("#IoT"))
+			Expect(HashtagQuery("IoT").Q()).To(Equal("#IoT"))
+		})
+
+		It("Should combine fields with AND, and alternatives with OR", func() {
+
+			// given
+			q := SearchQuery{
+				Keywords:        []string{"sensor", "smart home"},
+				Hashtags:        []string{"IoT", "#IIoT"},
+				AnyHashtag:      true,
+				From:            []string{"@tniswong", "meshify"},
+				To:              []string{"support"},
+				Mentions:        []string{"twitter"},
+				ExcludeRetweets: true,
+				ExcludeReplies:  true,
+				Media:           true,
+				Links:           true,
+				MinFaves:        10,
+				Since:           time.Date(2019, 1, 2, 23, 0, 0, 0, time.UTC),
+				Until:           time.Date(2019, 1, 9, 0, 0, 0, 0, time.UTC),
+			}
+
+			// then
+			Expect(q.Q()).To(Equal(`sensor "smart home" (#IoT OR #IIoT) (from:tniswong OR from:meshify) to:support @twitter ` +
+				`-filter:retweets -filter:replies filter:media filter:links min_faves:10 since:2019-01-02 until:2019-01-09`))
+
+		})
+
+		It("Should require every hashtag unless AnyHashtag is set", func() {
+			Expect(SearchQuery{Hashtags: []string{"IoT", "IIoT"}}.Q()).To(Equal("#IoT #IIoT"))
+			Expect(SearchQuery{Hashtags: []string{"IoT", "IIoT"}, AnyHashtag: true}.Q()).To(Equal("#IoT OR #IIoT"))
+		})
+
+	})
+
+	Describe("SearchQuery.Params()", func() {
+
+		It("Should render the request parameters", func() {
+
+			// given
+			q := SearchQuery{
+				Hashtags:        []string{"IoT"},
+				Geocode:         "37.781157,-122.398720,1mi",
+				Lang:            "en",
+				ResultType:      ResultTypeRecent,
+				TweetMode:       TweetModeExtended,
+				IncludeEntities: true,
+			}
+
+			// when
+			params := q.Params()
+
+			// then
+			Expect(params.Get("q")).To(Equal("#IoT"))
+			Expect(params.Get("geocode")).To(Equal("37.781157,-122.398720,1mi"))
+			Expect(params.Get("lang")).To(Equal("en"))
+			Expect(params.Get("result_type")).To(Equal("recent"))
+			Expect(params.Get("tweet_mode")).To(Equal("extended"))
+			Expect(params.Get("include_entities")).To(Equal("true"))
+
+		})
+
+		It("Should leave out the optional parameters that are not set", func() {
+
+			// when
+			params := SearchQuery{Keywords: []string{"IoT"}}.Params()
+
+			// then
+			Expect(params).To(HaveLen(2))
+			Expect(params.Get("include_entities")).To(Equal("false"))
+
+		})
+
+	})
+
+	Describe("SearchQuery.Validate()", func() {
+
+		It("Should reject an empty query", func() {
+			Expect(SearchQuery{Lang: "en"}.Validate()).To(Equal(ErrEmptyQuery))
+		})
+
+		It("Should reject a query longer than MaxQueryLength", func() {
+			Expect(SearchQuery{Keywords: []string{strings.Repeat("a", MaxQueryLength+1)}}.Validate()).To(Equal(ErrQueryTooLong))
+		})
+
+	})
+
+	Describe("SearchQuery.QueryV2()", func() {
+
+		It("Should render the API v2 operators, with Lang as an operator", func() {
+
+			// given
+			q := SearchQuery{
+				Hashtags:        []string{"IoT"},
+				From:            []string{"meshify"},
+				ExcludeRetweets: true,
+				ExcludeReplies:  true,
+				Media:           true,
+				Links:           true,
+				Lang:            "en",
+				Since:           time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC),
+			}
+
+			// then
+			Expect(q.QueryV2()).To(Equal("#IoT from:meshify -is:retweet -is:reply has:media has:links lang:en"))
+
+		})
+
+	})
+
+	Describe("SearchQuery.ValidateV2()", func() {
+
+		It("Should reject a query of nothing but operators", func() {
+			Expect(SearchQuery{Lang: "en", ExcludeRetweets: true}.ValidateV2()).To(Equal(ErrEmptyQuery))
+		})
+
+		It("Should reject a query longer than MaxQueryLengthV2", func() {
+			Expect(SearchQuery{Keywords: []string{strings.Repeat("a", MaxQueryLengthV2+1)}}.ValidateV2()).To(Equal(ErrQueryTooLongV2))
+		})
+
+		It("Should reject the fields the recent search does not support", func() {
+
+			// given
+			queries := []SearchQuery{
+				{Hashtags: []string{"IoT"}, MinFaves: 10},
+				{Hashtags: []string{"IoT"}, Geocode: "37.781157,-122.398720,1mi"},
+				{Hashtags: []string{"IoT"}, ResultType: ResultTypePopular},
+			}
+
+			// then
+			for _, q := range queries {
+				Expect(errors.Is(q.ValidateV2(), ErrUnsupportedV2)).To(BeTrue())
+			}
+
+		})
+
+	})
+
+	Describe("API.FetchSearch()", func() {
+
+		It("Should not send an invalid query", func() {
+
+			// given
+			api := NewAPI("key", "secret")
+			api.SetBearerToken("bearerToken")
+			api.SetClient(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				Fail("should not be called")
+				return nil, nil
+			}))
+
+			// when
+			_, err := api.FetchSearch(context.Background(), SearchQuery{}, 5, 0, 0)
+
+			// then
+			Expect(err).To(Equal(ErrEmptyQuery))
+
+		})
+
+	})
+
+})
@@ -0,0 +1,184 @@
+package twitter
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimitWindow is how long to wait after a 429 response that carries no x-rate-limit-reset header, or one
+	// that is not in the future
+	DefaultRateLimitWindow = 15 * time.Minute
+
+	// MaxRateLimitedAttempts is the number of consecutive 429 responses a request is retried through before giving up
+	MaxRateLimitedAttempts = 3
+
+	rateLimitLimitHeader     = "x-rate-limit-limit"
+	rateLimitRemainingHeader = "x-rate-limit-remaining"
+	rateLimitResetHeader     = "x-rate-limit-reset"
+)
+
+// RateLimit is a snapshot of a Twitter API rate limit window
+type RateLimit struct {
+	// Limit is the number of requests allowed per window. Zero if unknown.
+	Limit int
+
+	// Remaining is the number of requests left in the current window
+	Remaining int
+
+	// Reset is when the current window ends. Zero if unknown.
+	Reset time.Time
+}
+
+// NewRateLimiter is a constructor for RateLimiter
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		now: time.Now,
+	}
+}
+
+// RateLimiter schedules requests according to the x-rate-limit-* headers returned by the Twitter API. It is safe for
+// concurrent use, so a single RateLimiter may be shared by every goroutine issuing requests against the same window.
+type RateLimiter struct {
+	mu     sync.Mutex
+	window RateLimit
+	known  bool
+	now    func() time.Time
+}
+
+// SetClock setter for the clock. This is for testing purposes
+func (r *RateLimiter) SetClock(now func() time.Time) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.now = now
+
+}
+
+// State returns the current rate limit window. ok is false until a response carrying rate limit headers has been seen.
+func (r *RateLimiter) State() (window RateLimit, ok bool) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.window, r.known
+
+}
+
+// Wait reserves a request in the current window, blocking until the window resets if none remain. Returns ctx.Err()
+// if ctx is done before a request could be reserved.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+
+	for {
+
+		r.mu.Lock()
+
+		if !r.known || r.window.Remaining > 0 || !r.now().Before(r.window.Reset) {
+
+			if r.known && r.window.Remaining > 0 {
+				r.window.Remaining--
+			}
+
+			r.mu.Unlock()
+			return nil
+
+		}
+
+		reset := r.window.Reset
+		timer := time.NewTimer(reset.Sub(r.now()))
+
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+			r.expire(reset)
+		}
+
+	}
+
+}
+
+// Update records the rate limit window reported by the headers of a response. Headers without rate limit information
+// are ignored.
+func (r *RateLimiter) Update(header http.Header) {
+
+	window, ok := parseRateLimit(header)
+
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// responses to concurrent requests may arrive out of order, so within the same window trust the lowest count
+	if r.known && r.window.Reset.Equal(window.Reset) && r.window.Remaining < window.Remaining {
+		window.Remaining = r.window.Remaining
+	}
+
+	r.window = window
+	r.known = true
+
+}
+
+// Exhaust marks the current window as used up, as reported by a 429 response. If header has no reset time, or one that
+// has already passed, such as when the local clock runs ahead of Twitter's, the window is assumed to reset after
+// DefaultRateLimitWindow.
+func (r *RateLimiter) Exhaust(header http.Header) {
+
+	window, ok := parseRateLimit(header)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !ok || !window.Reset.After(r.now()) {
+		window.Reset = r.now().Add(DefaultRateLimitWindow)
+	}
+
+	window.Remaining = 0
+
+	r.window = window
+	r.known = true
+
+}
+
+// expire forgets the window ending at reset, once it has been waited out
+func (r *RateLimiter) expire(reset time.Time) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.window.Reset.Equal(reset) {
+		r.known = false
+	}
+
+}
+
+func parseRateLimit(header http.Header) (RateLimit, bool) {
+
+	remaining, err := strconv.Atoi(header.Get(rateLimitRemainingHeader))
+
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	window := RateLimit{Remaining: remaining}
+
+	if limit, err := strconv.Atoi(header.Get(rateLimitLimitHeader)); err == nil {
+		window.Limit = limit
+	}
+
+	if reset, err := strconv.ParseInt(header.Get(rateLimitResetHeader), 10, 64); err == nil {
+		window.Reset = time.Unix(reset, 0)
+	}
+
+	return window, true
+
+}
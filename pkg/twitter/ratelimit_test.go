@@ -0,0 +1,177 @@
+package twitter_test
+
+import (
+	"context"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"time"
+)
+
+func rateLimitHeader(limit int, remaining int, reset time.Time) http.Header {
+
+	h := http.Header{}
+	h.Set("x-rate-limit-limit", fmt.Sprint(limit))
+	h.Set("x-rate-limit-remaining", fmt.Sprint(remaining))
+	h.Set("x-rate-limit-reset", fmt.Sprint(reset.Unix()))
+
+	return h
+
+}
+
+var _ = Describe("RateLimiter", func() {
+
+	Describe("RateLimiter.Update()", func() {
+
+		It("Should parse the x-rate-limit-* headers", func() {
+
+			// given
+			reset := time.Unix(1540000000, 0)
+			limiter := NewRateLimiter()
+
+			// when
+			limiter.Update(rateLimitHeader(450, 449, reset))
+
+			// then
+			window, ok := limiter.State()
+
+			Expect(ok).To(BeTrue())
+			Expect(window.Limit).To(Equal(450))
+			Expect(window.Remaining).To(Equal(449))
+			Expect(window.Reset.Equal(reset)).To(BeTrue())
+
+		})
+
+		It("Should ignore headers without rate limit information", func() {
+
+			// given
+			limiter := NewRateLimiter()
+
+			// when
+			limiter.Update(http.Header{})
+
+			// then
+			_, ok := limiter.State()
+			Expect(ok).To(BeFalse())
+
+		})
+
+		It("Should keep the lowest remaining count within the same window", func() {
+
+			// given
+			reset := time.Unix(1540000000, 0)
+			limiter := NewRateLimiter()
+
+			// when
+			limiter.Update(rateLimitHeader(450, 10, reset))
+			limiter.Update(rateLimitHeader(450, 12, reset))
+
+			// then
+			window, _ := limiter.State()
+			Expect(window.Remaining).To(Equal(10))
+
+		})
+
+	})
+
+	Describe("RateLimiter.Wait()", func() {
+
+		It("Should not block while requests remain in the window", func() {
+
+			// given
+			limiter := NewRateLimiter()
+			limiter.Update(rateLimitHeader(450, 2, time.Now().Add(time.Hour)))
+
+			// when
+			err := limiter.Wait(context.Background())
+
+			// then
+			Expect(err).To(BeNil())
+
+			window, _ := limiter.State()
+			Expect(window.Remaining).To(Equal(1))
+
+		})
+
+		It("Should block until the window resets when no requests remain", func() {
+
+			// given
+			now := time.Unix(1540000000, 0)
+			limiter := NewRateLimiter()
+			limiter.SetClock(func() time.Time { return now })
+			limiter.Update(rateLimitHeader(450, 0, now.Add(time.Second)))
+
+			// when
+			start := time.Now()
+			err := limiter.Wait(context.Background())
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+
+		})
+
+		It("Should return ctx.Err() if ctx is done while waiting", func() {
+
+			// given
+			limiter := NewRateLimiter()
+			limiter.Update(rateLimitHeader(450, 0, time.Now().Add(time.Hour)))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// when
+			err := limiter.Wait(ctx)
+
+			// then
+			Expect(err).To(Equal(context.Canceled))
+
+		})
+
+	})
+
+	Describe("RateLimiter.Exhaust()", func() {
+
+		It("Should wait DefaultRateLimitWindow when no reset header is present", func() {
+
+			// given
+			now := time.Unix(1540000000, 0)
+			limiter := NewRateLimiter()
+			limiter.SetClock(func() time.Time { return now })
+
+			// when
+			limiter.Exhaust(http.Header{})
+
+			// then
+			window, ok := limiter.State()
+
+			Expect(ok).To(BeTrue())
+			Expect(window.Remaining).To(Equal(0))
+			Expect(window.Reset.Equal(now.Add(DefaultRateLimitWindow))).To(BeTrue())
+
+		})
+
+		It("Should wait DefaultRateLimitWindow when the reset header has already passed", func() {
+
+			// given
+			now := time.Unix(1540000000, 0)
+			limiter := NewRateLimiter()
+			limiter.SetClock(func() time.Time { return now })
+
+			// when
+			limiter.Exhaust(rateLimitHeader(450, 0, now.Add(-time.Minute)))
+
+			// then
+			window, ok := limiter.State()
+
+			Expect(ok).To(BeTrue())
+			Expect(window.Remaining).To(Equal(0))
+			Expect(window.Reset.Equal(now.Add(DefaultRateLimitWindow))).To(BeTrue())
+
+		})
+
+	})
+
+})
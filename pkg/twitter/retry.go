@@ -0,0 +1,181 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryPolicy retries 5xx gateway/server errors and transient network failures up to 4 attempts
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     4,
+	BaseDelay:       500 * time.Millisecond,
+	MaxDelay:        30 * time.Second,
+	Jitter:          0.5,
+	RetryableStatus: []int{500, 502, 503, 504},
+	RetryableError:  IsTransientError,
+}
+
+// RetryPolicy configures how a RetryDoer retries failed requests
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. Values < 2 disable retries.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. Each following retry doubles it.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+
+	// Jitter is the fraction [0, 1] of each delay that is randomized, to keep concurrent workers from retrying in step.
+	Jitter float64
+
+	// RetryableStatus lists the response status codes that are retried
+	RetryableStatus []int
+
+	// RetryableError reports whether a Doer error is retried. nil means errors are never retried.
+	RetryableError func(error) bool
+}
+
+// Delay returns the delay before the given retry attempt, where attempt 1 is the first retry
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+
+	if p.MaxDelay > 0 {
+		delay = math.Min(delay, float64(p.MaxDelay))
+	}
+
+	jitter := math.Max(0, math.Min(1, p.Jitter))
+
+	return time.Duration(delay*(1-jitter) + rand.Float64()*delay*jitter)
+
+}
+
+func (p RetryPolicy) retryable(resp *http.Response, err error) bool {
+
+	if err != nil {
+		return p.RetryableError != nil && p.RetryableError(err)
+	}
+
+	for _, status := range p.RetryableStatus {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// IsTransientError reports whether err is a network failure worth retrying: timeouts, connection resets and refusals,
+// and connections closed mid-response. Context cancellation is never transient.
+func IsTransientError(err error) bool {
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+
+}
+
+// NewRetryDoer is a constructor for RetryDoer
+//
+// doer: Doer that executes each attempt
+// policy: which failures to retry, and how long to wait between attempts
+func NewRetryDoer(doer Doer, policy RetryPolicy) *RetryDoer {
+	return &RetryDoer{
+		doer:   doer,
+		policy: policy,
+	}
+}
+
+// RetryDoer is a Doer that retries transient failures with exponential backoff and jitter
+type RetryDoer struct {
+	doer   Doer
+	policy RetryPolicy
+}
+
+// Do implements Doer
+//
+// Requests with a body are only retried when the body can be replayed via http.Request.GetBody. Requests made by an
+// API are authorized afresh for each retry. Waiting between attempts stops early if the request's context is done.
+func (r *RetryDoer) Do(req *http.Request) (*http.Response, error) {
+
+	attemptReq := req
+
+	for attempt := 1; ; attempt++ {
+
+		resp, err := r.doer.Do(attemptReq)
+
+		if attempt >= r.policy.MaxAttempts || !r.policy.retryable(resp, err) {
+			return resp, err
+		}
+
+		next, ok := rewind(req)
+
+		if !ok {
+			return resp, err
+		}
+
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(r.policy.Delay(attempt))
+
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if attemptReq, err = reauthenticate(next); err != nil {
+			return nil, err
+		}
+
+	}
+
+}
+
+// rewind returns a copy of req with a fresh body, or false if the body can not be replayed
+func rewind(req *http.Request) (*http.Request, bool) {
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+
+	if req.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := req.GetBody()
+
+	if err != nil {
+		return nil, false
+	}
+
+	next := req.WithContext(req.Context())
+	next.Body = body
+
+	return next, true
+
+}
@@ -0,0 +1,205 @@
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func statusResponse(status int) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+}
+
+var _ = Describe("Retry", func() {
+
+	policy := RetryPolicy{
+		MaxAttempts:     3,
+		BaseDelay:       time.Millisecond,
+		MaxDelay:        5 * time.Millisecond,
+		RetryableStatus: []int{500, 502, 503, 504},
+		RetryableError:  IsTransientError,
+	}
+
+	Describe("RetryDoer.Do()", func() {
+
+		It("Should retry retryable status codes until success", func() {
+
+			// given
+			statuses := []int{503, 502, 200}
+			calls := 0
+
+			doer := NewRetryDoer(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				resp := statusResponse(statuses[calls])
+				calls++
+				return resp, nil
+			}), policy)
+
+			req, _ := http.NewRequest("GET", SearchURL, nil)
+
+			// when
+			resp, err := doer.Do(req)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(calls).To(Equal(3))
+
+		})
+
+		It("Should not retry non-retryable status codes", func() {
+
+			// given
+			calls := 0
+
+			doer := NewRetryDoer(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				return statusResponse(403), nil
+			}), policy)
+
+			req, _ := http.NewRequest("GET", SearchURL, nil)
+
+			// when
+			resp, err := doer.Do(req)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(403))
+			Expect(calls).To(Equal(1))
+
+		})
+
+		It("Should give up after MaxAttempts and return the last result", func() {
+
+			// given
+			calls := 0
+
+			doer := NewRetryDoer(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				return nil, syscall.ECONNRESET
+			}), policy)
+
+			req, _ := http.NewRequest("GET", SearchURL, nil)
+
+			// when
+			_, err := doer.Do(req)
+
+			// then
+			Expect(err).To(Equal(syscall.ECONNRESET))
+			Expect(calls).To(Equal(policy.MaxAttempts))
+
+		})
+
+		It("Should not retry errors that are not transient", func() {
+
+			// given
+			doErr := errors.New("do error")
+			calls := 0
+
+			doer := NewRetryDoer(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				return nil, doErr
+			}), policy)
+
+			req, _ := http.NewRequest("GET", SearchURL, nil)
+
+			// when
+			_, err := doer.Do(req)
+
+			// then
+			Expect(err).To(Equal(doErr))
+			Expect(calls).To(Equal(1))
+
+		})
+
+		It("Should replay the request body on each attempt", func() {
+
+			// given
+			var bodies []string
+
+			doer := NewRetryDoer(DoerFunc(func(req *http.Request) (*http.Response, error) {
+
+				b, _ := ioutil.ReadAll(req.Body)
+				bodies = append(bodies, string(b))
+
+				if len(bodies) == 1 {
+					return statusResponse(500), nil
+				}
+
+				return statusResponse(200), nil
+
+			}), policy)
+
+			req, _ := http.NewRequest("POST", TokenURL, strings.NewReader("grant_type=client_credentials"))
+
+			// when
+			_, err := doer.Do(req)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(bodies).To(Equal([]string{"grant_type=client_credentials", "grant_type=client_credentials"}))
+
+		})
+
+		It("Should stop waiting when the request context is done", func() {
+
+			// given
+			ctx, cancel := context.WithCancel(context.Background())
+
+			doer := NewRetryDoer(DoerFunc(func(req *http.Request) (*http.Response, error) {
+				cancel()
+				return statusResponse(503), nil
+			}), RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, RetryableStatus: []int{503}})
+
+			req, _ := http.NewRequest("GET", SearchURL, nil)
+
+			// when
+			_, err := doer.Do(req.WithContext(ctx))
+
+			// then
+			Expect(err).To(Equal(context.Canceled))
+
+		})
+
+	})
+
+	Describe("RetryPolicy.Delay()", func() {
+
+		It("Should grow exponentially and be capped at MaxDelay", func() {
+
+			// given
+			p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+			// then
+			Expect(p.Delay(1)).To(Equal(time.Second))
+			Expect(p.Delay(2)).To(Equal(2 * time.Second))
+			Expect(p.Delay(3)).To(Equal(4 * time.Second))
+			Expect(p.Delay(4)).To(Equal(5 * time.Second))
+
+		})
+
+		It("Should randomize the jittered fraction of the delay", func() {
+
+			// given
+			p := RetryPolicy{BaseDelay: time.Second, Jitter: 0.5}
+
+			// then
+			for x := 0; x < 10; x++ {
+				Expect(p.Delay(1)).To(BeNumerically(">=", 500*time.Millisecond))
+				Expect(p.Delay(1)).To(BeNumerically("<=", time.Second))
+			}
+
+		})
+
+	})
+
+})
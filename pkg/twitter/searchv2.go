@@ -0,0 +1,618 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxPerRequestV2 is the maximum number of tweets returned per API v2 recent search request
+	MaxPerRequestV2 = 100
+
+	// MinPerRequestV2 is the minimum max_results of an API v2 recent search request. Fewer tweets are requested as
+	// this many.
+	MinPerRequestV2 = 10
+
+	recentSearchPath = "2/tweets/search/recent"
+)
+
+var (
+	// DefaultTweetFields are the tweet.fields requested by a V2API unless V2Options.TweetFields is set
+	DefaultTweetFields = []string{
+		"created_at", "author_id", "lang", "source", "conversation_id", "in_reply_to_user_id", "referenced_tweets",
+		"attachments", "geo", "entities", "public_metrics",
+	}
+
+	// DefaultUserFields are the user.fields requested by a V2API unless V2Options.UserFields is set. The id, name and
+	// username of each user are always returned.
+	DefaultUserFields = []string{"created_at", "description", "location", "url", "protected", "verified", "public_metrics"}
+
+	// DefaultExpansions are the expansions requested by a V2API unless V2Options.Expansions is set
+	DefaultExpansions = []string{
+		"author_id", "in_reply_to_user_id", "referenced_tweets.id", "referenced_tweets.id.author_id",
+		"attachments.media_keys", "geo.place_id",
+	}
+)
+
+// V2Options configures a V2API. Nil fields fall back to the defaults.
+type V2Options struct {
+	// TweetFields, UserFields, MediaFields and PlaceFields select the fields returned for each kind of object, as the
+	// tweet.fields, user.fields, media.fields and place.fields parameters
+	TweetFields []string
+	UserFields  []string
+	MediaFields []string
+	PlaceFields []string
+
+	// Expansions selects which objects referenced by each tweet are returned in the includes block
+	Expansions []string
+
+	// RateLimiter schedules recent search requests, which have a rate limit window of their own. Defaults to a new
+	// RateLimiter.
+	RateLimiter *RateLimiter
+}
+
+// NewV2API is a constructor for V2API
+//
+// api: provides the credentials, bearer token, endpoints and http client
+// opts: the fields requested with each search
+func NewV2API(api *API, opts V2Options) *V2API {
+
+	limiter := opts.RateLimiter
+
+	if limiter == nil {
+		limiter = NewRateLimiter()
+	}
+
+	return &V2API{
+		api:         api,
+		limiter:     limiter,
+		tweetFields: fieldsOrDefault(opts.TweetFields, DefaultTweetFields),
+		userFields:  fieldsOrDefault(opts.UserFields, DefaultUserFields),
+		mediaFields: opts.MediaFields,
+		placeFields: opts.PlaceFields,
+		expansions:  fieldsOrDefault(opts.Expansions, DefaultExpansions),
+	}
+
+}
+
+// V2API provides access to the Twitter API v2 recent search (see:
+// https://developer.twitter.com/en/docs/twitter-api/tweets/search/api-reference/get-tweets-search-recent). It has the
+// same Fetch methods as API, and returns the same SearchAPIResponse, so either can be extracted from.
+//
+// Each status holds the fields of an API v2 tweet, along with:
+//
+//   - "id_str", a copy of "id"
+//   - "author" and "in_reply_to_user", the users referenced by "author_id" and "in_reply_to_user_id"
+//   - "tweet", added to each of "referenced_tweets", the tweet it references, with its "author"
+//   - "media" and "place", the media referenced by "attachments.media_keys" and the place of "geo.place_id"
+//
+// Objects are only joined if they were requested with the expansions.
+type V2API struct {
+	api         *API
+	limiter     *RateLimiter
+	tweetFields []string
+	userFields  []string
+	mediaFields []string
+	placeFields []string
+	expansions  []string
+}
+
+// RateLimit returns the most recently reported recent search rate limit window. ok is false until a search response
+// carrying rate limit headers has been seen.
+func (v *V2API) RateLimit() (window RateLimit, ok bool) {
+	return v.limiter.State()
+}
+
+// FetchHashtag will query the recent search for tweets matching a hashtag
+//
+// hashtag: the hashtag to search for
+// count: number of records to retrieve
+// maxID: the maximum tweet id to return. Ignored when zero.
+func (v *V2API) FetchHashtag(hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return v.FetchHashtagContext(context.Background(), hashtag, count, maxID)
+}
+
+// FetchHashtagContext is FetchHashtag with a context, which aborts the request when it is done
+func (v *V2API) FetchHashtagContext(ctx context.Context, hashtag string, count int, maxID int64) (SearchAPIResponse, error) {
+	return v.FetchHashtagRange(ctx, hashtag, count, 0, maxID)
+}
+
+// FetchHashtagRange is FetchHashtagContext for tweets with sinceID < id <= maxID. Either bound is ignored when zero.
+func (v *V2API) FetchHashtagRange(ctx context.Context, hashtag string, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+	return v.FetchSearch(ctx, HashtagQuery(hashtag), count, sinceID, maxID)
+}
+
+// FetchSearch will query the recent search with any SearchQuery, for tweets with sinceID < id <= maxID. Either bound
+// is ignored when zero. Returns the error of SearchQuery.ValidateV2, without a request, if query is not supported.
+//
+// query: what to search for
+// count: number of records to retrieve
+func (v *V2API) FetchSearch(ctx context.Context, query SearchQuery, count int, sinceID int64, maxID int64) (SearchAPIResponse, error) {
+
+	if err := query.ValidateV2(); err != nil {
+		return SearchAPIResponse{}, err
+	}
+
+	params := url.Values{}
+	params.Set("query", query.QueryV2())
+	params.Set("max_results", fmt.Sprintf("%v", perRequestV2(count)))
+
+	if sinceID > 0 {
+		params.Set("since_id", fmt.Sprintf("%v", sinceID))
+	}
+
+	// until_id is exclusive, unlike max_id
+	if maxID > 0 {
+		params.Set("until_id", fmt.Sprintf("%v", maxID+1))
+	}
+
+	if !query.Since.IsZero() {
+		params.Set("start_time", query.Since.UTC().Format(time.RFC3339))
+	}
+
+	if !query.Until.IsZero() {
+		params.Set("end_time", query.Until.UTC().Format(time.RFC3339))
+	}
+
+	for name, fields := range map[string][]string{
+		"tweet.fields": v.tweetFields,
+		"user.fields":  v.userFields,
+		"media.fields": v.mediaFields,
+		"place.fields": v.placeFields,
+		"expansions":   v.expansions,
+	} {
+		if len(fields) > 0 {
+			params.Set(name, strings.Join(fields, ","))
+		}
+	}
+
+	return v.search(ctx, params)
+
+}
+
+// FetchResults follows the NextResults query string of a previous SearchAPIResponse, which carries the next_token of
+// the next page
+//
+// results: query string, such as "?query=%23IoT&max_results=100&next_token=b26v89c19zqg8o3f"
+// count: number of records to retrieve, overriding the max_results of results. Ignored if zero.
+func (v *V2API) FetchResults(ctx context.Context, results string, count int) (SearchAPIResponse, error) {
+
+	params, err := url.ParseQuery(strings.TrimPrefix(results, "?"))
+
+	if err != nil {
+		return SearchAPIResponse{}, err
+	}
+
+	if count > 0 {
+		params.Set("max_results", fmt.Sprintf("%v", perRequestV2(count)))
+	}
+
+	return v.search(ctx, params)
+
+}
+
+// search requests a page of the recent search and converts it to a SearchAPIResponse
+func (v *V2API) search(ctx context.Context, params url.Values) (SearchAPIResponse, error) {
+
+	var result searchV2Response
+
+	err := v.api.fetchVia(ctx, func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		return v.api.doLimitedBy(ctx, v.limiter, req)
+	}, func() (*http.Request, error) {
+		return v.searchRequest(params)
+	}, &result)
+
+	if err != nil {
+		return SearchAPIResponse{}, err
+	}
+
+	return result.searchAPIResponse(params), nil
+
+}
+
+func (v *V2API) searchRequest(params url.Values) (*http.Request, error) {
+
+	req, err := v.api.requestFactory("GET", v.api.endpoint(recentSearchPath), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.RawQuery = params.Encode()
+	v.api.setUserAgent(req)
+
+	return req, nil
+
+}
+
+// searchV2Response is a page of the recent search
+type searchV2Response struct {
+	Data     []map[string]interface{} `json:"data"`
+	Includes struct {
+		Users  []map[string]interface{} `json:"users"`
+		Tweets []map[string]interface{} `json:"tweets"`
+		Media  []map[string]interface{} `json:"media"`
+		Places []map[string]interface{} `json:"places"`
+	} `json:"includes"`
+	Meta struct {
+		NewestID    string `json:"newest_id"`
+		OldestID    string `json:"oldest_id"`
+		ResultCount int    `json:"result_count"`
+		NextToken   string `json:"next_token"`
+	} `json:"meta"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping numbers as json.Number
+func (r *searchV2Response) UnmarshalJSON(b []byte) error {
+
+	type response searchV2Response
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	return decoder.Decode((*response)(r))
+
+}
+
+// searchAPIResponse joins the includes onto each tweet, and describes the page requested with params as
+// SearchMetadata
+func (r searchV2Response) searchAPIResponse(params url.Values) SearchAPIResponse {
+
+	var (
+		users  = indexBy("id", r.Includes.Users)
+		tweets = indexBy("id", r.Includes.Tweets)
+		media  = indexBy("media_key", r.Includes.Media)
+		places = indexBy("id", r.Includes.Places)
+	)
+
+	resp := SearchAPIResponse{
+		Statuses: make([]map[string]interface{}, len(r.Data)),
+		Tweets:   make([]Tweet, len(r.Data)),
+	}
+
+	for i, data := range r.Data {
+
+		status := joinUsers(data, users)
+		status["id_str"] = status["id"]
+
+		if referenced, ok := status["referenced_tweets"].([]interface{}); ok {
+			status["referenced_tweets"] = joinReferencedTweets(referenced, tweets, users)
+		}
+
+		if attachments, ok := status["attachments"].(map[string]interface{}); ok {
+			if keys, ok := attachments["media_keys"].([]interface{}); ok {
+				status["media"] = lookupAll(keys, media)
+			}
+		}
+
+		if geo, ok := status["geo"].(map[string]interface{}); ok {
+			if place, ok := places[fmt.Sprint(geo["place_id"])]; ok {
+				status["place"] = place
+			}
+		}
+
+		tweet, err := tweetFromV2(status)
+
+		// as with v1.1 statuses, a tweet whose fields do not fit a Tweet is kept, rather than fail the page
+		if err != nil {
+			raw, _ := json.Marshal(status)
+			tweet = Tweet{Raw: raw, DecodeErr: err}
+		}
+
+		resp.Statuses[i] = status
+		resp.Tweets[i] = tweet
+
+	}
+
+	newestID, _ := strconv.ParseInt(r.Meta.NewestID, 10, 64)
+	sinceID, _ := strconv.ParseInt(params.Get("since_id"), 10, 64)
+	count, _ := strconv.Atoi(params.Get("max_results"))
+
+	resp.SearchMetadata = SearchMetadata{
+		MaxID:   newestID,
+		SinceID: sinceID,
+		Count:   count,
+		Query:   url.QueryEscape(params.Get("query")),
+	}
+
+	if r.Meta.NextToken != "" {
+
+		next := url.Values{}
+
+		for name, values := range params {
+			next[name] = values
+		}
+
+		next.Set("next_token", r.Meta.NextToken)
+		resp.SearchMetadata.NextResults = "?" + next.Encode()
+
+	}
+
+	return resp
+
+}
+
+// joinUsers returns a copy of tweet with its "author" and "in_reply_to_user" joined from users
+func joinUsers(tweet map[string]interface{}, users map[string]map[string]interface{}) map[string]interface{} {
+
+	joined := map[string]interface{}{}
+
+	for k, v := range tweet {
+		joined[k] = v
+	}
+
+	if user, ok := users[fmt.Sprint(tweet["author_id"])]; ok {
+		joined["author"] = user
+	}
+
+	if user, ok := users[fmt.Sprint(tweet["in_reply_to_user_id"])]; ok {
+		joined["in_reply_to_user"] = user
+	}
+
+	return joined
+
+}
+
+// joinReferencedTweets returns a copy of referenced with the "tweet" of each joined from tweets, along with its author
+func joinReferencedTweets(referenced []interface{}, tweets map[string]map[string]interface{}, users map[string]map[string]interface{}) []interface{} {
+
+	joined := make([]interface{}, len(referenced))
+
+	for i, r := range referenced {
+
+		ref, ok := r.(map[string]interface{})
+
+		if !ok {
+			joined[i] = r
+			continue
+		}
+
+		entry := map[string]interface{}{}
+
+		for k, v := range ref {
+			entry[k] = v
+		}
+
+		if tweet, ok := tweets[fmt.Sprint(ref["id"])]; ok {
+			entry["tweet"] = joinUsers(tweet, users)
+		}
+
+		joined[i] = entry
+
+	}
+
+	return joined
+
+}
+
+// indexBy indexes objects by the string value of their key field
+func indexBy(key string, objects []map[string]interface{}) map[string]map[string]interface{} {
+
+	index := make(map[string]map[string]interface{}, len(objects))
+
+	for _, object := range objects {
+		if value, ok := object[key].(string); ok {
+			index[value] = object
+		}
+	}
+
+	return index
+
+}
+
+// lookupAll returns the object of index for each of keys that has one
+func lookupAll(keys []interface{}, index map[string]map[string]interface{}) []interface{} {
+
+	var found []interface{}
+
+	for _, key := range keys {
+		if object, ok := index[fmt.Sprint(key)]; ok {
+			found = append(found, object)
+		}
+	}
+
+	return found
+
+}
+
+// tweetV2 is the API v2 form of the fields of Tweet, as joined by searchAPIResponse
+type tweetV2 struct {
+	ID               string `json:"id"`
+	Text             string `json:"text"`
+	CreatedAt        string `json:"created_at"`
+	Lang             string `json:"lang"`
+	Source           string `json:"source"`
+	InReplyToUserID  string `json:"in_reply_to_user_id"`
+	Author           userV2 `json:"author"`
+	ReferencedTweets []struct {
+		Type  string   `json:"type"`
+		ID    string   `json:"id"`
+		Tweet *tweetV2 `json:"tweet"`
+	} `json:"referenced_tweets"`
+	PublicMetrics struct {
+		RetweetCount int `json:"retweet_count"`
+		LikeCount    int `json:"like_count"`
+	} `json:"public_metrics"`
+}
+
+// userV2 is the API v2 form of the fields of User
+type userV2 struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Username      string `json:"username"`
+	CreatedAt     string `json:"created_at"`
+	Location      string `json:"location"`
+	Description   string `json:"description"`
+	URL           string `json:"url"`
+	Protected     bool   `json:"protected"`
+	Verified      bool   `json:"verified"`
+	PublicMetrics struct {
+		FollowersCount int `json:"followers_count"`
+		FollowingCount int `json:"following_count"`
+		TweetCount     int `json:"tweet_count"`
+	} `json:"public_metrics"`
+}
+
+// tweetFromV2 converts a joined API v2 tweet to a Tweet. Fields without an API v2 equivalent are left empty.
+func tweetFromV2(status map[string]interface{}) (Tweet, error) {
+
+	raw, err := json.Marshal(status)
+
+	if err != nil {
+		return Tweet{}, err
+	}
+
+	var decoded tweetV2
+
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return Tweet{}, err
+	}
+
+	tweet, err := decoded.tweet()
+
+	if err != nil {
+		return Tweet{}, err
+	}
+
+	tweet.Raw = raw
+
+	return tweet, nil
+
+}
+
+// tweet converts t to a Tweet. A retweeted or quoted tweet is converted too, if it was joined.
+func (t tweetV2) tweet() (Tweet, error) {
+
+	createdAt, err := parseTimeV2(t.CreatedAt)
+
+	if err != nil {
+		return Tweet{}, err
+	}
+
+	user, err := t.Author.user()
+
+	if err != nil {
+		return Tweet{}, err
+	}
+
+	tweet := Tweet{
+		ID:              parseIDV2(t.ID),
+		CreatedAt:       createdAt,
+		Text:            t.Text,
+		Lang:            t.Lang,
+		Source:          t.Source,
+		User:            user,
+		InReplyToUserID: parseIDV2(t.InReplyToUserID),
+		RetweetCount:    t.PublicMetrics.RetweetCount,
+		FavoriteCount:   t.PublicMetrics.LikeCount,
+	}
+
+	for _, ref := range t.ReferencedTweets {
+
+		switch ref.Type {
+		case "replied_to":
+			tweet.InReplyToStatusID = parseIDV2(ref.ID)
+		case "retweeted", "quoted":
+
+			if ref.Tweet == nil {
+				continue
+			}
+
+			referenced, err := ref.Tweet.tweet()
+
+			if err != nil {
+				return Tweet{}, err
+			}
+
+			if ref.Type == "retweeted" {
+				tweet.RetweetedStatus = &referenced
+			} else {
+				tweet.QuotedStatus = &referenced
+			}
+
+		}
+
+	}
+
+	return tweet, nil
+
+}
+
+// user converts u to a User
+func (u userV2) user() (User, error) {
+
+	createdAt, err := parseTimeV2(u.CreatedAt)
+
+	if err != nil {
+		return User{}, err
+	}
+
+	return User{
+		ID:             parseIDV2(u.ID),
+		CreatedAt:      createdAt,
+		Name:           u.Name,
+		ScreenName:     u.Username,
+		Location:       u.Location,
+		Description:    u.Description,
+		URL:            u.URL,
+		Protected:      u.Protected,
+		Verified:       u.Verified,
+		FollowersCount: u.PublicMetrics.FollowersCount,
+		FriendsCount:   u.PublicMetrics.FollowingCount,
+		StatusesCount:  u.PublicMetrics.TweetCount,
+	}, nil
+
+}
+
+// parseTimeV2 parses an API v2 timestamp, such as "2020-05-01T12:00:00.000Z". An empty value is the zero time.
+func parseTimeV2(value string) (time.Time, error) {
+
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+
+}
+
+// parseIDV2 parses an API v2 id, which is always a string. An empty or invalid id is zero.
+func parseIDV2(id string) int64 {
+
+	parsed, _ := strconv.ParseInt(id, 10, 64)
+
+	return parsed
+
+}
+
+// perRequestV2 clamps count to the max_results the recent search accepts
+func perRequestV2(count int) int {
+
+	if count < MinPerRequestV2 {
+		return MinPerRequestV2
+	}
+
+	if count > MaxPerRequestV2 {
+		return MaxPerRequestV2
+	}
+
+	return count
+
+}
+
+// fieldsOrDefault returns fields, or defaults if fields is nil
+func fieldsOrDefault(fields []string, defaults []string) []string {
+
+	if fields == nil {
+		return defaults
+	}
+
+	return fields
+
+}
@@ -0,0 +1,243 @@
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+)
+
+const recentSearchJSON = `{
+	"data": [
+		{
+			"id": "1261326399320715264",
+			"text": "RT @TwitterDev: Tune in to hear about #IoT…",
+			"created_at": "2020-05-15T16:03:42.000Z",
+			"author_id": "2244994945",
+			"lang": "en",
+			"referenced_tweets": [{"type": "retweeted", "id": "1261326399320715000"}],
+			"attachments": {"media_keys": ["3_1261326399320715264"]},
+			"geo": {"place_id": "01a9a39529b27f36"},
+			"public_metrics": {"retweet_count": 12, "like_count": 34}
+		}
+	],
+	"includes": {
+		"users": [
+			{"id": "2244994945", "name": "Twitter Dev", "username": "TwitterDev", "created_at": "2013-12-14T04:35:55.000Z"},
+			{"id": "783214", "name": "Twitter", "username": "Twitter"}
+		],
+		"tweets": [
+			{"id": "1261326399320715000", "text": "Tune in to hear about #IoT and the complete text", "author_id": "783214"}
+		],
+		"media": [{"media_key": "3_1261326399320715264", "type": "photo"}],
+		"places": [{"id": "01a9a39529b27f36", "full_name": "Manhattan, NY"}]
+	},
+	"meta": {"newest_id": "1261326399320715264", "oldest_id": "1261326399320715264", "result_count": 1, "next_token": "b26v89c19zqg8o3fosbtqttqxfg"}
+}`
+
+var _ = Describe("V2API", func() {
+
+	var (
+		requests []*http.Request
+		server   *httptest.Server
+		api      *V2API
+	)
+
+	BeforeEach(func() {
+
+		requests = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+			fmt.Fprint(w, recentSearchJSON)
+		}))
+
+		v1 := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+		v1.SetBearerToken("bearerToken")
+
+		api = NewV2API(v1, V2Options{})
+
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("V2API.FetchHashtag()", func() {
+
+		It("Should query the recent search", func() {
+
+			// when
+			_, err := api.FetchHashtag("#IoT", 5, 12344)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(requests).To(HaveLen(1))
+
+			query := requests[0].URL.Query()
+			Expect(requests[0].URL.Path).To(Equal("/2/tweets/search/recent"))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer bearerToken"))
+			Expect(query.Get("query")).To(Equal("#IoT lang:en"))
+			Expect(query.Get("max_results")).To(Equal("10"))
+			Expect(query.Get("until_id")).To(Equal("12345"))
+			Expect(query.Get("expansions")).To(ContainSubstring("author_id"))
+			Expect(query.Get("tweet.fields")).To(ContainSubstring("created_at"))
+
+		})
+
+	})
+
+	Describe("V2API.FetchSearch()", func() {
+
+		It("Should join the includes onto each tweet", func() {
+
+			// when
+			resp, err := api.FetchSearch(context.Background(), HashtagQuery("#IoT"), 100, 0, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.Statuses).To(HaveLen(1))
+
+			status := resp.Statuses[0]
+			Expect(status["id_str"]).To(Equal("1261326399320715264"))
+			Expect(status["author"]).To(HaveKeyWithValue("username", "TwitterDev"))
+			Expect(status["media"]).To(Equal([]interface{}{map[string]interface{}{"media_key": "3_1261326399320715264", "type": "photo"}}))
+			Expect(status["place"]).To(HaveKeyWithValue("full_name", "Manhattan, NY"))
+			Expect(status["public_metrics"]).To(HaveKeyWithValue("like_count", json.Number("34")))
+
+			retweeted := status["referenced_tweets"].([]interface{})[0].(map[string]interface{})["tweet"]
+			Expect(retweeted).To(HaveKeyWithValue("author", HaveKeyWithValue("username", "Twitter")))
+
+		})
+
+		It("Should decode each status as a Tweet", func() {
+
+			// when
+			resp, err := api.FetchSearch(context.Background(), HashtagQuery("#IoT"), 100, 0, 0)
+
+			// then
+			Expect(err).To(BeNil())
+
+			tweet := resp.Tweets[0]
+			Expect(tweet.ID).To(Equal(int64(1261326399320715264)))
+			Expect(tweet.CreatedAt).To(BeTemporally("==", time.Date(2020, 5, 15, 16, 3, 42, 0, time.UTC)))
+			Expect(tweet.User.ScreenName).To(Equal("TwitterDev"))
+			Expect(tweet.User.CreatedAt).To(BeTemporally("==", time.Date(2013, 12, 14, 4, 35, 55, 0, time.UTC)))
+			Expect(tweet.RetweetCount).To(Equal(12))
+			Expect(tweet.FavoriteCount).To(Equal(34))
+			Expect(tweet.RetweetedStatus.ID).To(Equal(int64(1261326399320715000)))
+			Expect(tweet.CompleteText()).To(Equal("RT @Twitter: Tune in to hear about #IoT and the complete text"))
+
+		})
+
+		It("Should keep a tweet whose fields are malformed, setting the DecodeErr of its Tweet", func() {
+
+			// given
+			malformed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{
+					"data": [
+						{"id": "1261326399320715265", "text": "malformed", "created_at": "yesterday"},
+						{"id": "1261326399320715264", "text": "#IoT", "created_at": "2020-05-15T16:03:42.000Z"}
+					],
+					"meta": {"newest_id": "1261326399320715265", "result_count": 2}
+				}`)
+			}))
+			defer malformed.Close()
+
+			v1 := NewAPIWithOptions("key", "secret", Options{BaseURL: malformed.URL})
+			v1.SetBearerToken("bearerToken")
+
+			// when
+			resp, err := NewV2API(v1, V2Options{}).FetchSearch(context.Background(), HashtagQuery("#IoT"), 100, 0, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.Statuses).To(HaveLen(2))
+			Expect(resp.Statuses[0]["text"]).To(Equal("malformed"))
+			Expect(resp.Tweets[0].DecodeErr).NotTo(BeNil())
+			Expect(resp.Tweets[0].Raw).NotTo(BeEmpty())
+			Expect(resp.Tweets[1].DecodeErr).To(BeNil())
+			Expect(resp.Tweets[1].ID).To(Equal(int64(1261326399320715264)))
+
+		})
+
+		It("Should describe the page as SearchMetadata, with the next_token in NextResults", func() {
+
+			// when
+			resp, err := api.FetchSearch(context.Background(), HashtagQuery("#IoT"), 100, 100, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.SearchMetadata.MaxID).To(Equal(int64(1261326399320715264)))
+			Expect(resp.SearchMetadata.SinceID).To(Equal(int64(100)))
+			Expect(resp.SearchMetadata.Count).To(Equal(100))
+
+			next, err := url.ParseQuery(resp.SearchMetadata.NextResults[1:])
+			Expect(err).To(BeNil())
+			Expect(next.Get("next_token")).To(Equal("b26v89c19zqg8o3fosbtqttqxfg"))
+			Expect(next.Get("query")).To(Equal("#IoT lang:en"))
+			Expect(next.Get("since_id")).To(Equal("100"))
+
+		})
+
+		It("Should send Since and Until as start_time and end_time", func() {
+
+			// given
+			query := SearchQuery{
+				Hashtags: []string{"#IoT"},
+				Since:    time.Date(2020, 5, 14, 0, 0, 0, 0, time.UTC),
+				Until:    time.Date(2020, 5, 15, 0, 0, 0, 0, time.UTC),
+			}
+
+			// when
+			_, err := api.FetchSearch(context.Background(), query, 100, 0, 0)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(requests[0].URL.Query().Get("start_time")).To(Equal("2020-05-14T00:00:00Z"))
+			Expect(requests[0].URL.Query().Get("end_time")).To(Equal("2020-05-15T00:00:00Z"))
+
+		})
+
+		It("Should not send a query the recent search does not support", func() {
+
+			// when
+			_, err := api.FetchSearch(context.Background(), SearchQuery{Hashtags: []string{"#IoT"}, MinFaves: 10}, 100, 0, 0)
+
+			// then
+			Expect(errors.Is(err, ErrUnsupportedV2)).To(BeTrue())
+			Expect(requests).To(BeEmpty())
+
+		})
+
+	})
+
+	Describe("V2API.FetchResults()", func() {
+
+		It("Should follow NextResults with max_results overridden", func() {
+
+			// given
+			resp, err := api.FetchHashtag("#IoT", 100, 0)
+			Expect(err).To(BeNil())
+
+			// when
+			_, err = api.FetchResults(context.Background(), resp.SearchMetadata.NextResults, 20)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[1].URL.Query().Get("next_token")).To(Equal("b26v89c19zqg8o3fosbtqttqxfg"))
+			Expect(requests[1].URL.Query().Get("max_results")).To(Equal("20"))
+
+		})
+
+	})
+
+})
@@ -0,0 +1,76 @@
+package twitter
+
+import "time"
+
+const (
+	// SearchWindow is how far back the standard Search API returns tweets
+	SearchWindow = 7 * 24 * time.Hour
+
+	// snowflakeEpoch is the Twitter epoch, in milliseconds since the Unix epoch
+	snowflakeEpoch = 1288834974657
+
+	// snowflakeTimeShift is the number of low bits of an id that do not encode its timestamp
+	snowflakeTimeShift = 22
+)
+
+// SnowflakeTime returns the time encoded in a tweet id (see: https://developer.twitter.com/en/docs/basics/twitter-ids)
+func SnowflakeTime(id int64) time.Time {
+
+	ms := id>>snowflakeTimeShift + snowflakeEpoch
+
+	return time.Unix(0, ms*int64(time.Millisecond))
+
+}
+
+// SnowflakeID returns the smallest tweet id that could have been created at t
+func SnowflakeID(t time.Time) int64 {
+
+	ms := t.UnixNano()/int64(time.Millisecond) - snowflakeEpoch
+
+	if ms < 0 {
+		return 0
+	}
+
+	return ms << snowflakeTimeShift
+
+}
+
+// IDRange is a range of tweet ids with SinceID < id <= MaxID, matching the since_id and max_id search parameters. A
+// zero bound is open.
+type IDRange struct {
+	SinceID int64
+	MaxID   int64
+}
+
+// SplitIDRange divides the time window between from and to into n ranges of equal duration, newest first. The ranges
+// are contiguous and do not overlap. The first range is open above and the last open below, so together they cover
+// every id.
+//
+// from: start of the window, usually time.Now().Add(-SearchWindow)
+// to: end of the window, usually time.Now()
+// n: number of ranges
+func SplitIDRange(from time.Time, to time.Time, n int) []IDRange {
+
+	if n < 1 {
+		n = 1
+	}
+
+	ranges := make([]IDRange, n)
+	step := to.Sub(from) / time.Duration(n)
+
+	for i := range ranges {
+
+		// ids created at or after the boundary belong to the newer range
+		if i > 0 {
+			ranges[i].MaxID = SnowflakeID(to.Add(-time.Duration(i)*step)) - 1
+		}
+
+		if i < n-1 {
+			ranges[i].SinceID = SnowflakeID(to.Add(-time.Duration(i+1)*step)) - 1
+		}
+
+	}
+
+	return ranges
+
+}
@@ -0,0 +1,85 @@
+package twitter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"time"
+)
+
+var _ = Describe("Snowflake", func() {
+
+	Describe("SnowflakeTime()", func() {
+
+		It("Should decode the timestamp of a tweet id", func() {
+
+			// given
+			id := int64(1050118621198921728)
+
+			// when
+			t := SnowflakeTime(id)
+
+			// then
+			Expect(t.UTC()).To(Equal(time.Date(2018, 10, 10, 20, 19, 24, 211*int(time.Millisecond), time.UTC)))
+
+		})
+
+	})
+
+	Describe("SnowflakeID()", func() {
+
+		It("Should return the smallest id created at t", func() {
+
+			// given
+			t := time.Date(2018, 10, 10, 20, 19, 24, 211*int(time.Millisecond), time.UTC)
+
+			// when
+			id := SnowflakeID(t)
+
+			// then
+			Expect(SnowflakeTime(id)).To(BeTemporally("==", t))
+			Expect(SnowflakeTime(id - 1)).To(BeTemporally("<", t))
+			Expect(id).To(BeNumerically("<=", 1050118621198921728))
+
+		})
+
+	})
+
+	Describe("SplitIDRange()", func() {
+
+		It("Should return contiguous ranges, newest first, open at both ends", func() {
+
+			// given
+			to := time.Now()
+			from := to.Add(-SearchWindow)
+
+			// when
+			ranges := SplitIDRange(from, to, 4)
+
+			// then
+			Expect(ranges).To(HaveLen(4))
+			Expect(ranges[0].MaxID).To(BeZero())
+			Expect(ranges[3].SinceID).To(BeZero())
+
+			for i := 1; i < len(ranges); i++ {
+				Expect(ranges[i].MaxID).To(Equal(ranges[i-1].SinceID))
+				Expect(ranges[i].MaxID).To(BeNumerically(">", ranges[i].SinceID))
+			}
+
+			Expect(SnowflakeTime(ranges[0].SinceID + 1)).To(BeTemporally("~", to.Add(-SearchWindow/4), time.Millisecond))
+
+		})
+
+		It("Should return a single open range when n < 2", func() {
+
+			// when
+			ranges := SplitIDRange(time.Now().Add(-time.Hour), time.Now(), 0)
+
+			// then
+			Expect(ranges).To(Equal([]IDRange{{}}))
+
+		})
+
+	})
+
+})
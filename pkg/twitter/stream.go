@@ -0,0 +1,557 @@
+package twitter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultStallTimeout is how long FilterStream waits for data before it reconnects. The filtered stream sends a
+	// keep-alive newline every 20 seconds.
+	DefaultStallTimeout = 30 * time.Second
+
+	streamPath      = "2/tweets/search/stream"
+	streamRulesPath = "2/tweets/search/stream/rules"
+)
+
+var (
+	// ErrStreamStalled is the disconnect reason when no data, not even a keep-alive, arrived within the stall timeout
+	ErrStreamStalled = errors.New("twitter: stream stalled")
+
+	// ErrStreamClosed is the disconnect reason when the server ended the stream
+	ErrStreamClosed = errors.New("twitter: stream closed by server")
+)
+
+// DefaultStreamBackoff reconnects as recommended by the Twitter API (see:
+// https://developer.twitter.com/en/docs/twitter-api/tweets/filtered-stream/integrate/handling-disconnections)
+var DefaultStreamBackoff = StreamBackoff{
+	NetworkStep:   250 * time.Millisecond,
+	NetworkMax:    16 * time.Second,
+	HTTPBase:      5 * time.Second,
+	HTTPMax:       320 * time.Second,
+	RateLimitBase: time.Minute,
+	RateLimitMax:  DefaultRateLimitWindow,
+}
+
+// StreamBackoff configures how long FilterStream waits before each reconnect, by what dropped the connection
+type StreamBackoff struct {
+	// NetworkStep is added to the delay after each consecutive network error, stall or disconnect, up to NetworkMax
+	NetworkStep time.Duration
+	NetworkMax  time.Duration
+
+	// HTTPBase is the delay after the first consecutive 5xx response. Each following one doubles it, up to HTTPMax.
+	HTTPBase time.Duration
+	HTTPMax  time.Duration
+
+	// RateLimitBase is the delay after the first consecutive 429 response. Each following one doubles it, up to
+	// RateLimitMax.
+	RateLimitBase time.Duration
+	RateLimitMax  time.Duration
+}
+
+// Delay returns the delay before the given reconnect attempt, where attempt 1 is the first reconnect, after the
+// connection was dropped by err
+func (b StreamBackoff) Delay(err error, attempt int) time.Duration {
+
+	var apiErr *APIError
+
+	switch {
+	case errors.As(err, &apiErr) && apiErr.IsRateLimited():
+		return exponentialDelay(b.RateLimitBase, b.RateLimitMax, attempt)
+	case errors.As(err, &apiErr):
+		return exponentialDelay(b.HTTPBase, b.HTTPMax, attempt)
+	}
+
+	delay := b.NetworkStep * time.Duration(attempt)
+
+	if b.NetworkMax > 0 && delay > b.NetworkMax {
+		delay = b.NetworkMax
+	}
+
+	return delay
+
+}
+
+// exponentialDelay returns base doubled for each attempt after the first, capped at max unless it is zero
+func exponentialDelay(base time.Duration, max time.Duration, attempt int) time.Duration {
+
+	delay := float64(base) * math.Pow(2, float64(attempt-1))
+
+	if max > 0 {
+		delay = math.Min(delay, float64(max))
+	}
+
+	return time.Duration(delay)
+
+}
+
+// StreamOptions configures FilterStream
+type StreamOptions struct {
+	// TweetFields, Expansions and UserFields select what each StreamMessage carries, as the tweet.fields, expansions
+	// and user.fields parameters. By default only the id and text of each tweet are returned.
+	TweetFields []string
+	Expansions  []string
+	UserFields  []string
+
+	// StallTimeout is how long to wait for data before reconnecting. Defaults to DefaultStallTimeout.
+	StallTimeout time.Duration
+
+	// Backoff configures the delay before each reconnect. Defaults to DefaultStreamBackoff.
+	Backoff *StreamBackoff
+
+	// MaxReconnects is the number of consecutive failed reconnects after which FilterStream gives up and returns the
+	// error that dropped the last connection. Zero never gives up.
+	MaxReconnects int
+}
+
+// StreamRule is a filtered stream rule (see:
+// https://developer.twitter.com/en/docs/twitter-api/tweets/filtered-stream/integrate/build-a-rule)
+type StreamRule struct {
+	// ID is assigned by the API when the rule is added
+	ID string `json:"id,omitempty"`
+
+	// Value is the rule, in the same syntax as a search query (ex: "#IoT -is:retweet")
+	Value string `json:"value,omitempty"`
+
+	// Tag labels the tweets the rule matched. Optional.
+	Tag string `json:"tag,omitempty"`
+}
+
+// StreamMessage is a tweet delivered by the filtered stream
+type StreamMessage struct {
+	// Data is the tweet, with numbers decoded as json.Number so that no precision is lost
+	Data map[string]interface{} `json:"data"`
+
+	// Includes holds the objects requested with StreamOptions.Expansions, such as "users"
+	Includes map[string]interface{} `json:"includes"`
+
+	// MatchingRules are the rules the tweet matched. Only ID and Tag are set.
+	MatchingRules []StreamRule `json:"matching_rules"`
+
+	// Errors reports why the server is about to end the stream, in a message without Data
+	Errors []Problem `json:"errors"`
+}
+
+// ID returns the id of the tweet, empty if the message carries none
+func (m StreamMessage) ID() string {
+
+	id, _ := m.Data["id"].(string)
+
+	return id
+
+}
+
+type streamRulesResponse struct {
+	Data   []StreamRule `json:"data"`
+	Errors []Problem    `json:"errors"`
+}
+
+// streamHandlerError wraps the error returned by the FilterStream callback, so it is not mistaken for a disconnect
+type streamHandlerError struct {
+	err error
+}
+
+// Error implements error
+func (e streamHandlerError) Error() string {
+	return e.err.Error()
+}
+
+// FilterStream connects to the filtered stream and calls fn with each tweet matching the stream rules, in the order
+// they are delivered. It returns the error returned by fn, ctx.Err() once ctx is done, or an *APIError if the stream
+// is rejected outright, for example because of bad credentials.
+//
+// Every other failure reconnects after the delay given by opts.Backoff: network errors, stalls, the server ending the
+// stream, 5xx responses and 429 responses. The same tweet may be delivered again after a reconnect.
+//
+// The stream is authorized with an app-only bearer token whatever Options.Authenticator is, as it does not accept user
+// context.
+//
+// opts: which fields to request, and how to reconnect
+// fn: called with each tweet. Returning an error ends the stream.
+func (a *API) FilterStream(ctx context.Context, opts StreamOptions, fn func(StreamMessage) error) error {
+
+	backoff := DefaultStreamBackoff
+
+	if opts.Backoff != nil {
+		backoff = *opts.Backoff
+	}
+
+	refreshed := false
+
+	for attempt := 0; ; {
+
+		req, connected, err := a.consumeStream(ctx, opts, fn)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if handlerErr, ok := err.(streamHandlerError); ok {
+			return handlerErr.err
+		}
+
+		var apiErr *APIError
+
+		if errors.As(err, &apiErr) && !apiErr.IsRateLimited() && apiErr.StatusCode < 500 {
+
+			// the credentials have expired or been invalidated, so renew them once
+			if isInvalidToken(apiErr) && !refreshed {
+				a.bearer.Expire(req)
+				refreshed = true
+				continue
+			}
+
+			return err
+
+		}
+
+		if connected {
+			attempt = 0
+			refreshed = false
+		}
+
+		attempt++
+
+		if opts.MaxReconnects > 0 && attempt > opts.MaxReconnects {
+			return err
+		}
+
+		timer := time.NewTimer(backoff.Delay(err, attempt))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+	}
+
+}
+
+// consumeStream holds a single connection to the filtered stream, calling fn with each tweet until the connection is
+// dropped. It returns the request the connection was made with. connected is true if the stream was accepted.
+func (a *API) consumeStream(ctx context.Context, opts StreamOptions, fn func(StreamMessage) error) (req *http.Request, connected bool, err error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err = a.streamRequest(opts)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	req = req.WithContext(ctx)
+
+	if err := a.bearer.Authenticate(ctx, req); err != nil {
+		return req, false, err
+	}
+
+	resp, err := a.streamClient.Do(req)
+
+	if err != nil {
+		return req, false, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return req, false, newAPIError(resp, req.URL.String(), bodyBytes)
+	}
+
+	stallTimeout := opts.StallTimeout
+
+	if stallTimeout <= 0 {
+		stallTimeout = DefaultStallTimeout
+	}
+
+	// a stall cancels the request, which unblocks the read below
+	stalled := make(chan struct{})
+	stall := time.AfterFunc(stallTimeout, func() {
+		close(stalled)
+		cancel()
+	})
+
+	defer stall.Stop()
+
+	reader := bufio.NewReader(resp.Body)
+
+	for {
+
+		line, err := reader.ReadBytes('\n')
+
+		if err != nil {
+
+			select {
+			case <-stalled:
+				return req, true, ErrStreamStalled
+			default:
+			}
+
+			if err == io.EOF {
+				return req, true, ErrStreamClosed
+			}
+
+			return req, true, err
+
+		}
+
+		if !stall.Stop() {
+			// the stall fired while the line was being read
+			return req, true, ErrStreamStalled
+		}
+
+		stall.Reset(stallTimeout)
+
+		// skip keep-alive newlines
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		message, err := decodeStreamMessage(line)
+
+		if err != nil {
+			return req, true, err
+		}
+
+		if message.Data == nil && len(message.Errors) > 0 {
+			return req, true, &ProblemError{Problems: message.Errors}
+		}
+
+		if err := fn(message); err != nil {
+			return req, true, streamHandlerError{err: err}
+		}
+
+	}
+
+}
+
+// decodeStreamMessage decodes a single line of the stream, keeping numbers as json.Number
+func decodeStreamMessage(line []byte) (StreamMessage, error) {
+
+	var message StreamMessage
+
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&message)
+
+	return message, err
+
+}
+
+// StreamRules returns the rules of the filtered stream
+func (a *API) StreamRules(ctx context.Context) ([]StreamRule, error) {
+
+	var result streamRulesResponse
+
+	err := a.fetchRules(ctx, func() (*http.Request, error) {
+		return a.streamRulesRequest("GET", nil)
+	}, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Data, nil
+
+}
+
+// AddStreamRules adds rules to the filtered stream, returning them with their ids. Rules that could not be added, such
+// as duplicates of existing rules, are reported by a *ProblemError, returned along with the rules that were added.
+//
+// rules: the rules to add. Their ids are ignored.
+func (a *API) AddStreamRules(ctx context.Context, rules ...StreamRule) ([]StreamRule, error) {
+
+	add := make([]StreamRule, len(rules))
+
+	for i, rule := range rules {
+		add[i] = StreamRule{Value: rule.Value, Tag: rule.Tag}
+	}
+
+	var result streamRulesResponse
+
+	err := a.fetchRules(ctx, func() (*http.Request, error) {
+		return a.streamRulesRequest("POST", map[string]interface{}{"add": add})
+	}, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Errors) > 0 {
+		return result.Data, &ProblemError{Problems: result.Errors}
+	}
+
+	return result.Data, nil
+
+}
+
+// DeleteStreamRules removes rules from the filtered stream. Ids that do not exist are reported by a *ProblemError.
+//
+// ids: ids of the rules to remove
+func (a *API) DeleteStreamRules(ctx context.Context, ids ...string) error {
+
+	var result streamRulesResponse
+
+	err := a.fetchRules(ctx, func() (*http.Request, error) {
+		return a.streamRulesRequest("POST", map[string]interface{}{"delete": map[string][]string{"ids": ids}})
+	}, &result)
+
+	if err != nil {
+		return err
+	}
+
+	if len(result.Errors) > 0 {
+		return &ProblemError{Problems: result.Errors}
+	}
+
+	return nil
+
+}
+
+// SetStreamRules replaces the rules of the filtered stream with rules, returning them with their ids. Existing rules
+// with the same Value and Tag as one of rules are kept, so the stream is not disrupted by rules that did not change.
+//
+// rules: every rule the stream should have. Their ids are ignored.
+func (a *API) SetStreamRules(ctx context.Context, rules ...StreamRule) ([]StreamRule, error) {
+
+	existing, err := a.StreamRules(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := map[StreamRule]bool{}
+
+	for _, rule := range rules {
+		wanted[StreamRule{Value: rule.Value, Tag: rule.Tag}] = true
+	}
+
+	var (
+		kept   []StreamRule
+		remove []string
+	)
+
+	for _, rule := range existing {
+
+		key := StreamRule{Value: rule.Value, Tag: rule.Tag}
+
+		if wanted[key] {
+			kept = append(kept, rule)
+			delete(wanted, key)
+			continue
+		}
+
+		remove = append(remove, rule.ID)
+
+	}
+
+	if len(remove) > 0 {
+		if err := a.DeleteStreamRules(ctx, remove...); err != nil {
+			return nil, err
+		}
+	}
+
+	var add []StreamRule
+
+	// keep the order rules were given in
+	for _, rule := range rules {
+
+		key := StreamRule{Value: rule.Value, Tag: rule.Tag}
+
+		if wanted[key] {
+			add = append(add, key)
+			delete(wanted, key)
+		}
+
+	}
+
+	if len(add) < 1 {
+		return kept, nil
+	}
+
+	added, err := a.AddStreamRules(ctx, add...)
+
+	return append(kept, added...), err
+
+}
+
+// fetchRules is fetch for the stream rules endpoints, which have their own rate limit window and, like the stream,
+// only accept an app-only bearer token whatever Options.Authenticator is
+func (a *API) fetchRules(ctx context.Context, newRequest func() (*http.Request, error), result interface{}) error {
+	return a.fetchAuthenticatedBy(ctx, a.bearer, func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		return a.client.Do(req)
+	}, newRequest, result)
+}
+
+func (a *API) streamRequest(opts StreamOptions) (*http.Request, error) {
+
+	req, err := a.requestFactory("GET", a.endpoint(streamPath), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+
+	for name, values := range map[string][]string{
+		"tweet.fields": opts.TweetFields,
+		"expansions":   opts.Expansions,
+		"user.fields":  opts.UserFields,
+	} {
+		if len(values) > 0 {
+			params.Set(name, strings.Join(values, ","))
+		}
+	}
+
+	req.URL.RawQuery = params.Encode()
+	a.setUserAgent(req)
+
+	return req, nil
+
+}
+
+func (a *API) streamRulesRequest(method string, body interface{}) (*http.Request, error) {
+
+	var reader io.Reader
+
+	if body != nil {
+
+		b, err := json.Marshal(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(b)
+
+	}
+
+	req, err := a.requestFactory(method, a.endpoint(streamRulesPath), reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	a.setUserAgent(req)
+
+	return req, nil
+
+}
@@ -0,0 +1,466 @@
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// fastBackoff reconnects almost immediately, so tests do not wait out the real delays
+var fastBackoff = &StreamBackoff{
+	NetworkStep:   time.Millisecond,
+	HTTPBase:      time.Millisecond,
+	RateLimitBase: time.Millisecond,
+}
+
+// streamServer returns a stand-in for the filtered stream that passes each connection, numbered from 1, to connection
+func streamServer(connection func(n int, w http.ResponseWriter, r *http.Request)) *httptest.Server {
+
+	var connections int32
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connection(int(atomic.AddInt32(&connections, 1)), w, r)
+	}))
+
+}
+
+// sendLine writes a single line of the stream and flushes it to the client
+func sendLine(w http.ResponseWriter, line string) {
+	fmt.Fprint(w, line+"\r\n")
+	w.(http.Flusher).Flush()
+}
+
+func streamAPI(server *httptest.Server) *API {
+
+	api := NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+	api.SetBearerToken("bearerToken")
+
+	return api
+
+}
+
+// collectIDs returns a FilterStream callback that records the id of each tweet, and stops the stream after n
+func collectIDs(ids *[]string, n int, stop error) func(StreamMessage) error {
+	return func(m StreamMessage) error {
+
+		*ids = append(*ids, m.ID())
+
+		if len(*ids) >= n {
+			return stop
+		}
+
+		return nil
+
+	}
+}
+
+var _ = Describe("Stream", func() {
+
+	stop := errors.New("stop")
+
+	Describe("API.FilterStream()", func() {
+
+		It("Should call fn with each tweet, skipping keep-alives, and return the error fn returns", func() {
+
+			// given
+			var (
+				query url.Values
+				auth  string
+				ids   []string
+				rules []StreamRule
+			)
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				auth = r.Header.Get("Authorization")
+				sendLine(w, "")
+				sendLine(w, `{"data": {"id": "1", "text": "one"}, "matching_rules": [{"id": "10", "tag": "iot"}]}`)
+				sendLine(w, "")
+				sendLine(w, `{"data": {"id": "2", "text": "two"}, "matching_rules": [{"id": "10", "tag": "iot"}]}`)
+				<-r.Context().Done()
+			})
+			defer server.Close()
+
+			opts := StreamOptions{TweetFields: []string{"created_at", "lang"}, Expansions: []string{"author_id"}}
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), opts, func(m StreamMessage) error {
+				rules = append(rules, m.MatchingRules...)
+				return collectIDs(&ids, 2, stop)(m)
+			})
+
+			// then
+			Expect(err).To(Equal(stop))
+			Expect(ids).To(Equal([]string{"1", "2"}))
+			Expect(rules).To(Equal([]StreamRule{{ID: "10", Tag: "iot"}, {ID: "10", Tag: "iot"}}))
+			Expect(query.Get("tweet.fields")).To(Equal("created_at,lang"))
+			Expect(query.Get("expansions")).To(Equal("author_id"))
+			Expect(auth).To(Equal("Bearer bearerToken"))
+
+		})
+
+		It("Should authorize the stream and its rules with the bearer token, even when an OAuth1Authenticator is set", func() {
+
+			// given
+			var auths []string
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+
+				auths = append(auths, r.Header.Get("Authorization"))
+
+				if r.URL.Path == "/2/tweets/search/stream/rules" {
+					fmt.Fprint(w, `{"data": []}`)
+					return
+				}
+
+				sendLine(w, `{"data": {"id": "1", "text": "one"}}`)
+				<-r.Context().Done()
+
+			})
+			defer server.Close()
+
+			api := NewAPIWithOptions("key", "secret", Options{
+				BaseURL:       server.URL,
+				Authenticator: NewOAuth1Authenticator("key", "secret", "token", "tokenSecret"),
+			})
+			api.SetBearerToken("bearerToken")
+
+			var ids []string
+
+			// when
+			_, rulesErr := api.StreamRules(context.Background())
+			err := api.FilterStream(context.Background(), StreamOptions{}, collectIDs(&ids, 1, stop))
+
+			// then
+			Expect(rulesErr).To(BeNil())
+			Expect(err).To(Equal(stop))
+			Expect(auths).To(Equal([]string{"Bearer bearerToken", "Bearer bearerToken"}))
+
+		})
+
+		It("Should keep numbers exact", func() {
+
+			// given
+			var message StreamMessage
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+				sendLine(w, `{"data": {"id": "1", "public_metrics": {"retweet_count": 1050118621198921728}}}`)
+				<-r.Context().Done()
+			})
+			defer server.Close()
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), StreamOptions{}, func(m StreamMessage) error {
+				message = m
+				return stop
+			})
+
+			// then
+			Expect(err).To(Equal(stop))
+			Expect(message.Data["public_metrics"]).To(HaveKeyWithValue("retweet_count", json.Number("1050118621198921728")))
+
+		})
+
+		It("Should reconnect when the server ends the stream", func() {
+
+			// given
+			var ids []string
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+				sendLine(w, fmt.Sprintf(`{"data": {"id": "%d"}}`, n))
+			})
+			defer server.Close()
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), StreamOptions{Backoff: fastBackoff}, collectIDs(&ids, 3, stop))
+
+			// then
+			Expect(err).To(Equal(stop))
+			Expect(ids).To(Equal([]string{"1", "2", "3"}))
+
+		})
+
+		It("Should reconnect when the stream stalls", func() {
+
+			// given
+			var ids []string
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+				sendLine(w, fmt.Sprintf(`{"data": {"id": "%d"}}`, n))
+				<-r.Context().Done()
+			})
+			defer server.Close()
+
+			opts := StreamOptions{StallTimeout: 50 * time.Millisecond, Backoff: fastBackoff}
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), opts, collectIDs(&ids, 2, stop))
+
+			// then
+			Expect(err).To(Equal(stop))
+			Expect(ids).To(Equal([]string{"1", "2"}))
+
+		})
+
+		It("Should reconnect after a disconnect message", func() {
+
+			// given
+			var ids []string
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+
+				if n == 1 {
+					sendLine(w, `{"errors": [{"title": "operational-disconnect", "disconnect_type": "UpstreamOperationalDisconnect"}]}`)
+					<-r.Context().Done()
+					return
+				}
+
+				sendLine(w, `{"data": {"id": "2"}}`)
+				<-r.Context().Done()
+
+			})
+			defer server.Close()
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), StreamOptions{Backoff: fastBackoff}, collectIDs(&ids, 1, stop))
+
+			// then
+			Expect(err).To(Equal(stop))
+			Expect(ids).To(Equal([]string{"2"}))
+
+		})
+
+		It("Should reconnect after 429 and 5xx responses", func() {
+
+			// given
+			var ids []string
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+
+				switch n {
+				case 1:
+					w.WriteHeader(http.StatusTooManyRequests)
+				case 2:
+					w.WriteHeader(http.StatusServiceUnavailable)
+				default:
+					sendLine(w, fmt.Sprintf(`{"data": {"id": "%d"}}`, n))
+					<-r.Context().Done()
+				}
+
+			})
+			defer server.Close()
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), StreamOptions{Backoff: fastBackoff}, collectIDs(&ids, 1, stop))
+
+			// then
+			Expect(err).To(Equal(stop))
+			Expect(ids).To(Equal([]string{"3"}))
+
+		})
+
+		It("Should return an *APIError, without reconnecting, when the stream is rejected", func() {
+
+			// given
+			var connections int32
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+				atomic.StoreInt32(&connections, int32(n))
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"title": "Forbidden"}`)
+			})
+			defer server.Close()
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), StreamOptions{Backoff: fastBackoff}, collectIDs(new([]string), 1, stop))
+
+			// then
+			var apiErr *APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusForbidden))
+			Expect(atomic.LoadInt32(&connections)).To(Equal(int32(1)))
+
+		})
+
+		It("Should give up after MaxReconnects consecutive failures", func() {
+
+			// given
+			var connections int32
+
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+				atomic.StoreInt32(&connections, int32(n))
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+			defer server.Close()
+
+			opts := StreamOptions{Backoff: fastBackoff, MaxReconnects: 2}
+
+			// when
+			err := streamAPI(server).FilterStream(context.Background(), opts, collectIDs(new([]string), 1, stop))
+
+			// then
+			var apiErr *APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.StatusCode).To(Equal(http.StatusServiceUnavailable))
+			Expect(atomic.LoadInt32(&connections)).To(Equal(int32(3)))
+
+		})
+
+		It("Should return ctx.Err() once ctx is done", func() {
+
+			// given
+			server := streamServer(func(n int, w http.ResponseWriter, r *http.Request) {
+				sendLine(w, "")
+				<-r.Context().Done()
+			})
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			// when
+			err := streamAPI(server).FilterStream(ctx, StreamOptions{}, collectIDs(new([]string), 1, stop))
+
+			// then
+			Expect(err).To(Equal(context.DeadlineExceeded))
+
+		})
+
+	})
+
+	Describe("StreamBackoff.Delay()", func() {
+
+		backoff := DefaultStreamBackoff
+
+		It("Should back off linearly from network errors", func() {
+			Expect(backoff.Delay(io.ErrUnexpectedEOF, 1)).To(Equal(250 * time.Millisecond))
+			Expect(backoff.Delay(ErrStreamStalled, 4)).To(Equal(time.Second))
+			Expect(backoff.Delay(ErrStreamClosed, 100)).To(Equal(16 * time.Second))
+		})
+
+		It("Should back off exponentially from HTTP errors", func() {
+
+			// given
+			err := &APIError{StatusCode: http.StatusServiceUnavailable}
+
+			// then
+			Expect(backoff.Delay(err, 1)).To(Equal(5 * time.Second))
+			Expect(backoff.Delay(err, 3)).To(Equal(20 * time.Second))
+			Expect(backoff.Delay(err, 10)).To(Equal(320 * time.Second))
+
+		})
+
+		It("Should back off exponentially from a minute after 429 responses", func() {
+
+			// given
+			err := &APIError{StatusCode: http.StatusTooManyRequests}
+
+			// then
+			Expect(backoff.Delay(err, 1)).To(Equal(time.Minute))
+			Expect(backoff.Delay(err, 2)).To(Equal(2 * time.Minute))
+			Expect(backoff.Delay(err, 10)).To(Equal(DefaultRateLimitWindow))
+
+		})
+
+	})
+
+	Describe("API.SetStreamRules()", func() {
+
+		It("Should delete the rules that changed, keep the rest, and add the new ones", func() {
+
+			// given
+			var (
+				deleted []string
+				added   []StreamRule
+			)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+				Expect(r.URL.Path).To(Equal("/2/tweets/search/stream/rules"))
+
+				if r.Method == "GET" {
+					fmt.Fprint(w, `{"data": [{"id": "1", "value": "#IoT", "tag": "iot"}, {"id": "2", "value": "#old"}]}`)
+					return
+				}
+
+				var body struct {
+					Add    []StreamRule `json:"add"`
+					Delete struct {
+						IDs []string `json:"ids"`
+					} `json:"delete"`
+				}
+
+				b, _ := ioutil.ReadAll(r.Body)
+				Expect(json.Unmarshal(b, &body)).To(Succeed())
+				Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+				if body.Add != nil {
+					added = body.Add
+					fmt.Fprint(w, `{"data": [{"id": "3", "value": "#golang", "tag": "go"}]}`)
+					return
+				}
+
+				deleted = body.Delete.IDs
+				fmt.Fprint(w, `{"meta": {"summary": {"deleted": 1}}}`)
+
+			}))
+			defer server.Close()
+
+			// when
+			rules, err := streamAPI(server).SetStreamRules(context.Background(),
+				StreamRule{Value: "#IoT", Tag: "iot"},
+				StreamRule{Value: "#golang", Tag: "go"},
+			)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(deleted).To(Equal([]string{"2"}))
+			Expect(added).To(Equal([]StreamRule{{Value: "#golang", Tag: "go"}}))
+			Expect(rules).To(Equal([]StreamRule{
+				{ID: "1", Value: "#IoT", Tag: "iot"},
+				{ID: "3", Value: "#golang", Tag: "go"},
+			}))
+
+		})
+
+	})
+
+	Describe("API.AddStreamRules()", func() {
+
+		It("Should return the rules that could not be added as a *ProblemError", func() {
+
+			// given
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{
+					"data": [{"id": "3", "value": "#golang"}],
+					"errors": [{"value": "#IoT", "id": "1", "title": "DuplicateRule", "type": "https://api.twitter.com/2/problems/duplicate-rules"}]
+				}`)
+			}))
+			defer server.Close()
+
+			// when
+			rules, err := streamAPI(server).AddStreamRules(context.Background(), StreamRule{Value: "#IoT"}, StreamRule{Value: "#golang"})
+
+			// then
+			var problemErr *ProblemError
+			Expect(errors.As(err, &problemErr)).To(BeTrue())
+			Expect(problemErr.Problems[0].Title).To(Equal("DuplicateRule"))
+			Expect(err.Error()).To(Equal("twitter: DuplicateRule (#IoT)"))
+			Expect(rules).To(Equal([]StreamRule{{ID: "3", Value: "#golang"}}))
+
+		})
+
+	})
+
+})
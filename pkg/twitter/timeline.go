@@ -0,0 +1,151 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxPerTimelineRequest is the maximum number of tweets returned per user_timeline request
+	MaxPerTimelineRequest = 200
+
+	// MaxTimelineTweets is how far back a user timeline can be paged. Only the most recent tweets of each user, up to
+	// this many, are available (see:
+	// https://developer.twitter.com/en/docs/tweets/timelines/api-reference/get-statuses-user_timeline).
+	MaxTimelineTweets = 3200
+
+	timelinePath = "1.1/statuses/user_timeline.json"
+)
+
+// TimelineUser identifies the user whose timeline to fetch, by ScreenName, or UserID if ScreenName is empty
+type TimelineUser struct {
+	ScreenName string
+	UserID     int64
+}
+
+// ParseTimelineUser parses a screen name, with or without a leading "@", or a numeric user id. A screen name made up
+// only of digits must have the "@".
+func ParseTimelineUser(s string) TimelineUser {
+
+	s = strings.TrimSpace(s)
+
+	if id, err := strconv.ParseInt(s, 10, 64); err == nil && id > 0 {
+		return TimelineUser{UserID: id}
+	}
+
+	return TimelineUser{ScreenName: strings.TrimPrefix(s, "@")}
+
+}
+
+// String implements fmt.Stringer, returning "@" followed by the ScreenName, or the UserID
+func (u TimelineUser) String() string {
+
+	if u.ScreenName != "" {
+		return "@" + u.ScreenName
+	}
+
+	return strconv.FormatInt(u.UserID, 10)
+
+}
+
+// TimelineAPIResponse represents a page of a user timeline
+type TimelineAPIResponse struct {
+	// Statuses holds each tweet exactly as returned, newest first, with numbers decoded as json.Number so that no
+	// precision is lost
+	Statuses []map[string]interface{}
+
+	// Tweets holds the typed form of each of Statuses, in the same order
+	Tweets []Tweet
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding each status both as a map, for Statuses, and as a Tweet
+func (r *TimelineAPIResponse) UnmarshalJSON(b []byte) error {
+
+	var raw []json.RawMessage
+
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	statuses, tweets, err := decodeStatuses(raw)
+
+	if err != nil {
+		return err
+	}
+
+	r.Statuses = statuses
+	r.Tweets = tweets
+
+	return nil
+
+}
+
+// FetchUserTimeline fetches the tweets of user with sinceID < id <= maxID, newest first, including retweets and
+// replies. Either bound is ignored when zero. Page through a timeline by passing the id of the oldest tweet returned,
+// minus one, as the next maxID, until a page is empty. Pages may hold fewer than count tweets even when more follow.
+//
+// Requests are scheduled against the statuses/user_timeline rate limit window (see API).
+//
+// user: whose timeline to fetch
+// count: number of records to retrieve, at most MaxPerTimelineRequest
+func (a *API) FetchUserTimeline(ctx context.Context, user TimelineUser, count int, sinceID int64, maxID int64) (TimelineAPIResponse, error) {
+
+	var result TimelineAPIResponse
+
+	err := a.fetchVia(ctx, func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		return a.doLimitedBy(ctx, a.timelineLimiter, req)
+	}, func() (*http.Request, error) {
+		return a.timelineRequest(user, count, sinceID, maxID)
+	}, &result)
+
+	if err != nil {
+		return TimelineAPIResponse{}, err
+	}
+
+	return result, nil
+
+}
+
+func (a *API) timelineRequest(user TimelineUser, count int, sinceID int64, maxID int64) (*http.Request, error) {
+
+	req, err := a.requestFactory("GET", a.endpoint(timelinePath), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := req.URL.Query()
+
+	if user.ScreenName != "" {
+		params.Set("screen_name", user.ScreenName)
+	} else {
+		params.Set("user_id", strconv.FormatInt(user.UserID, 10))
+	}
+
+	params.Set("count", fmt.Sprintf("%v", int(math.Min(float64(count), float64(MaxPerTimelineRequest)))))
+	params.Set("include_rts", "true")
+	params.Set("exclude_replies", "false")
+
+	if sinceID > 0 {
+		params.Set("since_id", fmt.Sprintf("%v", sinceID))
+	}
+
+	if maxID > 0 {
+		params.Set("max_id", fmt.Sprintf("%v", maxID))
+	}
+
+	if a.tweetMode != "" {
+		params.Set("tweet_mode", string(a.tweetMode))
+	}
+
+	req.URL.RawQuery = params.Encode()
+	a.setUserAgent(req)
+
+	return req, nil
+
+}
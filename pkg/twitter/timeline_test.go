@@ -0,0 +1,94 @@
+package twitter_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("API.FetchUserTimeline()", func() {
+
+	var (
+		requests []*http.Request
+		server   *httptest.Server
+		api      *API
+	)
+
+	BeforeEach(func() {
+
+		requests = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+			fmt.Fprint(w, `[{"id": 1261326399320715264, "id_str": "1261326399320715264", "text": "hello"}]`)
+		}))
+
+		api = NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL, TweetMode: TweetModeExtended})
+		api.SetBearerToken("bearerToken")
+
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should fetch a page of the timeline of a screen name", func() {
+
+		// when
+		resp, err := api.FetchUserTimeline(context.Background(), ParseTimelineUser("@TwitterDev"), 500, 100, 12345)
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal("/1.1/statuses/user_timeline.json"))
+		Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer bearerToken"))
+
+		query := requests[0].URL.Query()
+		Expect(query.Get("screen_name")).To(Equal("TwitterDev"))
+		Expect(query.Get("count")).To(Equal("200"))
+		Expect(query.Get("since_id")).To(Equal("100"))
+		Expect(query.Get("max_id")).To(Equal("12345"))
+		Expect(query.Get("include_rts")).To(Equal("true"))
+		Expect(query.Get("tweet_mode")).To(Equal("extended"))
+
+		Expect(resp.Statuses).To(HaveLen(1))
+		Expect(resp.Statuses[0]["id"]).To(Equal(json.Number("1261326399320715264")))
+		Expect(resp.Tweets[0].ID).To(Equal(int64(1261326399320715264)))
+
+	})
+
+	It("Should fetch the timeline of a user id", func() {
+
+		// when
+		_, err := api.FetchUserTimeline(context.Background(), ParseTimelineUser("2244994945"), 10, 0, 0)
+
+		// then
+		Expect(err).To(BeNil())
+		Expect(requests[0].URL.Query().Get("user_id")).To(Equal("2244994945"))
+		Expect(requests[0].URL.Query()).NotTo(HaveKey("screen_name"))
+		Expect(requests[0].URL.Query()).NotTo(HaveKey("max_id"))
+
+	})
+
+})
+
+var _ = Describe("TimelineUser", func() {
+
+	It("Should parse screen names and user ids", func() {
+		Expect(ParseTimelineUser("TwitterDev")).To(Equal(TimelineUser{ScreenName: "TwitterDev"}))
+		Expect(ParseTimelineUser("@TwitterDev")).To(Equal(TimelineUser{ScreenName: "TwitterDev"}))
+		Expect(ParseTimelineUser("2244994945")).To(Equal(TimelineUser{UserID: 2244994945}))
+		Expect(ParseTimelineUser("@1234")).To(Equal(TimelineUser{ScreenName: "1234"}))
+	})
+
+	It("Should print as a screen name or user id", func() {
+		Expect(TimelineUser{ScreenName: "TwitterDev"}.String()).To(Equal("@TwitterDev"))
+		Expect(TimelineUser{UserID: 2244994945}.String()).To(Equal("2244994945"))
+	})
+
+})
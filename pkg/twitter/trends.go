@@ -0,0 +1,173 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// WorldwideWOEID is the WOEID of the worldwide trends
+	WorldwideWOEID = 1
+
+	trendsPlacePath     = "1.1/trends/place.json"
+	trendsAvailablePath = "1.1/trends/available.json"
+)
+
+// Trend is a trending topic (see:
+// https://developer.twitter.com/en/docs/trends/trends-for-location/api-reference/get-trends-place)
+type Trend struct {
+	// Name is the topic, such as "#GoodFriday" or "Easter"
+	Name string `json:"name"`
+
+	// Query is the url encoded search query for the topic
+	Query string `json:"query"`
+
+	URL string `json:"url"`
+
+	// TweetVolume is the number of tweets about the topic in the last 24 hours. Zero if unknown.
+	TweetVolume int `json:"tweet_volume"`
+}
+
+// IsHashtag reports whether the topic is a hashtag
+func (t Trend) IsHashtag() bool {
+	return strings.HasPrefix(t.Name, "#")
+}
+
+// TrendLocation is a location that trends are available for
+type TrendLocation struct {
+	// WOEID is the Yahoo! Where On Earth ID of the location, for Trends
+	WOEID int64 `json:"woeid"`
+
+	Name        string `json:"name"`
+	Country     string `json:"country"`
+	CountryCode string `json:"countryCode"`
+
+	// ParentID is the WOEID of the location this location is within
+	ParentID int64 `json:"parentid"`
+
+	PlaceType struct {
+		Code int    `json:"code"`
+		Name string `json:"name"`
+	} `json:"placeType"`
+}
+
+// Trends fetches the top 50 trending topics for a location via trends/place, most trending first
+//
+// Requests are scheduled against the trends/place rate limit window (see API).
+//
+// woeid: the WOEID of the location, such as WorldwideWOEID. See TrendLocations.
+func (a *API) Trends(ctx context.Context, woeid int64) ([]Trend, error) {
+
+	var result []struct {
+		Trends []Trend `json:"trends"`
+	}
+
+	err := a.fetchVia(ctx, func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		return a.doLimitedBy(ctx, a.trendsLimiter, req)
+	}, func() (*http.Request, error) {
+		return a.trendsRequest(trendsPlacePath, fmt.Sprintf("id=%d", woeid))
+	}, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var trends []Trend
+
+	for _, place := range result {
+		trends = append(trends, place.Trends...)
+	}
+
+	return trends, nil
+
+}
+
+// TrendLocations fetches the locations that Trends is available for via trends/available
+func (a *API) TrendLocations(ctx context.Context) ([]TrendLocation, error) {
+
+	var locations []TrendLocation
+
+	err := a.fetchVia(ctx, func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		return a.client.Do(req)
+	}, func() (*http.Request, error) {
+		return a.trendsRequest(trendsAvailablePath, "")
+	}, &locations)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+
+}
+
+func (a *API) trendsRequest(path string, query string) (*http.Request, error) {
+
+	req, err := a.requestFactory("GET", a.endpoint(path), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.URL.RawQuery = query
+	a.setUserAgent(req)
+
+	return req, nil
+
+}
+
+// TrendFilter picks hashtags to query out of trending topics
+type TrendFilter struct {
+	// Top is the number of hashtags to pick. Zero picks every hashtag that passes the filter.
+	Top int
+
+	// Match, if set, only passes hashtags it matches, including the "#"
+	Match *regexp.Regexp
+
+	// Allow, if set, only passes these hashtags, compared without case, with or without the "#"
+	Allow []string
+}
+
+// Hashtags returns the Top trending hashtags of trends that pass the filter, most trending first. Topics that are not
+// hashtags are skipped, as are repeats that differ only by case.
+func (f TrendFilter) Hashtags(trends []Trend) []string {
+
+	allowed := map[string]bool{}
+
+	for _, hashtag := range f.Allow {
+		allowed[strings.ToLower("#"+strings.TrimPrefix(hashtag, "#"))] = true
+	}
+
+	var (
+		hashtags []string
+		seen     = map[string]bool{}
+	)
+
+	for _, trend := range trends {
+
+		if f.Top > 0 && len(hashtags) >= f.Top {
+			break
+		}
+
+		key := strings.ToLower(trend.Name)
+
+		switch {
+		case !trend.IsHashtag(), seen[key]:
+			continue
+		case f.Match != nil && !f.Match.MatchString(trend.Name):
+			continue
+		case len(allowed) > 0 && !allowed[key]:
+			continue
+		}
+
+		seen[key] = true
+		hashtags = append(hashtags, trend.Name)
+
+	}
+
+	return hashtags
+
+}
@@ -0,0 +1,125 @@
+package twitter_test
+
+import (
+	"context"
+	"fmt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+)
+
+const trendsPlaceJSON = `[{
+	"trends": [
+		{"name": "#GoodFriday", "url": "http://twitter.com/search?q=%23GoodFriday", "query": "%23GoodFriday", "tweet_volume": 194845},
+		{"name": "Easter", "url": "http://twitter.com/search?q=Easter", "query": "Easter", "tweet_volume": null},
+		{"name": "#IoT", "url": "http://twitter.com/search?q=%23IoT", "query": "%23IoT", "tweet_volume": 12001}
+	],
+	"as_of": "2020-04-10T18:29:51Z",
+	"locations": [{"name": "Worldwide", "woeid": 1}]
+}]`
+
+const trendsAvailableJSON = `[
+	{"name": "Worldwide", "placeType": {"code": 19, "name": "Supername"}, "parentid": 0, "country": "", "woeid": 1, "countryCode": null},
+	{"name": "Winnipeg", "placeType": {"code": 7, "name": "Town"}, "parentid": 23424775, "country": "Canada", "woeid": 2972, "countryCode": "CA"}
+]`
+
+var _ = Describe("Trends", func() {
+
+	var (
+		requests []*http.Request
+		server   *httptest.Server
+		api      *API
+	)
+
+	BeforeEach(func() {
+
+		requests = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			requests = append(requests, r)
+
+			switch r.URL.Path {
+			case "/1.1/trends/place.json":
+				fmt.Fprint(w, trendsPlaceJSON)
+			case "/1.1/trends/available.json":
+				fmt.Fprint(w, trendsAvailableJSON)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+
+		}))
+
+		api = NewAPIWithOptions("key", "secret", Options{BaseURL: server.URL})
+		api.SetBearerToken("bearerToken")
+
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("API.Trends()", func() {
+
+		It("Should fetch the trending topics of a WOEID, most trending first", func() {
+
+			// when
+			trends, err := api.Trends(context.Background(), WorldwideWOEID)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(requests[0].URL.Query().Get("id")).To(Equal("1"))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer bearerToken"))
+
+			Expect(trends).To(HaveLen(3))
+			Expect(trends[0]).To(Equal(Trend{Name: "#GoodFriday", URL: "http://twitter.com/search?q=%23GoodFriday", Query: "%23GoodFriday", TweetVolume: 194845}))
+			Expect(trends[1].TweetVolume).To(Equal(0))
+			Expect(trends[1].IsHashtag()).To(BeFalse())
+
+		})
+
+	})
+
+	Describe("API.TrendLocations()", func() {
+
+		It("Should fetch the locations trends are available for", func() {
+
+			// when
+			locations, err := api.TrendLocations(context.Background())
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(locations).To(HaveLen(2))
+			Expect(locations[1].WOEID).To(Equal(int64(2972)))
+			Expect(locations[1].Name).To(Equal("Winnipeg"))
+			Expect(locations[1].CountryCode).To(Equal("CA"))
+			Expect(locations[1].ParentID).To(Equal(int64(23424775)))
+			Expect(locations[1].PlaceType.Name).To(Equal("Town"))
+
+		})
+
+	})
+
+	Describe("TrendFilter.Hashtags()", func() {
+
+		trends := []Trend{{Name: "#GoodFriday"}, {Name: "Easter"}, {Name: "#IoT"}, {Name: "#iot"}, {Name: "#IIoT"}, {Name: "#golang"}}
+
+		It("Should pick the Top hashtags", func() {
+			Expect(TrendFilter{Top: 2}.Hashtags(trends)).To(Equal([]string{"#GoodFriday", "#IoT"}))
+			Expect(TrendFilter{}.Hashtags(trends)).To(Equal([]string{"#GoodFriday", "#IoT", "#IIoT", "#golang"}))
+		})
+
+		It("Should pick only hashtags that Match", func() {
+			Expect(TrendFilter{Top: 1, Match: regexp.MustCompile(`(?i)iot`)}.Hashtags(trends)).To(Equal([]string{"#IoT"}))
+		})
+
+		It("Should pick only hashtags that are allowed", func() {
+			Expect(TrendFilter{Allow: []string{"golang", "#IIOT"}}.Hashtags(trends)).To(Equal([]string{"#IIoT", "#golang"}))
+		})
+
+	})
+
+})
@@ -0,0 +1,290 @@
+package twitter
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// CreatedAtFormat is the format of created_at in the Twitter API
+const CreatedAtFormat = time.RubyDate
+
+// Tweet is the typed form of a tweet (see:
+// https://developer.twitter.com/en/docs/tweets/data-dictionary/overview/tweet-object). IDs are decoded from their
+// *_str fields, and created_at is parsed.
+type Tweet struct {
+	ID                  int64          `json:"id_str,string"`
+	CreatedAt           time.Time      `json:"-"`
+	Text                string         `json:"text"`
+	FullText            string         `json:"full_text"`
+	Truncated           bool           `json:"truncated"`
+	DisplayTextRange    []int          `json:"display_text_range"`
+	Source              string         `json:"source"`
+	Lang                string         `json:"lang"`
+	User                User           `json:"user"`
+	Entities            Entities       `json:"entities"`
+	Place               *Place         `json:"place"`
+	ExtendedTweet       *ExtendedTweet `json:"extended_tweet"`
+	InReplyToStatusID   int64          `json:"in_reply_to_status_id_str,string"`
+	InReplyToUserID     int64          `json:"in_reply_to_user_id_str,string"`
+	InReplyToScreenName string         `json:"in_reply_to_screen_name"`
+	QuotedStatus        *Tweet         `json:"quoted_status"`
+	RetweetedStatus     *Tweet         `json:"retweeted_status"`
+	RetweetCount        int            `json:"retweet_count"`
+	FavoriteCount       int            `json:"favorite_count"`
+
+	// Raw is the JSON the Tweet was decoded from, including every field not declared above
+	Raw json.RawMessage `json:"-"`
+
+	// DecodeErr is set, and every other field but Raw left zero, when the status could not be decoded as a Tweet. A
+	// status with a malformed field is still returned in full by the Statuses of the response it came in.
+	DecodeErr error `json:"-"`
+}
+
+// User is the typed form of a user (see:
+// https://developer.twitter.com/en/docs/tweets/data-dictionary/overview/user-object)
+type User struct {
+	ID             int64     `json:"id_str,string"`
+	CreatedAt      time.Time `json:"-"`
+	Name           string    `json:"name"`
+	ScreenName     string    `json:"screen_name"`
+	Location       string    `json:"location"`
+	Description    string    `json:"description"`
+	URL            string    `json:"url"`
+	Protected      bool      `json:"protected"`
+	Verified       bool      `json:"verified"`
+	FollowersCount int       `json:"followers_count"`
+	FriendsCount   int       `json:"friends_count"`
+	StatusesCount  int       `json:"statuses_count"`
+}
+
+// Entities are the hashtags, urls, mentions and media parsed out of a tweet's text (see:
+// https://developer.twitter.com/en/docs/tweets/data-dictionary/overview/entities-object)
+type Entities struct {
+	Hashtags     []HashtagEntity `json:"hashtags"`
+	Symbols      []HashtagEntity `json:"symbols"`
+	URLs         []URLEntity     `json:"urls"`
+	UserMentions []MentionEntity `json:"user_mentions"`
+	Media        []MediaEntity   `json:"media"`
+}
+
+// HashtagEntity is a hashtag, or a cashtag in Entities.Symbols, without the leading '#' or '$'
+type HashtagEntity struct {
+	Text    string `json:"text"`
+	Indices []int  `json:"indices"`
+}
+
+// URLEntity is a link
+type URLEntity struct {
+	URL         string `json:"url"`
+	ExpandedURL string `json:"expanded_url"`
+	DisplayURL  string `json:"display_url"`
+	Indices     []int  `json:"indices"`
+}
+
+// MentionEntity is an @mention
+type MentionEntity struct {
+	ID         int64  `json:"id_str,string"`
+	ScreenName string `json:"screen_name"`
+	Name       string `json:"name"`
+	Indices    []int  `json:"indices"`
+}
+
+// MediaEntity is an attached photo, video or gif
+type MediaEntity struct {
+	ID            int64  `json:"id_str,string"`
+	Type          string `json:"type"`
+	MediaURLHTTPS string `json:"media_url_https"`
+	URL           string `json:"url"`
+	ExpandedURL   string `json:"expanded_url"`
+	DisplayURL    string `json:"display_url"`
+	Indices       []int  `json:"indices"`
+}
+
+// Place is the location a tweet is associated with (see:
+// https://developer.twitter.com/en/docs/tweets/data-dictionary/overview/geo-objects)
+type Place struct {
+	ID          string `json:"id"`
+	URL         string `json:"url"`
+	PlaceType   string `json:"place_type"`
+	Name        string `json:"name"`
+	FullName    string `json:"full_name"`
+	CountryCode string `json:"country_code"`
+	Country     string `json:"country"`
+}
+
+// ExtendedTweet holds the full text and entities of a tweet longer than 140 characters, when it was not requested
+// with TweetModeExtended
+type ExtendedTweet struct {
+	FullText         string   `json:"full_text"`
+	DisplayTextRange []int    `json:"display_text_range"`
+	Entities         Entities `json:"entities"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, parsing created_at and keeping the raw JSON
+func (t *Tweet) UnmarshalJSON(b []byte) error {
+
+	type tweet Tweet
+
+	var decoded struct {
+		tweet
+		CreatedAt string `json:"created_at"`
+	}
+
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+
+	createdAt, err := parseCreatedAt(decoded.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	*t = Tweet(decoded.tweet)
+	t.CreatedAt = createdAt
+	t.Raw = append(json.RawMessage(nil), b...)
+
+	return nil
+
+}
+
+// CompleteText returns the untruncated text of the tweet, whichever tweet mode it was requested with: the full_text of
+// extended_tweet, then full_text, then text. A retweet's text is truncated even in extended mode, so it is rebuilt
+// from the retweeted status as "RT @screen_name: text".
+func (t Tweet) CompleteText() string {
+
+	if t.RetweetedStatus != nil {
+		return "RT @" + t.RetweetedStatus.User.ScreenName + ": " + t.RetweetedStatus.CompleteText()
+	}
+
+	if t.ExtendedTweet != nil && t.ExtendedTweet.FullText != "" {
+		return t.ExtendedTweet.FullText
+	}
+
+	if t.FullText != "" {
+		return t.FullText
+	}
+
+	return t.Text
+
+}
+
+// TweetFromStatus converts status, a tweet as decoded into a map by either API version, such as one of the Statuses
+// of a SearchAPIResponse, to a Tweet. An API v2 tweet, as joined by V2API, is told apart by its author and referenced
+// tweets, which a v1.1 tweet never has.
+func TweetFromStatus(status map[string]interface{}) (Tweet, error) {
+
+	for _, field := range []string{"author", "author_id", "referenced_tweets"} {
+		if _, ok := status[field]; ok {
+			return tweetFromV2(status)
+		}
+	}
+
+	raw, err := json.Marshal(status)
+
+	if err != nil {
+		return Tweet{}, err
+	}
+
+	var tweet Tweet
+
+	if err := json.Unmarshal(raw, &tweet); err != nil {
+		return Tweet{}, err
+	}
+
+	return tweet, nil
+
+}
+
+// UnmarshalJSON implements json.Unmarshaler, parsing created_at
+func (u *User) UnmarshalJSON(b []byte) error {
+
+	type user User
+
+	var decoded struct {
+		user
+		CreatedAt string `json:"created_at"`
+	}
+
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+
+	createdAt, err := parseCreatedAt(decoded.CreatedAt)
+
+	if err != nil {
+		return err
+	}
+
+	*u = User(decoded.user)
+	u.CreatedAt = createdAt
+
+	return nil
+
+}
+
+// parseCreatedAt parses a created_at value. An empty value is the zero time.
+func parseCreatedAt(createdAt string) (time.Time, error) {
+
+	if createdAt == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(CreatedAtFormat, createdAt)
+
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding each status both as a map, for Statuses, and as a Tweet
+func (r *SearchAPIResponse) UnmarshalJSON(b []byte) error {
+
+	var decoded struct {
+		Statuses       []json.RawMessage `json:"statuses"`
+		SearchMetadata SearchMetadata    `json:"search_metadata"`
+	}
+
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+
+	statuses, tweets, err := decodeStatuses(decoded.Statuses)
+
+	if err != nil {
+		return err
+	}
+
+	r.Statuses = statuses
+	r.Tweets = tweets
+	r.SearchMetadata = decoded.SearchMetadata
+
+	return nil
+
+}
+
+// decodeStatuses decodes each raw status as a map, with numbers kept as json.Number, and as a Tweet. Only a status
+// that is not a JSON object fails the page; one whose fields do not fit a Tweet gets a Tweet with DecodeErr set.
+func decodeStatuses(raw []json.RawMessage) ([]map[string]interface{}, []Tweet, error) {
+
+	var (
+		statuses = make([]map[string]interface{}, len(raw))
+		tweets   = make([]Tweet, len(raw))
+	)
+
+	for i, status := range raw {
+
+		decoder := json.NewDecoder(bytes.NewReader(status))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&statuses[i]); err != nil {
+			return nil, nil, err
+		}
+
+		if err := json.Unmarshal(status, &tweets[i]); err != nil {
+			tweets[i] = Tweet{Raw: append(json.RawMessage(nil), status...), DecodeErr: err}
+		}
+
+	}
+
+	return statuses, tweets, nil
+
+}
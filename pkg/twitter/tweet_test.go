@@ -0,0 +1,240 @@
+package twitter_test
+
+import (
+	"encoding/json"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/tniswong/meshify/pkg/twitter"
+	"time"
+)
+
+const statusJSON = `{
+	"created_at": "Wed Oct 10 20:19:24 +0000 2018",
+	"id": 1050118621198921728,
+	"id_str": "1050118621198921728",
+	"text": "To make room for more expression, we will now count all emojis as equal #IoT https://t.co/abc",
+	"truncated": true,
+	"source": "<a href=\"http://twitter.com\" rel=\"nofollow\">Twitter Web Client</a>",
+	"lang": "en",
+	"in_reply_to_status_id_str": null,
+	"in_reply_to_user_id_str": "6253282",
+	"in_reply_to_screen_name": "TwitterAPI",
+	"user": {
+		"id": 6253282,
+		"id_str": "6253282",
+		"name": "Twitter API",
+		"screen_name": "TwitterAPI",
+		"verified": true,
+		"followers_count": 6129794,
+		"created_at": "Wed May 23 06:01:13 +0000 2007"
+	},
+	"entities": {
+		"hashtags": [{"text": "IoT", "indices": [72, 76]}],
+		"urls": [{"url": "https://t.co/abc", "expanded_url": "https://example.com", "display_url": "example.com", "indices": [77, 93]}],
+		"user_mentions": [{"id_str": "783214", "screen_name": "Twitter", "name": "Twitter", "indices": [0, 8]}]
+	},
+	"place": {"id": "07d9db48bc083000", "full_name": "Boulder, CO", "country_code": "US"},
+	"extended_tweet": {"full_text": "To make room for more expression, we will now count all emojis as equal, including those with gender and skin tone modifiers #IoT"},
+	"retweeted_status": {"id_str": "1050118621198921700", "text": "original"},
+	"retweet_count": 161,
+	"favorite_count": 296,
+	"unknown_field": "kept"
+}`
+
+var _ = Describe("Tweet", func() {
+
+	Describe("Tweet.UnmarshalJSON()", func() {
+
+		It("Should decode the typed fields", func() {
+
+			// given
+			var tweet Tweet
+
+			// when
+			err := json.Unmarshal([]byte(statusJSON), &tweet)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(tweet.ID).To(Equal(int64(1050118621198921728)))
+			Expect(tweet.CreatedAt).To(BeTemporally("==", time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC)))
+			Expect(tweet.Truncated).To(BeTrue())
+			Expect(tweet.InReplyToStatusID).To(BeZero())
+			Expect(tweet.InReplyToUserID).To(Equal(int64(6253282)))
+			Expect(tweet.User.ID).To(Equal(int64(6253282)))
+			Expect(tweet.User.ScreenName).To(Equal("TwitterAPI"))
+			Expect(tweet.User.CreatedAt).To(BeTemporally("==", time.Date(2007, 5, 23, 6, 1, 13, 0, time.UTC)))
+			Expect(tweet.Entities.Hashtags).To(Equal([]HashtagEntity{{Text: "IoT", Indices: []int{72, 76}}}))
+			Expect(tweet.Entities.URLs[0].ExpandedURL).To(Equal("https://example.com"))
+			Expect(tweet.Entities.UserMentions[0].ID).To(Equal(int64(783214)))
+			Expect(tweet.Place.FullName).To(Equal("Boulder, CO"))
+			Expect(tweet.ExtendedTweet.FullText).To(HaveSuffix("skin tone modifiers #IoT"))
+			Expect(tweet.RetweetedStatus.ID).To(Equal(int64(1050118621198921700)))
+			Expect(tweet.FavoriteCount).To(Equal(296))
+
+		})
+
+		It("Should keep the raw JSON", func() {
+
+			// given
+			var tweet Tweet
+
+			// when
+			err := json.Unmarshal([]byte(statusJSON), &tweet)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(tweet.Raw).To(MatchJSON(statusJSON))
+
+		})
+
+		It("Should return an error for a malformed created_at", func() {
+
+			// given
+			var tweet Tweet
+
+			// when
+			err := json.Unmarshal([]byte(`{"created_at": "2018-10-10T20:19:24Z"}`), &tweet)
+
+			// then
+			Expect(err).NotTo(BeNil())
+
+		})
+
+	})
+
+	Describe("SearchAPIResponse.UnmarshalJSON()", func() {
+
+		It("Should decode each status as both a map and a Tweet, keeping numbers exact", func() {
+
+			// given
+			var resp SearchAPIResponse
+
+			// when
+			err := json.Unmarshal([]byte(`{"statuses": [`+statusJSON+`], "search_metadata": {"count": 1}}`), &resp)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.Statuses).To(HaveLen(1))
+			Expect(resp.Statuses[0]["id"]).To(Equal(json.Number("1050118621198921728")))
+			Expect(resp.Statuses[0]["unknown_field"]).To(Equal("kept"))
+			Expect(resp.Tweets).To(HaveLen(1))
+			Expect(resp.Tweets[0].ID).To(Equal(int64(1050118621198921728)))
+			Expect(resp.SearchMetadata.Count).To(Equal(1))
+
+		})
+
+		It("Should keep a status whose typed fields are malformed, setting the DecodeErr of its Tweet", func() {
+
+			// given
+			var resp SearchAPIResponse
+			malformed := `{"id_str": "2", "created_at": "2018-10-10T20:19:24Z", "text": "kept"}`
+
+			// when
+			err := json.Unmarshal([]byte(`{"statuses": [`+malformed+`, `+statusJSON+`]}`), &resp)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(resp.Statuses).To(HaveLen(2))
+			Expect(resp.Statuses[0]["text"]).To(Equal("kept"))
+
+			Expect(resp.Tweets).To(HaveLen(2))
+			Expect(resp.Tweets[0].DecodeErr).NotTo(BeNil())
+			Expect(resp.Tweets[0].Raw).To(MatchJSON(malformed))
+			Expect(resp.Tweets[1].DecodeErr).To(BeNil())
+			Expect(resp.Tweets[1].ID).To(Equal(int64(1050118621198921728)))
+
+		})
+
+	})
+
+	Describe("Tweet.CompleteText()", func() {
+
+		It("Should prefer extended_tweet.full_text, then full_text, then text", func() {
+
+			// given
+			tweets := []Tweet{
+				{Text: "short", FullText: "full", ExtendedTweet: &ExtendedTweet{FullText: "extended"}},
+				{Text: "short", FullText: "full"},
+				{Text: "short"},
+			}
+
+			// when
+			var texts []string
+
+			for _, tweet := range tweets {
+				texts = append(texts, tweet.CompleteText())
+			}
+
+			// then
+			Expect(texts).To(Equal([]string{"extended", "full", "short"}))
+
+		})
+
+		It("Should rebuild a retweet from the complete text of the retweeted status", func() {
+
+			// given
+			tweet := Tweet{
+				FullText: "RT @TwitterAPI: trunc…",
+				RetweetedStatus: &Tweet{
+					User:     User{ScreenName: "TwitterAPI"},
+					FullText: "the complete text",
+				},
+			}
+
+			// when
+			text := tweet.CompleteText()
+
+			// then
+			Expect(text).To(Equal("RT @TwitterAPI: the complete text"))
+
+		})
+
+	})
+
+	Describe("TweetFromStatus()", func() {
+
+		It("Should convert a v1.1 status", func() {
+
+			// given
+			var resp SearchAPIResponse
+			Expect(json.Unmarshal([]byte(`{"statuses": [`+statusJSON+`]}`), &resp)).To(Succeed())
+
+			// when
+			tweet, err := TweetFromStatus(resp.Statuses[0])
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(tweet.ID).To(Equal(resp.Tweets[0].ID))
+			Expect(tweet.CompleteText()).To(Equal(resp.Tweets[0].CompleteText()))
+
+		})
+
+		It("Should convert an API v2 status, including its joined retweeted tweet", func() {
+
+			// given
+			status := map[string]interface{}{
+				"id":     "1",
+				"text":   "RT @TwitterDev: trunc…",
+				"author": map[string]interface{}{"id": "10", "username": "someone"},
+				"referenced_tweets": []interface{}{
+					map[string]interface{}{
+						"type":  "retweeted",
+						"id":    "2",
+						"tweet": map[string]interface{}{"id": "2", "author": map[string]interface{}{"username": "TwitterDev"}, "text": "the complete text"},
+					},
+				},
+			}
+
+			// when
+			tweet, err := TweetFromStatus(status)
+
+			// then
+			Expect(err).To(BeNil())
+			Expect(tweet.User.ScreenName).To(Equal("someone"))
+			Expect(tweet.CompleteText()).To(Equal("RT @TwitterDev: the complete text"))
+
+		})
+
+	})
+
+})